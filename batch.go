@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// batch modes
+const (
+	batchTransaction = "transaction"
+	batchPerItem     = "per_item"
+)
+
+// maxBatchOperations caps the operations of a single batch request
+const maxBatchOperations = 1000
+
+type (
+
+	// batchRequest is the payload of POST /Company_Detail:batch
+	batchRequest struct {
+		Mode       string           `json:"mode"`
+		Operations []batchOperation `json:"operations"`
+	}
+
+	// batchOperation creates or upserts the company, or deletes Company_ID
+	batchOperation struct {
+		Op         BatchAction     `json:"op"`
+		Company_ID int             `json:"Company_ID"`
+		Company    json.RawMessage `json:"company"`
+	}
+
+	// batchResponse reports the outcome of every operation of a batch
+	batchResponse struct {
+		Mode      string        `json:"mode"`
+		Succeeded int           `json:"succeeded"`
+		Failed    int           `json:"failed"`
+		Results   []batchResult `json:"results"`
+	}
+
+	// batchResult is the outcome of a single operation, in the status code it
+	// would get as a request of its own
+	batchResult struct {
+		Index      int              `json:"index"`
+		Op         BatchAction      `json:"op"`
+		Company_ID int              `json:"Company_ID,omitempty"`
+		Status     int              `json:"status"`
+		Detail     string           `json:"detail,omitempty"`
+		Errors     validationErrors `json:"errors,omitempty"`
+	}
+)
+
+// succeeded reports whether the operation was applied
+func (res batchResult) succeeded() bool {
+	return res.Status < http.StatusBadRequest
+}
+
+//	POST /Company_Detail:batch
+//	payload : mode (transaction or per_item) and the create, upsert and delete operations
+//
+// run many Company writes in a single request, in one transaction or item by item
+func (app *App) batchCompanies(w http.ResponseWriter, r *http.Request) {
+
+	var request batchRequest
+
+	app.logger.Println("Endpoint hit : batchCompanies")
+	// get the operations from the payload
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		app.writeProblem(w, r, http.StatusBadRequest, "invalid payload : "+err.Error())
+		return
+	}
+	if request.Mode == "" {
+		request.Mode = batchTransaction
+	}
+	if request.Mode != batchTransaction && request.Mode != batchPerItem {
+		app.writeProblem(w, r, http.StatusBadRequest, fmt.Sprintf("mode must be %s or %s", batchTransaction, batchPerItem))
+		return
+	}
+	if len(request.Operations) == 0 || len(request.Operations) > maxBatchOperations {
+		app.writeProblem(w, r, http.StatusBadRequest, fmt.Sprintf("operations must hold 1 to %d entries", maxBatchOperations))
+		return
+	}
+	atomic := request.Mode == batchTransaction
+
+	// validate every operation, only the valid ones are sent to the store
+	response := batchResponse{Mode: request.Mode, Results: make([]batchResult, len(request.Operations))}
+	var (
+		ops     []BatchOp
+		indexes []int
+		seen    = make(map[int]bool, len(request.Operations))
+	)
+	for i, operation := range request.Operations {
+
+		op, result := checkBatchOperation(operation)
+		result.Index = i
+		if result.Status == 0 && atomic && seen[op.Company.Company_ID] {
+			result.Status = http.StatusUnprocessableEntity
+			result.Errors = validationErrors{{"Company_ID", codeInvalidValue, "must not repeat in a transaction batch"}}
+		}
+		seen[op.Company.Company_ID] = true
+
+		response.Results[i] = result
+		if result.Status == 0 {
+			ops = append(ops, op)
+			indexes = append(indexes, i)
+		}
+	}
+
+	// a transaction only runs when every operation is valid
+	if atomic && len(ops) < len(request.Operations) {
+		app.writeBatch(w, response, "not run, the batch holds invalid operations")
+		return
+	}
+
+	errs, err := app.Store.Batch(r.Context(), ops, atomic)
+	if err != nil && !errors.Is(err, errBatchFailed) {
+		app.writeStoreError(w, r, err)
+		return
+	}
+	for i, index := range indexes {
+		result := &response.Results[index]
+		if errs[i] != nil {
+			result.Status, result.Detail = app.storeErrorStatus(errs[i])
+			continue
+		}
+		switch ops[i].Action {
+		case batchCreate:
+			result.Status = http.StatusCreated
+		case batchUpsert:
+			result.Status = http.StatusOK
+		case batchDelete:
+			result.Status = http.StatusNoContent
+		}
+	}
+	app.logger.Printf(" DB batch of %d operations performed.\n", len(ops))
+
+	app.writeBatch(w, response, "rolled back, another operation of the batch failed")
+}
+
+// checkBatchOperation returns the BatchOp of a valid operation, or the result
+// rejecting it. Valid operations get a result without status
+func checkBatchOperation(operation batchOperation) (op BatchOp, result batchResult) {
+
+	op.Action = operation.Op
+	result.Op = operation.Op
+	result.Company_ID = operation.Company_ID
+
+	switch operation.Op {
+	case batchCreate, batchUpsert:
+		if len(operation.Company) == 0 {
+			result.Status, result.Detail = http.StatusBadRequest, "company must be set"
+			return
+		}
+
+		errs, err := checkCompany(bytes.NewReader(operation.Company), &op.Company)
+		result.Company_ID = op.Company.Company_ID
+		if err != nil {
+			result.Status, result.Detail = http.StatusBadRequest, "invalid company : "+err.Error()
+		} else if len(errs) > 0 {
+			result.Status, result.Detail, result.Errors = http.StatusUnprocessableEntity, "invalid company payload", errs
+		}
+
+	case batchDelete:
+		op.Company.Company_ID = operation.Company_ID
+		if operation.Company_ID <= 0 {
+			result.Status = http.StatusUnprocessableEntity
+			result.Errors = validationErrors{{"Company_ID", codeRequired, "must be a positive number"}}
+		}
+
+	default:
+		result.Status, result.Detail = http.StatusBadRequest, fmt.Sprintf("op must be %s, %s or %s", batchCreate, batchUpsert, batchDelete)
+	}
+	return
+}
+
+// writeBatch counts the batch results and sends them. Transactions that failed
+// answer with the status of their first failing operation, the others get
+// skipped as detail and 424. Partly failed per item batches answer 207
+func (app *App) writeBatch(w http.ResponseWriter, response batchResponse, skipped string) {
+
+	status := http.StatusOK
+	for _, result := range response.Results {
+		if !result.succeeded() {
+			response.Failed++
+			if status == http.StatusOK {
+				status = result.Status
+			}
+		}
+	}
+
+	switch {
+	case status == http.StatusOK:
+	case response.Mode == batchPerItem:
+		status = http.StatusMultiStatus
+	default:
+		for i := range response.Results {
+			if result := &response.Results[i]; result.succeeded() {
+				result.Status, result.Detail = http.StatusFailedDependency, skipped
+				response.Failed++
+			}
+		}
+	}
+	response.Succeeded = len(response.Results) - response.Failed
+
+	app.writeJSON(w, status, response)
+}
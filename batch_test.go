@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStoreBatch(t *testing.T) {
+
+	for _, dbType := range testDBTypes() {
+
+		ctx := context.Background()
+		app := initTestModule(t, dbType)
+
+		changed := testCompany(1)
+		changed.ASIC = "changed"
+
+		// consecutive operations of one action share a statement
+		errs, err := app.Store.Batch(ctx, []BatchOp{
+			{batchCreate, testCompany(1)},
+			{batchCreate, testCompany(2)},
+			{batchUpsert, changed},
+			{batchUpsert, testCompany(3)},
+			{batchDelete, Company{Company_ID: 2}},
+		}, true)
+		if err != nil {
+			t.Fatalf("%s: %v %v", dbType, err, errs)
+		}
+
+		want := map[int]Company{1: changed, 3: testCompany(3)}
+		checkStored := func(step string) {
+			stored, err := app.Store.List(ctx, ListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(stored) != len(want) {
+				t.Errorf("%s %s: got %d companies want %d", dbType, step, len(stored), len(want))
+			}
+			for _, company := range stored {
+				if !sameCompany(company, want[company.Company_ID]) {
+					t.Errorf("%s %s: got %+v want %+v", dbType, step, company, want[company.Company_ID])
+				}
+			}
+		}
+		checkStored("transaction")
+
+		// a failing operation rolls the transaction back
+		errs, err = app.Store.Batch(ctx, []BatchOp{
+			{batchCreate, testCompany(4)},
+			{batchCreate, testCompany(1)},
+		}, true)
+		if !errors.Is(err, errBatchFailed) || errs[0] != nil || errs[1] != ErrCompanyExists {
+			t.Errorf("%s: failed transaction got %v %v", dbType, err, errs)
+		}
+		errs, err = app.Store.Batch(ctx, []BatchOp{
+			{batchUpsert, testCompany(4)},
+			{batchDelete, Company{Company_ID: 9}},
+		}, true)
+		if !errors.Is(err, errBatchFailed) || errs[0] != nil || errs[1] != ErrCompanyNotFound {
+			t.Errorf("%s: failed transaction got %v %v", dbType, err, errs)
+		}
+		checkStored("rollback")
+
+		// an upsert never moves the company of another client
+		other := testCompany(1)
+		other.Client_ID = 7
+		errs, err = app.Store.Batch(ctx, []BatchOp{
+			{batchUpsert, testCompany(4)},
+			{batchUpsert, other},
+		}, true)
+		if !errors.Is(err, errBatchFailed) || errs[0] != nil || errs[1] != ErrCompanyOfOtherClient {
+			t.Errorf("%s: other client transaction got %v %v", dbType, err, errs)
+		}
+		checkStored("other client transaction")
+
+		// item by item, the failing operations are skipped
+		errs, err = app.Store.Batch(ctx, []BatchOp{
+			{batchCreate, testCompany(4)},
+			{batchCreate, testCompany(1)},
+			{batchDelete, Company{Company_ID: 9}},
+			{batchDelete, Company{Company_ID: 3}},
+			{batchUpsert, other},
+		}, false)
+		if err != nil || errs[0] != nil || errs[1] != ErrCompanyExists || errs[2] != ErrCompanyNotFound || errs[3] != nil || errs[4] != ErrCompanyOfOtherClient {
+			t.Errorf("%s: per item got %v %v", dbType, err, errs)
+		}
+		want = map[int]Company{1: changed, 4: testCompany(4)}
+		checkStored("per item")
+	}
+}
+
+func TestBatchCompanies(t *testing.T) {
+
+	for _, dbType := range testDBTypes() {
+
+		app := initTestModule(t, dbType)
+		if err := app.Store.Create(context.Background(), &Company{Client_ID: testCompany(1).Client_ID, Company_ID: 1, Company_Name: "TEST_GO"}); err != nil {
+			t.Fatal(err)
+		}
+
+		company := func(companyID int) string {
+			payload, _ := json.Marshal(testCompany(companyID))
+			return string(payload)
+		}
+		other := testCompany(1)
+		other.Client_ID = 7
+		otherClient, _ := json.Marshal(other)
+
+		for _, tc := range []struct {
+			name     string
+			body     string
+			status   int
+			statuses []int
+		}{
+			{"transaction", `{"operations": [{"op": "create", "company": ` + company(2) + `}, {"op": "upsert", "company": ` + company(1) + `}]}`,
+				http.StatusOK, []int{http.StatusCreated, http.StatusOK}},
+			{"other client", `{"operations": [{"op": "upsert", "company": ` + company(3) + `}, {"op": "upsert", "company": ` + string(otherClient) + `}]}`,
+				http.StatusConflict, []int{http.StatusFailedDependency, http.StatusConflict}},
+			{"repeated company", `{"operations": [{"op": "create", "company": ` + company(5) + `}, {"op": "delete", "Company_ID": 5}]}`,
+				http.StatusUnprocessableEntity, []int{http.StatusFailedDependency, http.StatusUnprocessableEntity}},
+			{"failed transaction", `{"mode": "transaction", "operations": [{"op": "create", "company": ` + company(3) + `}, {"op": "create", "company": ` + company(1) + `}]}`,
+				http.StatusConflict, []int{http.StatusFailedDependency, http.StatusConflict}},
+			{"invalid transaction", `{"operations": [{"op": "create", "company": ` + company(3) + `}, {"op": "create", "company": {"Company_ID": 4}}, {"op": "delete", "Company_ID": 3}]}`,
+				http.StatusUnprocessableEntity, []int{http.StatusFailedDependency, http.StatusUnprocessableEntity, http.StatusUnprocessableEntity}},
+			{"per item", `{"mode": "per_item", "operations": [{"op": "create", "company": ` + company(3) + `}, {"op": "create", "company": ` + company(1) + `}, {"op": "merge"}, {"op": "delete", "Company_ID": 3}]}`,
+				http.StatusMultiStatus, []int{http.StatusCreated, http.StatusConflict, http.StatusBadRequest, http.StatusNoContent}},
+			{"unknown mode", `{"mode": "eventually", "operations": [{"op": "delete", "Company_ID": 1}]}`, http.StatusBadRequest, nil},
+			{"no operations", `{"operations": []}`, http.StatusBadRequest, nil},
+			{"unknown field", `{"operations": [{"op": "delete", "id": 1}]}`, http.StatusBadRequest, nil},
+		} {
+			req := httptest.NewRequest("POST", "/Company_Detail:batch", strings.NewReader(tc.body))
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(app.batchCompanies).ServeHTTP(rr, req)
+
+			if rr.Code != tc.status {
+				t.Errorf("%s %s: got status %d want %d : %s", dbType, tc.name, rr.Code, tc.status, rr.Body)
+				continue
+			}
+			if tc.statuses == nil {
+				continue
+			}
+
+			var response batchResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			for i, result := range response.Results {
+				if result.Index != i || result.Status != tc.statuses[i] {
+					t.Errorf("%s %s: result %d got %+v want status %d", dbType, tc.name, i, result, tc.statuses[i])
+				}
+			}
+			if len(response.Results) != len(tc.statuses) || response.Succeeded+response.Failed != len(tc.statuses) {
+				t.Errorf("%s %s: got %+v", dbType, tc.name, response)
+			}
+		}
+
+		// only the successful batches were applied
+		stored, err := app.Store.List(context.Background(), ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(stored) != 2 || !sameCompany(stored[0], testCompany(1)) || !sameCompany(stored[1], testCompany(2)) {
+			t.Errorf("%s: got %+v", dbType, stored)
+		}
+	}
+}
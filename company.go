@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// companyField maps a Company struct field to its Company_Detail column
+type companyField struct {
+	column string
+	addr   func(c *Company) interface{}
+}
+
+// companyFields is the shared field mapping used to build the column lists,
+// placeholders and arguments of every Company_Detail query
+var companyFields = []companyField{
+	{"Client_ID", func(c *Company) interface{} { return &c.Client_ID }},
+	{"Company_ID", func(c *Company) interface{} { return &c.Company_ID }},
+	{"Company_Name", func(c *Company) interface{} { return &c.Company_Name }},
+	{"ASIC", func(c *Company) interface{} { return &c.ASIC }},
+	{"Flight_Risk_Status", func(c *Company) interface{} { return &c.Flight_Risk_Status }},
+	{"Recruit_Status", func(c *Company) interface{} { return &c.Recruit_Status }},
+	{"Total_Flight_Risk", func(c *Company) interface{} { return &c.Total_Flight_Risk }},
+	{"Total_Backfill", func(c *Company) interface{} { return &c.Total_Backfill }},
+	{"Create_Date", func(c *Company) interface{} { return &c.Create_Date }},
+	{"Last_Update", func(c *Company) interface{} { return &c.Last_Update }},
+	{"Data_As_Of_Date", func(c *Company) interface{} { return &c.Data_As_Of_Date }},
+}
+
+// placeholder returns the n-th (1 based) bind parameter for the given DB type
+func placeholder(dbType string, n int) string {
+
+	if dbType == "postgres" {
+		return "$" + strconv.Itoa(n)
+	}
+	return "?"
+}
+
+// placeholderList returns count comma separated bind parameters, starting at
+// the first (1 based) one
+func placeholderList(dbType string, first, count int) string {
+
+	params := make([]string, count)
+	for i := range params {
+		params[i] = placeholder(dbType, first+i)
+	}
+	return strings.Join(params, ",")
+}
+
+// companyKeyColumn identifies a row of Company_Detail
+const companyKeyColumn = "Company_ID"
+
+// columnList returns the comma separated Company_Detail columns of the given fields
+func columnList(fields []companyField) string {
+
+	columns := make([]string, len(fields))
+	for i, field := range fields {
+		columns[i] = field.column
+	}
+	return strings.Join(columns, ", ")
+}
+
+// fieldArgs returns the addresses of the given Company fields, usable both as
+// query arguments and as Scan destinations
+func fieldArgs(fields []companyField, company *Company) []interface{} {
+
+	args := make([]interface{}, len(fields))
+	for i, field := range fields {
+		args[i] = field.addr(company)
+	}
+	return args
+}
+
+// scanDests returns the Scan destinations of the given Company fields, text
+// columns read NULL as an empty string flagged in nullText
+func scanDests(fields []companyField, company *Company) []interface{} {
+
+	dests := fieldArgs(fields, company)
+	for i, dest := range dests {
+		if text, ok := dest.(*string); ok {
+			dests[i] = nullString{text, &company.nullText, nullTextBit(fields[i].column)}
+		}
+	}
+	return dests
+}
+
+// nullTextBit returns the nullText flag of a text column
+func nullTextBit(column string) uint16 {
+
+	for i, field := range companyFields {
+		if field.column == column {
+			return 1 << i
+		}
+	}
+	panic("unmapped company column " + column)
+}
+
+// nullString scans a nullable text column into a string
+type nullString struct {
+	value *string
+	nulls *uint16
+	bit   uint16
+}
+
+// Scan implements sql.Scanner, NULL is stored as "" and flagged
+func (n nullString) Scan(src interface{}) error {
+
+	var text sql.NullString
+	if err := text.Scan(src); err != nil {
+		return err
+	}
+	*n.value = text.String
+	if text.Valid {
+		*n.nulls &^= n.bit
+	} else {
+		*n.nulls |= n.bit
+	}
+	return nil
+}
+
+// companyArgs returns the query arguments for every mapped Company field
+func companyArgs(company *Company) []interface{} {
+	return fieldArgs(companyFields, company)
+}
+
+// insertCompanyQuery builds the INSERT statement persisting every Company field
+func insertCompanyQuery(dbType string) string {
+	return insertRowsQuery(dbType, 1, false)
+}
+
+// insertRowsQuery builds a multi-row INSERT of every Company field, the
+// arguments of each row follow each other. With upsert, rows whose Company_ID
+// is taken replace the stored fields
+func insertRowsQuery(dbType string, rows int, upsert bool) string {
+
+	values := make([]string, rows)
+	for row := range values {
+		values[row] = "(" + placeholderList(dbType, row*len(companyFields)+1, len(companyFields)) + ")"
+	}
+	query := "INSERT INTO Company_Detail (" + columnList(companyFields) + ") VALUES " + strings.Join(values, ",")
+
+	if !upsert {
+		return query
+	}
+
+	// the key is left as is, every other column takes the inserted value
+	var sets []string
+	for _, field := range companyFields {
+		if field.column == companyKeyColumn {
+			continue
+		}
+		if dbType == "mysql" {
+			sets = append(sets, field.column+"=VALUES("+field.column+")")
+		} else {
+			sets = append(sets, field.column+"=excluded."+field.column)
+		}
+	}
+	if dbType == "mysql" {
+		return query + " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+	}
+	return query + " ON CONFLICT (" + companyKeyColumn + ") DO UPDATE SET " + strings.Join(sets, ", ")
+}
+
+// upsertClientQuery builds the INSERT statement persisting every Company field,
+// replacing the stored fields only when the taken Company_ID has the same
+// Client_ID. The stored row of another client is left as is
+func upsertClientQuery(dbType string) string {
+	return upsertClientRowsQuery(dbType, 1)
+}
+
+// upsertClientRowsQuery builds the multi-row INSERT of upsertClientQuery, the
+// arguments of each row follow each other
+func upsertClientRowsQuery(dbType string, rows int) string {
+
+	query := insertRowsQuery(dbType, rows, false)
+	if dbType != "mysql" {
+		return insertRowsQuery(dbType, rows, true) + " WHERE Company_Detail.Client_ID = excluded.Client_ID"
+	}
+
+	// MySQL has no condition on the update, so every column keeps its value
+	// for another client
+	var sets []string
+	for _, field := range companyFields {
+		if field.column == companyKeyColumn || field.column == "Client_ID" {
+			continue
+		}
+		sets = append(sets, field.column+"=IF(Client_ID=VALUES(Client_ID), VALUES("+field.column+"), "+field.column+")")
+	}
+	return query + " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+}
+
+// updateCompanyQuery builds the UPDATE statement persisting every Company field,
+// the key of the updated row is bound to the last placeholder
+func updateCompanyQuery(dbType string) string {
+	return updateFieldsQuery(dbType, companyFields)
+}
+
+// updateFieldsQuery builds the UPDATE statement persisting the given Company
+// fields, the key of the updated row is bound to the last placeholder
+func updateFieldsQuery(dbType string, fields []companyField) string {
+
+	sets := make([]string, len(fields))
+	for i, field := range fields {
+		sets[i] = field.column + "=" + placeholder(dbType, i+1)
+	}
+
+	return "UPDATE Company_Detail SET " + strings.Join(sets, ", ") + " WHERE " + companyKeyColumn + "=" + placeholder(dbType, len(fields)+1)
+}
+
+// changedColumns returns the columns whose value differs between the companies
+func changedColumns(before, after *Company) []string {
+
+	var columns []string
+	for _, field := range companyFields {
+		old, _ := json.Marshal(field.addr(before))
+		updated, _ := json.Marshal(field.addr(after))
+		if !bytes.Equal(old, updated) {
+			columns = append(columns, field.column)
+		}
+	}
+	return columns
+}
+
+// copyFields copies the given fields from src to dst
+func copyFields(dst, src *Company, fields []companyField) {
+
+	for _, field := range fields {
+		switch to := field.addr(dst).(type) {
+		case *int:
+			*to = *field.addr(src).(*int)
+		case *string:
+			*to = *field.addr(src).(*string)
+		case *NullInt:
+			*to = *field.addr(src).(*NullInt)
+		case *NullTime:
+			*to = *field.addr(src).(*NullTime)
+		case *NullDate:
+			*to = *field.addr(src).(*NullDate)
+		default:
+			panic(fmt.Sprintf("uncopyable company field %s", field.column))
+		}
+	}
+}
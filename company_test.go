@@ -0,0 +1,76 @@
+package main
+
+import "testing"
+
+func TestInsertCompanyQuery(t *testing.T) {
+
+	for dbType, want := range map[string]string{
+		"mysql":    "INSERT INTO Company_Detail (Client_ID, Company_ID, Company_Name, ASIC, Flight_Risk_Status, Recruit_Status, Total_Flight_Risk, Total_Backfill, Create_Date, Last_Update, Data_As_Of_Date) VALUES (?,?,?,?,?,?,?,?,?,?,?)",
+		"postgres": "INSERT INTO Company_Detail (Client_ID, Company_ID, Company_Name, ASIC, Flight_Risk_Status, Recruit_Status, Total_Flight_Risk, Total_Backfill, Create_Date, Last_Update, Data_As_Of_Date) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)",
+	} {
+		if got := insertCompanyQuery(dbType); got != want {
+			t.Errorf("%s insert query: got %q want %q", dbType, got, want)
+		}
+	}
+}
+
+func TestInsertRowsQuery(t *testing.T) {
+
+	columns := "INSERT INTO Company_Detail (Client_ID, Company_ID, Company_Name, ASIC, Flight_Risk_Status, Recruit_Status, Total_Flight_Risk, Total_Backfill, Create_Date, Last_Update, Data_As_Of_Date) VALUES "
+	for _, tc := range []struct {
+		dbType string
+		upsert bool
+		want   string
+	}{
+		{"postgres", false, columns + "($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11),($12,$13,$14,$15,$16,$17,$18,$19,$20,$21,$22)"},
+		{"mysql", true, columns + "(?,?,?,?,?,?,?,?,?,?,?),(?,?,?,?,?,?,?,?,?,?,?) ON DUPLICATE KEY UPDATE Client_ID=VALUES(Client_ID), Company_Name=VALUES(Company_Name), ASIC=VALUES(ASIC), Flight_Risk_Status=VALUES(Flight_Risk_Status), Recruit_Status=VALUES(Recruit_Status), Total_Flight_Risk=VALUES(Total_Flight_Risk), Total_Backfill=VALUES(Total_Backfill), Create_Date=VALUES(Create_Date), Last_Update=VALUES(Last_Update), Data_As_Of_Date=VALUES(Data_As_Of_Date)"},
+		{"sqlite", true, columns + "(?,?,?,?,?,?,?,?,?,?,?),(?,?,?,?,?,?,?,?,?,?,?) ON CONFLICT (Company_ID) DO UPDATE SET Client_ID=excluded.Client_ID, Company_Name=excluded.Company_Name, ASIC=excluded.ASIC, Flight_Risk_Status=excluded.Flight_Risk_Status, Recruit_Status=excluded.Recruit_Status, Total_Flight_Risk=excluded.Total_Flight_Risk, Total_Backfill=excluded.Total_Backfill, Create_Date=excluded.Create_Date, Last_Update=excluded.Last_Update, Data_As_Of_Date=excluded.Data_As_Of_Date"},
+	} {
+		if got := insertRowsQuery(tc.dbType, 2, tc.upsert); got != tc.want {
+			t.Errorf("%s insert rows query: got %q want %q", tc.dbType, got, tc.want)
+		}
+	}
+}
+
+func TestUpsertClientQuery(t *testing.T) {
+
+	insert := "INSERT INTO Company_Detail (Client_ID, Company_ID, Company_Name, ASIC, Flight_Risk_Status, Recruit_Status, Total_Flight_Risk, Total_Backfill, Create_Date, Last_Update, Data_As_Of_Date) VALUES "
+	for dbType, want := range map[string]string{
+		"mysql":    insert + "(?,?,?,?,?,?,?,?,?,?,?) ON DUPLICATE KEY UPDATE Company_Name=IF(Client_ID=VALUES(Client_ID), VALUES(Company_Name), Company_Name), ASIC=IF(Client_ID=VALUES(Client_ID), VALUES(ASIC), ASIC), Flight_Risk_Status=IF(Client_ID=VALUES(Client_ID), VALUES(Flight_Risk_Status), Flight_Risk_Status), Recruit_Status=IF(Client_ID=VALUES(Client_ID), VALUES(Recruit_Status), Recruit_Status), Total_Flight_Risk=IF(Client_ID=VALUES(Client_ID), VALUES(Total_Flight_Risk), Total_Flight_Risk), Total_Backfill=IF(Client_ID=VALUES(Client_ID), VALUES(Total_Backfill), Total_Backfill), Create_Date=IF(Client_ID=VALUES(Client_ID), VALUES(Create_Date), Create_Date), Last_Update=IF(Client_ID=VALUES(Client_ID), VALUES(Last_Update), Last_Update), Data_As_Of_Date=IF(Client_ID=VALUES(Client_ID), VALUES(Data_As_Of_Date), Data_As_Of_Date)",
+		"postgres": insert + "($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11) ON CONFLICT (Company_ID) DO UPDATE SET Client_ID=excluded.Client_ID, Company_Name=excluded.Company_Name, ASIC=excluded.ASIC, Flight_Risk_Status=excluded.Flight_Risk_Status, Recruit_Status=excluded.Recruit_Status, Total_Flight_Risk=excluded.Total_Flight_Risk, Total_Backfill=excluded.Total_Backfill, Create_Date=excluded.Create_Date, Last_Update=excluded.Last_Update, Data_As_Of_Date=excluded.Data_As_Of_Date WHERE Company_Detail.Client_ID = excluded.Client_ID",
+	} {
+		if got := upsertClientQuery(dbType); got != want {
+			t.Errorf("%s upsert query: got %q want %q", dbType, got, want)
+		}
+	}
+
+	want := insert + "(?,?,?,?,?,?,?,?,?,?,?),(?,?,?,?,?,?,?,?,?,?,?) ON CONFLICT (Company_ID) DO UPDATE SET Client_ID=excluded.Client_ID, Company_Name=excluded.Company_Name, ASIC=excluded.ASIC, Flight_Risk_Status=excluded.Flight_Risk_Status, Recruit_Status=excluded.Recruit_Status, Total_Flight_Risk=excluded.Total_Flight_Risk, Total_Backfill=excluded.Total_Backfill, Create_Date=excluded.Create_Date, Last_Update=excluded.Last_Update, Data_As_Of_Date=excluded.Data_As_Of_Date WHERE Company_Detail.Client_ID = excluded.Client_ID"
+	if got := upsertClientRowsQuery("sqlite", 2); got != want {
+		t.Errorf("sqlite upsert rows query: got %q want %q", got, want)
+	}
+}
+
+func TestUpdateCompanyQuery(t *testing.T) {
+
+	for dbType, want := range map[string]string{
+		"mysql":    "UPDATE Company_Detail SET Client_ID=?, Company_ID=?, Company_Name=?, ASIC=?, Flight_Risk_Status=?, Recruit_Status=?, Total_Flight_Risk=?, Total_Backfill=?, Create_Date=?, Last_Update=?, Data_As_Of_Date=? WHERE Company_ID=?",
+		"postgres": "UPDATE Company_Detail SET Client_ID=$1, Company_ID=$2, Company_Name=$3, ASIC=$4, Flight_Risk_Status=$5, Recruit_Status=$6, Total_Flight_Risk=$7, Total_Backfill=$8, Create_Date=$9, Last_Update=$10, Data_As_Of_Date=$11 WHERE Company_ID=$12",
+	} {
+		if got := updateCompanyQuery(dbType); got != want {
+			t.Errorf("%s update query: got %q want %q", dbType, got, want)
+		}
+	}
+}
+
+func TestCompanyArgs(t *testing.T) {
+
+	company := testCompany(2)
+
+	args := companyArgs(&company)
+	if len(args) != len(companyFields) {
+		t.Fatalf("got %d args want %d", len(args), len(companyFields))
+	}
+	if *args[2].(*string) != company.Company_Name || *args[10].(*NullDate) != company.Data_As_Of_Date {
+		t.Errorf("args do not follow the field mapping: %v", args)
+	}
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"gopkg.in/yaml.v3"
+)
+
+type (
+
+	// Config holds the app settings, resolved with the precedence
+	// defaults < config file < APP_* environment variables < CLI flags
+	Config struct {
+		DBType     string `json:"db_type" yaml:"db_type"`
+		DBHost     string `json:"db_host" yaml:"db_host"`
+		DBPort     string `json:"db_port" yaml:"db_port"`
+		DBUser     string `json:"db_user" yaml:"db_user"`
+		DBPassword string `json:"db_password" yaml:"db_password"`
+		DBName     string `json:"db_name" yaml:"db_name"`
+		SQLitePath string `json:"sqlite_path" yaml:"sqlite_path"`
+		Migrate    bool   `json:"migrate" yaml:"migrate"`
+		Listen     string `json:"listen" yaml:"listen"`
+		LogFile    string `json:"log_file" yaml:"log_file"`
+		LogPrefix  string `json:"log_prefix" yaml:"log_prefix"`
+
+		// CursorSecret signs the list cursors, a random key is used when empty
+		CursorSecret string `json:"cursor_secret" yaml:"cursor_secret"`
+
+		// IdempotencyTTL is how long the responses of Idempotency-Key requests are replayed
+		IdempotencyTTL string `json:"idempotency_ttl" yaml:"idempotency_ttl"`
+
+		// LegacySunset is the YYYY-MM-DD date the legacy routes are removed, sent
+		// in their Sunset header
+		LegacySunset string `json:"legacy_sunset" yaml:"legacy_sunset"`
+
+		// DBPasswordFile and DBCredentialsFile are read on startup and SIGHUP,
+		// see loadSecrets
+		DBPasswordFile    string `json:"db_password_file" yaml:"db_password_file"`
+		DBCredentialsFile string `json:"db_credentials_file" yaml:"db_credentials_file"`
+
+		// DBMaxIdleConns caps the idle DB connections, it is restored after a
+		// SIGHUP reload dropped the idle connections
+		DBMaxIdleConns int `json:"db_max_idle_conns" yaml:"db_max_idle_conns"`
+
+		// PrintConfig dumps the resolved config with secrets hidden instead of serving
+		PrintConfig bool `json:"-" yaml:"-"`
+	}
+
+	// setting binds a Config field to its CLI flag and environment variable
+	setting struct {
+		flag   string
+		env    string
+		usage  string
+		secret bool
+		isBool bool
+		get    func(c *Config) string
+		set    func(c *Config, value string) error
+	}
+
+	// flagValue records a flag value to be applied after the config file and
+	// environment, boolean settings accept a bare -flag
+	flagValue struct {
+		values map[string]string
+		name   string
+		isBool bool
+	}
+)
+
+func (f flagValue) String() string { return "" }
+
+func (f flagValue) Set(value string) error {
+	f.values[f.name] = value
+	return nil
+}
+
+func (f flagValue) IsBoolFlag() bool { return f.isBool }
+
+// secretMask replaces secret values in --print-config
+const secretMask = "********"
+
+// defaultDBPorts are the ports of the DB types when no -db-port is configured
+var defaultDBPorts = map[string]string{
+	"mysql":    "3306",
+	"postgres": "5432",
+}
+
+// defaultConfig returns the settings used when nothing else is configured
+func defaultConfig() Config {
+
+	return Config{
+		DBType:     "mysql",
+		DBHost:     "localhost",
+		SQLitePath: "./restful_api.db",
+		Migrate:    true,
+		Listen:     ":7777",
+		LogFile:    "./restful_api.log",
+		LogPrefix:  "INFO: ",
+
+		DBMaxIdleConns: 2,
+		IdempotencyTTL: "24h",
+		LegacySunset:   "2027-10-17",
+	}
+}
+
+// stringSetting binds a string Config field
+func stringSetting(flag, env, usage string, field func(c *Config) *string) setting {
+
+	return setting{
+		flag:  flag,
+		env:   env,
+		usage: usage,
+		get:   func(c *Config) string { return *field(c) },
+		set: func(c *Config, value string) error {
+			*field(c) = value
+			return nil
+		},
+	}
+}
+
+// asSecret hides the setting value from --print-config and the flag usage
+func (s setting) asSecret() setting {
+	s.secret = true
+	return s
+}
+
+// settings lists every configurable Config field
+var settings = []setting{
+	stringSetting("db", "APP_DB_TYPE", "database type : mysql, postgres, sqlite or memory", func(c *Config) *string { return &c.DBType }),
+	stringSetting("db-host", "APP_DB_HOST", "database host", func(c *Config) *string { return &c.DBHost }),
+	stringSetting("db-port", "APP_DB_PORT", "database port, 3306 for mysql and 5432 for postgres when unset", func(c *Config) *string { return &c.DBPort }),
+	stringSetting("db-user", "APP_DB_USER", "database user", func(c *Config) *string { return &c.DBUser }),
+	stringSetting("db-password", "APP_DB_PASSWORD", "database password", func(c *Config) *string { return &c.DBPassword }).asSecret(),
+	stringSetting("db-password-file", "APP_DB_PASSWORD_FILE", "file holding the database password", func(c *Config) *string { return &c.DBPasswordFile }),
+	stringSetting("db-credentials-file", "APP_DB_CREDENTIALS_FILE", "JSON file holding the database username and password", func(c *Config) *string { return &c.DBCredentialsFile }),
+	stringSetting("db-name", "APP_DB_NAME", "database name", func(c *Config) *string { return &c.DBName }),
+	{
+		flag:  "db-max-idle-conns",
+		env:   "APP_DB_MAX_IDLE_CONNS",
+		usage: "maximum idle DB connections kept open",
+		get:   func(c *Config) string { return strconv.Itoa(c.DBMaxIdleConns) },
+		set: func(c *Config, value string) error {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid connection count %q", value)
+			}
+			c.DBMaxIdleConns = n
+			return nil
+		},
+	},
+	stringSetting("sqlite", "APP_SQLITE_PATH", "sqlite database file, or :memory:", func(c *Config) *string { return &c.SQLitePath }),
+	{
+		flag:   "migrate",
+		env:    "APP_MIGRATE",
+		usage:  "apply pending schema migrations at startup",
+		isBool: true,
+		get:    func(c *Config) string { return strconv.FormatBool(c.Migrate) },
+		set: func(c *Config, value string) (err error) {
+			c.Migrate, err = strconv.ParseBool(value)
+			return
+		},
+	},
+	stringSetting("listen", "APP_LISTEN", "HTTP listen address", func(c *Config) *string { return &c.Listen }),
+	stringSetting("log-file", "APP_LOG_FILE", "log file path, empty logs to stderr", func(c *Config) *string { return &c.LogFile }),
+	stringSetting("log-prefix", "APP_LOG_PREFIX", "prefix of every log line", func(c *Config) *string { return &c.LogPrefix }),
+	stringSetting("cursor-secret", "APP_CURSOR_SECRET", "key signing the list cursors, random when empty", func(c *Config) *string { return &c.CursorSecret }).asSecret(),
+	{
+		flag:  "idempotency-ttl",
+		env:   "APP_IDEMPOTENCY_TTL",
+		usage: "how long Idempotency-Key responses are replayed",
+		get:   func(c *Config) string { return c.IdempotencyTTL },
+		set: func(c *Config, value string) error {
+			if ttl, err := time.ParseDuration(value); err != nil || ttl <= 0 {
+				return fmt.Errorf("invalid duration %q", value)
+			}
+			c.IdempotencyTTL = value
+			return nil
+		},
+	},
+	{
+		flag:  "legacy-sunset",
+		env:   "APP_LEGACY_SUNSET",
+		usage: "YYYY-MM-DD date the legacy routes are removed, sent in their Sunset header",
+		get:   func(c *Config) string { return c.LegacySunset },
+		set: func(c *Config, value string) error {
+			if _, err := time.Parse(dateLayout, value); err != nil {
+				return fmt.Errorf("invalid date %q, must be YYYY-MM-DD", value)
+			}
+			c.LegacySunset = value
+			return nil
+		},
+	},
+}
+
+// loadConfig resolves the Config from the CLI args, the environment and the
+// config file given by -config or APP_CONFIG, returning the remaining args
+func loadConfig(args []string, getenv func(string) string) (cfg Config, rest []string, err error) {
+
+	cfg = defaultConfig()
+
+	// collect the flags, they are applied last to take precedence
+	flags := flag.NewFlagSet("golang-rest-api-demo", flag.ContinueOnError)
+	configFile := flags.String("config", getenv("APP_CONFIG"), "YAML or JSON config file")
+	flags.BoolVar(&cfg.PrintConfig, "print-config", false, "print the resolved config with secrets hidden and exit")
+
+	flagValues := make(map[string]string)
+	for _, s := range settings {
+		flags.Var(
+			flagValue{values: flagValues, name: s.flag, isBool: s.isBool},
+			s.flag,
+			s.usage+" (env "+s.env+", default "+defaultValue(s)+")",
+		)
+	}
+	if err = flags.Parse(args); err != nil {
+		return
+	}
+
+	// config file overrides defaults
+	if *configFile != "" {
+		if err = readConfigFile(*configFile, &cfg); err != nil {
+			return
+		}
+	}
+
+	// environment overrides the config file, flags override everything
+	for _, s := range settings {
+		if value := getenv(s.env); value != "" {
+			if err = s.set(&cfg, value); err != nil {
+				return cfg, nil, fmt.Errorf("%s: %w", s.env, err)
+			}
+		}
+		if value, ok := flagValues[s.flag]; ok {
+			if err = s.set(&cfg, value); err != nil {
+				return cfg, nil, fmt.Errorf("-%s: %w", s.flag, err)
+			}
+		}
+	}
+
+	// the default port follows the resolved DB type
+	if cfg.DBPort == "" {
+		cfg.DBPort = defaultDBPorts[cfg.DBType]
+	}
+
+	return cfg, flags.Args(), nil
+}
+
+// defaultValue returns the default of a setting for the flag usage, hiding secrets
+func defaultValue(s setting) string {
+
+	cfg := defaultConfig()
+	if s.secret {
+		return secretMask
+	}
+	return strconv.Quote(s.get(&cfg))
+}
+
+// readConfigFile decodes a YAML or JSON config file over cfg, rejecting unknown
+// keys and the values the env vars and flags would reject
+func readConfigFile(path string, cfg *Config) error {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(file)
+		decoder.KnownFields(true)
+		err = decoder.Decode(cfg)
+	case ".json":
+		decoder := json.NewDecoder(file)
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(cfg)
+	default:
+		return fmt.Errorf("config file %s: unsupported format, expected .yaml, .yml or .json", path)
+	}
+
+	// an empty file keeps the defaults
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	// the file values go through the validation of the env vars and flags
+	for _, s := range settings {
+		if err = s.set(cfg, s.get(cfg)); err != nil {
+			return fmt.Errorf("config file %s: %s: %w", path, s.flag, err)
+		}
+	}
+	return nil
+}
+
+// checkDB reports the connection settings missing for the DB type, once the
+// secrets are loaded. The user and database name have no default so nothing
+// connects to a database that was not configured
+func (c Config) checkDB() error {
+
+	if c.DBType != "mysql" && c.DBType != "postgres" {
+		return nil
+	}
+
+	var missing []string
+	for _, s := range settings {
+		switch s.flag {
+		case "db-host", "db-port", "db-user", "db-name":
+			if s.get(&c) == "" {
+				missing = append(missing, "-"+s.flag+" ("+s.env+")")
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("the %s DB is not configured, set %s by flag, env or config file", c.DBType, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// connectionString builds the driver connection string for the configured DB type
+func (c Config) connectionString() string {
+
+	switch c.DBType {
+	case "postgres":
+		return fmt.Sprintf(
+			"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+			pqQuote(c.DBHost), pqQuote(c.DBPort), pqQuote(c.DBUser), pqQuote(c.DBPassword), pqQuote(c.DBName),
+		)
+	case "sqlite":
+		return c.SQLitePath
+	}
+
+	mysqlConfig := mysql.NewConfig()
+	mysqlConfig.User = c.DBUser
+	mysqlConfig.Passwd = c.DBPassword
+	mysqlConfig.Net = "tcp"
+	mysqlConfig.Addr = net.JoinHostPort(c.DBHost, c.DBPort)
+	mysqlConfig.DBName = c.DBName
+	mysqlConfig.ParseTime = true
+	return mysqlConfig.FormatDSN()
+}
+
+// pqQuote quotes a Postgres connection string value when it is empty or holds
+// spaces, quotes or backslashes
+func pqQuote(value string) string {
+
+	if value != "" && !strings.ContainsAny(value, ` '\`) {
+		return value
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+// print writes the config as JSON with every secret setting masked
+func (c Config) print(w io.Writer) error {
+
+	for _, s := range settings {
+		if s.secret && s.get(&c) != "" {
+			s.set(&c, secretMask)
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(c)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testEnv returns a getenv func reading from env
+func testEnv(env map[string]string) func(string) string {
+	return func(key string) string { return env[key] }
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.yaml")
+	err := os.WriteFile(configFile, []byte("db_type: postgres\ndb_host: file-host\ndb_port: \"5432\"\nlisten: \":8000\"\nmigrate: false\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, args, err := loadConfig(
+		[]string{"-config", configFile, "-listen", ":9000", "migrate", "up"},
+		testEnv(map[string]string{"APP_DB_HOST": "env-host", "APP_LISTEN": ":8500"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, tc := range map[string]struct{ got, want string }{
+		"default": {cfg.LogPrefix, "INFO: "},
+		"file":    {cfg.DBType, "postgres"},
+		"env":     {cfg.DBHost, "env-host"},
+		"flag":    {cfg.Listen, ":9000"},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s setting: got %q want %q", name, tc.got, tc.want)
+		}
+	}
+	if cfg.Migrate {
+		t.Errorf("migrate from config file not applied")
+	}
+	if len(args) != 2 || args[0] != "migrate" || args[1] != "up" {
+		t.Errorf("unexpected remaining args %v", args)
+	}
+	if want := "host=env-host port=5432 user='' password='' dbname='' sslmode=disable"; cfg.connectionString() != want {
+		t.Errorf("connection string: got %q want %q", cfg.connectionString(), want)
+	}
+}
+
+func TestLoadConfigFileFormats(t *testing.T) {
+
+	dir := t.TempDir()
+
+	for name, tc := range map[string]struct {
+		content string
+		valid   bool
+	}{
+		"config.json":    {`{"db_type": "sqlite", "sqlite_path": ":memory:"}`, true},
+		"config.yml":     {"db_type: sqlite\nsqlite_path: \":memory:\"\n", true},
+		"unknown.json":   {`{"db_kind": "sqlite"}`, false},
+		"unknown.yaml":   {"db_kind: sqlite\n", false},
+		"config.toml":    {`db_type = "sqlite"`, false},
+		"malformed.json": {`{"db_type": `, false},
+		"ttl.yaml":       {"idempotency_ttl: -1h\n", false},
+		"ttl.json":       {`{"idempotency_ttl": "0s"}`, false},
+		"sunset.yml":     {"legacy_sunset: soon\n", false},
+		"idle.json":      {`{"db_max_idle_conns": -1}`, false},
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(tc.content), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		cfg, _, err := loadConfig(nil, testEnv(map[string]string{"APP_CONFIG": path}))
+		if !tc.valid {
+			if err == nil {
+				t.Errorf("%s: invalid config file accepted", name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if cfg.DBType != "sqlite" || cfg.connectionString() != ":memory:" {
+			t.Errorf("%s: config not applied: %+v", name, cfg)
+		}
+	}
+}
+
+func TestLoadConfigInvalidBool(t *testing.T) {
+
+	if _, _, err := loadConfig(nil, testEnv(map[string]string{"APP_MIGRATE": "sometimes"})); err == nil {
+		t.Errorf("invalid APP_MIGRATE accepted")
+	}
+	if cfg, _, err := loadConfig([]string{"-migrate=false"}, testEnv(nil)); err != nil || cfg.Migrate {
+		t.Errorf("-migrate=false not applied: %+v, %v", cfg, err)
+	}
+}
+
+func TestLoadConfigIdempotencyTTL(t *testing.T) {
+
+	for _, value := range []string{"tomorrow", "0s", "-1h"} {
+		if _, _, err := loadConfig(nil, testEnv(map[string]string{"APP_IDEMPOTENCY_TTL": value})); err == nil {
+			t.Errorf("invalid APP_IDEMPOTENCY_TTL %q accepted", value)
+		}
+	}
+	if cfg, _, err := loadConfig([]string{"-idempotency-ttl=90m"}, testEnv(nil)); err != nil || cfg.IdempotencyTTL != "90m" {
+		t.Errorf("-idempotency-ttl=90m not applied: %+v, %v", cfg, err)
+	}
+}
+
+func TestLoadConfigLegacySunset(t *testing.T) {
+
+	for _, value := range []string{"soon", "2027-13-01", "2027-10-17T00:00:00Z"} {
+		if _, _, err := loadConfig(nil, testEnv(map[string]string{"APP_LEGACY_SUNSET": value})); err == nil {
+			t.Errorf("invalid APP_LEGACY_SUNSET %q accepted", value)
+		}
+	}
+	if cfg, _, err := loadConfig([]string{"-legacy-sunset=2028-01-31"}, testEnv(nil)); err != nil || cfg.LegacySunset != "2028-01-31" {
+		t.Errorf("-legacy-sunset=2028-01-31 not applied: %+v, %v", cfg, err)
+	}
+}
+
+func TestPrintConfigHidesSecrets(t *testing.T) {
+
+	cfg, _, err := loadConfig([]string{"-print-config", "-db-password", "s3cr3t"}, testEnv(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.PrintConfig {
+		t.Errorf("-print-config not set")
+	}
+
+	var out bytes.Buffer
+	if err = cfg.print(&out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "s3cr3t") || !strings.Contains(out.String(), secretMask) {
+		t.Errorf("password not hidden: %s", out.String())
+	}
+
+	// printing must not alter the config itself
+	if cfg.DBPassword != "s3cr3t" {
+		t.Errorf("print changed the password to %q", cfg.DBPassword)
+	}
+}
+
+func TestConnectionString(t *testing.T) {
+
+	cfg := defaultConfig()
+	cfg.DBPort, cfg.DBUser, cfg.DBPassword, cfg.DBName = "3306", "admin", `p@ss w'rd`, "Happy1"
+
+	if want := "admin:p@ss w'rd@tcp(localhost:3306)/Happy1?parseTime=true"; cfg.connectionString() != want {
+		t.Errorf("mysql connection string: got %q want %q", cfg.connectionString(), want)
+	}
+
+	cfg.DBType, cfg.DBPort = "postgres", "5432"
+	if want := `host=localhost port=5432 user=admin password='p@ss w\'rd' dbname=Happy1 sslmode=disable`; cfg.connectionString() != want {
+		t.Errorf("postgres connection string: got %q want %q", cfg.connectionString(), want)
+	}
+}
+
+func TestDefaultDBPort(t *testing.T) {
+
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{nil, "3306"},
+		{[]string{"-db", "postgres"}, "5432"},
+		{[]string{"-db", "postgres", "-db-port", "6432"}, "6432"},
+		{[]string{"-db", "sqlite"}, ""},
+	} {
+		cfg, _, err := loadConfig(tc.args, testEnv(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.DBPort != tc.want {
+			t.Errorf("%v: got port %q want %q", tc.args, cfg.DBPort, tc.want)
+		}
+	}
+}
+
+func TestCheckDB(t *testing.T) {
+
+	// nothing connects to a DB that was not configured
+	cfg := defaultConfig()
+	err := cfg.checkDB()
+	if err == nil || !strings.Contains(err.Error(), "-db-user (APP_DB_USER), -db-name (APP_DB_NAME)") {
+		t.Errorf("default config got %v", err)
+	}
+
+	cfg.DBPort, cfg.DBUser, cfg.DBName = "3306", "svc", "companies"
+	if err = cfg.checkDB(); err != nil {
+		t.Errorf("configured DB got %v", err)
+	}
+
+	for _, dbType := range []string{"sqlite", "memory"} {
+		cfg = defaultConfig()
+		cfg.DBType = dbType
+		if err = cfg.checkDB(); err != nil {
+			t.Errorf("%s got %v", dbType, err)
+		}
+	}
+}
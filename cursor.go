@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// listCursor is the position next to the first or last company of a page, it
+// holds the sort spec and the values of its sort columns
+type listCursor struct {
+	Sort   string            `json:"sort"`
+	Prev   bool              `json:"prev,omitempty"`
+	Values []json.RawMessage `json:"values"`
+}
+
+// errInvalidCursor is returned for tampered cursors, or cursors that were not
+// issued for the sort
+var errInvalidCursor = errors.New("invalid cursor")
+
+// newCursorKey returns a random cursor signing key, cursors signed with it do
+// not survive a restart
+func newCursorKey() ([]byte, error) {
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// encodeCursor returns the signed cursor of the page after the company, or
+// before it when prev is set
+func encodeCursor(secret []byte, keys []SortKey, company Company, prev bool) (string, error) {
+
+	// the values are the sort values, NULL text included, and the times keep
+	// their fraction of a second so the next page starts right after them
+	cursor := listCursor{Sort: sortString(keys), Prev: prev}
+	for _, key := range keys {
+		value := sortValue(key, &company)
+		if t, ok := value.(time.Time); ok {
+			value = t.Format(time.RFC3339Nano)
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		cursor.Values = append(cursor.Values, data)
+	}
+
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + signCursor(secret, payload), nil
+}
+
+// decodeCursor verifies a cursor and returns the sort column values it holds,
+// in a Company, and whether it points to the previous page. The cursor must
+// have been issued for the same sort keys
+func decodeCursor(secret []byte, keys []SortKey, value string) (*Company, bool, error) {
+
+	payload, signature, ok := strings.Cut(value, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(signCursor(secret, payload))) {
+		return nil, false, errInvalidCursor
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, false, errInvalidCursor
+	}
+
+	var cursor listCursor
+	if err = json.Unmarshal(data, &cursor); err != nil || cursor.Sort != sortString(keys) || len(cursor.Values) != len(keys) {
+		return nil, false, errInvalidCursor
+	}
+
+	var company Company
+	for i, key := range keys {
+		dest := fieldByColumn(key.Column).addr(&company)
+		if _, ok := dest.(*string); ok && string(cursor.Values[i]) == "null" {
+			company.nullText |= nullTextBit(key.Column)
+			continue
+		}
+		if err = json.Unmarshal(cursor.Values[i], dest); err != nil {
+			return nil, false, errInvalidCursor
+		}
+	}
+	return &company, cursor.Prev, nil
+}
+
+// signCursor returns the HMAC-SHA256 signature of a cursor payload
+func signCursor(secret []byte, payload string) string {
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListCursor(t *testing.T) {
+
+	secret := []byte("secret")
+	keys, _ := parseSort("-Data_As_Of_Date,Total_Backfill")
+	company := testCompany(3)
+	company.Total_Backfill = NullInt{}
+
+	cursor, err := encodeCursor(secret, keys, company, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after, prev, err := decodeCursor(secret, keys, cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Company{Company_ID: 3, Data_As_Of_Date: company.Data_As_Of_Date}
+	if *after != want || !prev {
+		t.Errorf("got %+v, prev %v want %+v, prev true", *after, prev, want)
+	}
+
+	// a cursor only resumes the sort it was issued for, signed with the key
+	other, _ := parseSort("Data_As_Of_Date,Total_Backfill")
+	payload, signature, _ := strings.Cut(cursor, ".")
+	forged, _ := encodeCursor([]byte("other"), keys, company, true)
+	for name, test := range map[string]struct {
+		keys   []SortKey
+		cursor string
+	}{
+		"other sort":  {other, cursor},
+		"other key":   {keys, forged},
+		"tampered":    {keys, payload + "x." + signature},
+		"unsigned":    {keys, payload},
+		"not base64":  {keys, "!." + signCursor(secret, "!")},
+		"not a value": {keys, "e30." + signCursor(secret, "e30")},
+	} {
+		if _, _, err = decodeCursor(secret, test.keys, test.cursor); err != errInvalidCursor {
+			t.Errorf("%s: got %v want %v", name, err, errInvalidCursor)
+		}
+	}
+}
+
+func TestReturnAllCompany_DetailPages(t *testing.T) {
+
+	for _, dbType := range testDBTypes() {
+
+		app := initTestModule(t, dbType)
+
+		seed := make([]Company, 5)
+		for i := range seed {
+			seed[i] = testCompany(i + 1)
+		}
+		if err := app.Store.CreateBatch(context.Background(), seed); err != nil {
+			t.Fatal(err)
+		}
+
+		// get fetches a page and returns it with its Link header
+		get := func(query string) (companyPage, string) {
+			req := httptest.NewRequest("GET", "/Company_Detail?"+query, nil)
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(app.returnAllCompany_Detail).ServeHTTP(rr, req)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("%s %s: got status %d want %d", dbType, query, rr.Code, http.StatusOK)
+			}
+
+			var page companyPage
+			if err := json.NewDecoder(rr.Body).Decode(&page); err != nil {
+				t.Fatal(err)
+			}
+			return page, rr.Header().Get("Link")
+		}
+
+		// ids returns the Company_IDs of a page
+		ids := func(page companyPage) (got []int) {
+			for _, company := range page.Items {
+				got = append(got, company.Company_ID)
+			}
+			return
+		}
+
+		first, link := get("sort=-Company_ID&limit=2&total=true")
+		if !reflect.DeepEqual(ids(first), []int{5, 4}) || !first.HasMore || first.PrevCursor != "" || first.Total == nil || *first.Total != 5 {
+			t.Errorf("%s: unexpected first page %+v", dbType, first)
+		}
+		wantLink := `</Company_Detail?cursor=` + url.QueryEscape(first.NextCursor) + `&limit=2&sort=-Company_ID&total=true>; rel="next"`
+		if link != wantLink {
+			t.Errorf("%s: got Link %s want %s", dbType, link, wantLink)
+		}
+
+		second, link := get("sort=-Company_ID&limit=2&cursor=" + first.NextCursor)
+		if !reflect.DeepEqual(ids(second), []int{3, 2}) || !second.HasMore || second.PrevCursor == "" || second.Total != nil {
+			t.Errorf("%s: unexpected second page %+v", dbType, second)
+		}
+		if !strings.Contains(link, `rel="next"`) || !strings.Contains(link, `rel="prev"`) {
+			t.Errorf("%s: second page Link %s lacks next or prev", dbType, link)
+		}
+
+		last, _ := get("sort=-Company_ID&limit=2&cursor=" + second.NextCursor)
+		if !reflect.DeepEqual(ids(last), []int{1}) || last.HasMore || last.NextCursor != "" || last.PrevCursor == "" {
+			t.Errorf("%s: unexpected last page %+v", dbType, last)
+		}
+
+		// walking back returns the same pages
+		back, _ := get("sort=-Company_ID&limit=2&cursor=" + last.PrevCursor)
+		if !reflect.DeepEqual(ids(back), []int{3, 2}) || !back.HasMore || back.PrevCursor == "" {
+			t.Errorf("%s: unexpected page before the last %+v", dbType, back)
+		}
+		back, _ = get("sort=-Company_ID&limit=2&cursor=" + back.PrevCursor)
+		if !reflect.DeepEqual(ids(back), []int{5, 4}) || !back.HasMore || back.PrevCursor != "" {
+			t.Errorf("%s: unexpected first page walking back %+v", dbType, back)
+		}
+
+		// the legacy id param still pages by Company_ID
+		legacy, _ := get("id=3&limit=5")
+		if !reflect.DeepEqual(ids(legacy), []int{4, 5}) || legacy.HasMore || legacy.PrevCursor == "" {
+			t.Errorf("%s: unexpected legacy page %+v", dbType, legacy)
+		}
+
+		// an empty list is still an array
+		empty, _ := get("Client_ID=1")
+		if empty.Items == nil || len(empty.Items) != 0 || empty.HasMore {
+			t.Errorf("%s: unexpected empty page %+v", dbType, empty)
+		}
+	}
+}
+
+func TestListCursorBoundaries(t *testing.T) {
+
+	for _, dbType := range testDBTypes() {
+
+		app := initTestModule(t, dbType)
+
+		// the updates are half a second apart, the first companies have no
+		// Flight_Risk_Status, stored as NULL by the SQL stores but company 5
+		updated := time.Date(2021, 2, 25, 10, 30, 0, 0, time.UTC)
+		seed := make([]Company, 5)
+		for i := range seed {
+			seed[i] = testCompany(i + 1)
+			seed[i].Last_Update = newNullTime(updated.Add(time.Duration(i) * 500 * time.Millisecond))
+			seed[i].Flight_Risk_Status = ""
+		}
+		seed[3].Flight_Risk_Status = "High"
+		if err := app.Store.CreateBatch(context.Background(), seed); err != nil {
+			t.Fatal(err)
+		}
+		if app.Database != nil {
+			if _, err := app.Database.Exec("UPDATE Company_Detail SET Flight_Risk_Status = NULL WHERE Company_ID <= 3"); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// walk follows the next cursors from the first page, one company a page
+		walk := func(sort string) (got []int) {
+			query := "sort=" + sort + "&limit=1"
+			for len(got) <= len(seed) {
+				rr := httptest.NewRecorder()
+				app.Router.ServeHTTP(rr, httptest.NewRequest("GET", "/Company_Detail?"+query, nil))
+				var page companyPage
+				if err := json.NewDecoder(rr.Body).Decode(&page); err != nil || rr.Code != http.StatusOK {
+					t.Fatalf("%s %s: got %d, %v", dbType, query, rr.Code, err)
+				}
+				for _, company := range page.Items {
+					got = append(got, company.Company_ID)
+				}
+				if !page.HasMore {
+					return
+				}
+				query = "sort=" + sort + "&limit=1&cursor=" + url.QueryEscape(page.NextCursor)
+			}
+			return
+		}
+
+		for sort, want := range map[string][]int{
+			"Last_Update":        {1, 2, 3, 4, 5},
+			"-Last_Update":       {5, 4, 3, 2, 1},
+			"Flight_Risk_Status": {1, 2, 3, 5, 4},
+		} {
+			if got := walk(sort); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: sort=%s got pages %v want %v", dbType, sort, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// errPreconditionFailed aborts a write whose If-Match does not hold
+var errPreconditionFailed = errors.New("company was modified, its ETag does not match If-Match")
+
+// companyETag returns the strong ETag of the full Company representation
+func companyETag(company Company) string {
+	return viewETag(companyView{company: company})
+}
+
+// writeStoredCompany answers the Company as stored after a write, with its
+// ETag. The DB truncates dates and timestamps, so the written payload may not
+// hash to the ETag the next GET returns
+func (app *App) writeStoredCompany(w http.ResponseWriter, r *http.Request, status, companyID int) {
+
+	stored, err := app.Store.Get(r.Context(), companyID)
+	if err != nil {
+		app.writeStoreError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", companyETag(stored))
+	app.writeJSON(w, status, stored)
+}
+
+// viewETag returns the strong ETag of a Company representation, hashing its
+// JSON with the timestamps in UTC so every store reads back the same tag
+func viewETag(view companyView) string {
+
+	for _, date := range []*NullTime{&view.company.Create_Date, &view.company.Last_Update} {
+		date.Time = date.Time.UTC()
+	}
+
+	data, err := json.Marshal(view)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+// formatETag returns the ETag of a Company representation in a response format,
+// the exports are tagged apart from the JSON representation
+func formatETag(etag, format string) string {
+
+	if format == formatJSON || etag == "" {
+		return etag
+	}
+	return strings.TrimSuffix(etag, `"`) + "-" + format + `"`
+}
+
+// parseETags splits an If-Match or If-None-Match header into its entity tags,
+// keeping the W/ prefix of weak tags
+func parseETags(header string) (tags []string) {
+
+	for header = strings.TrimSpace(header); header != ""; header = strings.TrimLeft(header, " \t,") {
+
+		if header[0] == '*' {
+			tags = append(tags, "*")
+			header = header[1:]
+			continue
+		}
+
+		weak := strings.HasPrefix(header, "W/")
+		rest := strings.TrimPrefix(header, "W/")
+		if !strings.HasPrefix(rest, `"`) {
+			return tags
+		}
+		end := strings.IndexByte(rest[1:], '"')
+		if end < 0 {
+			return tags
+		}
+
+		tag := rest[:end+2]
+		if weak {
+			tag = "W/" + tag
+		}
+		tags = append(tags, tag)
+		header = rest[end+2:]
+	}
+	return tags
+}
+
+// etagMatch reports whether the header lists the ETag, weak tags only match
+// with the weak comparison used by If-None-Match
+func etagMatch(header, etag string, weak bool) bool {
+
+	for _, tag := range parseETags(header) {
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatch returns the Precondition enforcing the If-Match header of r, none
+// when the header is absent
+func ifMatch(r *http.Request) []Precondition {
+
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return nil
+	}
+
+	return []Precondition{func(current Company) error {
+		if !etagMatch(header, companyETag(current), false) {
+			return errPreconditionFailed
+		}
+		return nil
+	}}
+}
+
+// notModified answers 304 when the If-None-Match header of r lists the ETag
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+
+	header := r.Header.Get("If-None-Match")
+	if header == "" || !etagMatch(header, etag, true) {
+		return false
+	}
+
+	w.Header().Set("ETag", etag)
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
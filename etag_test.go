@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestParseETags(t *testing.T) {
+
+	got := parseETags(` "a", W/"b" ,*, "c,d"`)
+	want := []string{`"a"`, `W/"b"`, `*`, `"c,d"`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q want %q", got, want)
+	}
+
+	if etagMatch(`W/"a"`, `"a"`, false) || !etagMatch(`W/"a"`, `"a"`, true) {
+		t.Errorf("weak tags must only match with the weak comparison")
+	}
+}
+
+func TestPreconditionAbortsWrite(t *testing.T) {
+
+	for _, dbType := range testDBTypes() {
+
+		ctx := context.Background()
+		app := initTestModule(t, dbType)
+
+		company := testCompany(1)
+		if err := app.Store.Create(ctx, &company); err != nil {
+			t.Fatal(err)
+		}
+
+		failing := func(current Company) error {
+			if current.Company_ID != 1 {
+				t.Errorf("%s: precondition got company %d", dbType, current.Company_ID)
+			}
+			return errPreconditionFailed
+		}
+
+		changed := testCompany(1)
+		changed.ASIC = "changed"
+		if err := app.Store.Update(ctx, 1, &changed, failing); err != errPreconditionFailed {
+			t.Errorf("%s: update got %v want %v", dbType, err, errPreconditionFailed)
+		}
+		if err := app.Store.UpdateColumns(ctx, 1, &changed, []string{"ASIC"}, failing); err != errPreconditionFailed {
+			t.Errorf("%s: update columns got %v want %v", dbType, err, errPreconditionFailed)
+		}
+		if err := app.Store.Delete(ctx, 1, failing); err != errPreconditionFailed {
+			t.Errorf("%s: delete got %v want %v", dbType, err, errPreconditionFailed)
+		}
+		if err := app.Store.Delete(ctx, 2, failing); err != ErrCompanyNotFound {
+			t.Errorf("%s: delete unknown got %v want %v", dbType, err, ErrCompanyNotFound)
+		}
+
+		stored, err := app.Store.Get(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameCompany(stored, company) {
+			t.Errorf("%s: failed preconditions changed the company to %+v", dbType, stored)
+		}
+	}
+}
+
+func TestConditionalRequests(t *testing.T) {
+
+	for _, dbType := range testDBTypes() {
+
+		app := initTestModule(t, dbType)
+
+		// serve calls a handler with the path var and headers, in name/value pairs
+		serve := func(handler http.HandlerFunc, method, varName, body string, headers ...string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, "/Company_Detail/1", strings.NewReader(body))
+			req = mux.SetURLVars(req, map[string]string{varName: "1"})
+			for i := 0; i < len(headers); i += 2 {
+				req.Header.Set(headers[i], headers[i+1])
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			return rr
+		}
+
+		payload, _ := json.Marshal(testCompany(1))
+		rr := serve(app.createNewCompany, "POST", "Company_ID", string(payload))
+		created := rr.Header().Get("ETag")
+		if rr.Code != http.StatusOK || created == "" {
+			t.Fatalf("%s: create got status %d, ETag %q", dbType, rr.Code, created)
+		}
+
+		// the stored company carries the ETag returned on create
+		rr = serve(app.returnSingleCompany, "GET", "Company_ID", "")
+		if etag := rr.Header().Get("ETag"); etag != created {
+			t.Errorf("%s: GET ETag %s want %s", dbType, etag, created)
+		}
+
+		for _, ifNoneMatch := range []string{created, "W/" + created, `"other", ` + created, "*"} {
+			rr = serve(app.returnSingleCompany, "GET", "Company_ID", "", "If-None-Match", ifNoneMatch)
+			if rr.Code != http.StatusNotModified || rr.Body.Len() != 0 || rr.Header().Get("ETag") != created {
+				t.Errorf("%s: If-None-Match %s got status %d, body %q", dbType, ifNoneMatch, rr.Code, rr.Body)
+			}
+		}
+		rr = serve(app.returnSingleCompany, "GET", "Company_ID", "", "If-None-Match", `"other"`)
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: stale If-None-Match got status %d want %d", dbType, rr.Code, http.StatusOK)
+		}
+
+		// writes over another version fail
+		changed := testCompany(1)
+		changed.ASIC = "changed"
+		payload, _ = json.Marshal(changed)
+		for _, rr = range []*httptest.ResponseRecorder{
+			serve(app.updateCompany, "PUT", "Company_ID", string(payload), "If-Match", `"stale"`),
+			serve(app.updateCompany, "PUT", "Company_ID", string(payload), "If-Match", "W/"+created),
+			serve(app.patchCompany, "PATCH", "Company_ID", `{"ASIC": "x"}`, "Content-Type", mergePatchType, "If-Match", `"stale"`),
+			serve(app.deleteCompany, "DELETE", "Company_ID", "", "If-Match", `"stale"`),
+		} {
+			if rr.Code != http.StatusPreconditionFailed {
+				t.Errorf("%s: stale If-Match got status %d want %d", dbType, rr.Code, http.StatusPreconditionFailed)
+			}
+		}
+
+		// writes over the current version succeed and return the new version
+		rr = serve(app.updateCompany, "PUT", "Company_ID", string(payload), "If-Match", created)
+		updated := rr.Header().Get("ETag")
+		if rr.Code != http.StatusOK || updated == "" || updated == created {
+			t.Fatalf("%s: PUT got status %d, ETag %q", dbType, rr.Code, updated)
+		}
+
+		rr = serve(app.patchCompany, "PATCH", "Company_ID", `{"ASIC": "patched"}`, "Content-Type", mergePatchType, "If-Match", updated)
+		patched := rr.Header().Get("ETag")
+		if rr.Code != http.StatusOK || patched == "" || patched == updated {
+			t.Fatalf("%s: PATCH got status %d, ETag %q", dbType, rr.Code, patched)
+		}
+		if etag := serve(app.returnSingleCompany, "GET", "Company_ID", "").Header().Get("ETag"); etag != patched {
+			t.Errorf("%s: GET after PATCH ETag %s want %s", dbType, etag, patched)
+		}
+
+		rr = serve(app.deleteCompany, "DELETE", "Company_ID", "", "If-Match", patched)
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: DELETE got status %d want %d", dbType, rr.Code, http.StatusOK)
+		}
+		rr = serve(app.deleteCompany, "DELETE", "Company_ID", "", "If-Match", "*")
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("%s: DELETE of a deleted company got status %d want %d", dbType, rr.Code, http.StatusNotFound)
+		}
+	}
+}
+
+// truncatingStore stores the timestamps to the second and Data_As_Of_Date
+// without its time of day, the way the MySQL DATETIME and DATE columns do
+type truncatingStore struct {
+	CompanyStore
+}
+
+// truncated returns a copy of company with the times as a DB stores them
+func truncated(company *Company) *Company {
+
+	stored := *company
+	for _, date := range []*NullTime{&stored.Create_Date, &stored.Last_Update} {
+		date.Time = date.Time.Truncate(time.Second)
+	}
+	stored.Data_As_Of_Date.Time = stored.Data_As_Of_Date.Time.UTC().Truncate(24 * time.Hour)
+	return &stored
+}
+
+func (s truncatingStore) Create(ctx context.Context, company *Company) error {
+	return s.CompanyStore.Create(ctx, truncated(company))
+}
+
+func (s truncatingStore) Update(ctx context.Context, companyID int, company *Company, checks ...Precondition) error {
+	return s.CompanyStore.Update(ctx, companyID, truncated(company), checks...)
+}
+
+func (s truncatingStore) UpdateColumns(ctx context.Context, companyID int, company *Company, columns []string, checks ...Precondition) error {
+	return s.CompanyStore.UpdateColumns(ctx, companyID, truncated(company), columns, checks...)
+}
+
+func (s truncatingStore) Upsert(ctx context.Context, company *Company) (bool, error) {
+	return s.CompanyStore.Upsert(ctx, truncated(company))
+}
+
+func TestWriteETagsMatchStoredCompany(t *testing.T) {
+
+	for _, dbType := range testDBTypes() {
+
+		app := initTestModule(t, dbType)
+		app.Store = truncatingStore{app.Store}
+
+		serve := func(handler http.HandlerFunc, method, body string, headers ...string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, "/Company_Detail/1", strings.NewReader(body))
+			req = mux.SetURLVars(req, map[string]string{"Client_ID": "2399029309", "Company_ID": "1"})
+			for i := 0; i < len(headers); i += 2 {
+				req.Header.Set(headers[i], headers[i+1])
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			return rr
+		}
+
+		// times the DB does not keep as sent
+		company := testCompany(1)
+		company.Last_Update = newNullTime(time.Date(2021, 2, 25, 10, 30, 0, 500, time.FixedZone("", 2*60*60)))
+		company.Data_As_Of_Date = newNullDate(time.Date(2021, 2, 25, 13, 0, 0, 0, time.UTC))
+		payload, _ := json.Marshal(company)
+
+		// each write returns the ETag the next write is conditioned on
+		etag := serve(app.createNewCompany, "POST", string(payload)).Header().Get("ETag")
+		for _, write := range []struct {
+			handler http.HandlerFunc
+			method  string
+			body    string
+			headers []string
+		}{
+			{app.updateCompany, "PUT", string(payload), nil},
+			{app.patchCompany, "PATCH", `{"ASIC": "patched"}`, []string{"Content-Type", mergePatchType}},
+			{app.updateCompany, "PUT", string(payload), nil},
+		} {
+			rr := serve(write.handler, write.method, write.body, append(write.headers, "If-Match", etag)...)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("%s: %s with the ETag of the previous write got status %d: %s", dbType, write.method, rr.Code, rr.Body)
+			}
+			etag = rr.Header().Get("ETag")
+		}
+
+		rr := serve(app.upsertCompany, "PUT", string(payload))
+		if get := serve(app.returnSingleCompany, "GET", "").Header().Get("ETag"); rr.Header().Get("ETag") != get {
+			t.Errorf("%s: upsert ETag %s, GET ETag %s", dbType, rr.Header().Get("ETag"), get)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// response formats of the company reads, JSON is the default and the others
+// are exports of the company rows
+const (
+	formatJSON   = "json"
+	formatCSV    = "csv"
+	formatNDJSON = "ndjson"
+	formatXLSX   = "xlsx"
+)
+
+// exportFormats lists the response formats with their media type, in order of
+// preference
+var exportFormats = []struct {
+	name      string
+	mediaType string
+}{
+	{formatJSON, "application/json"},
+	{formatCSV, "text/csv"},
+	{formatNDJSON, "application/x-ndjson"},
+	{formatXLSX, xlsxType},
+}
+
+// errNotAcceptable is returned by negotiateFormat when the Accept header
+// accepts none of the formats
+var errNotAcceptable = errors.New("none of the accepted media types can be sent")
+
+// formatNames returns the names of the response formats
+func formatNames() []string {
+
+	names := make([]string, len(exportFormats))
+	for i, format := range exportFormats {
+		names[i] = format.name
+	}
+	return names
+}
+
+// formatMediaType returns the media type of a response format
+func formatMediaType(name string) string {
+
+	for _, format := range exportFormats {
+		if format.name == name {
+			return format.mediaType
+		}
+	}
+	return ""
+}
+
+// negotiateFormat returns the response format of the format query param, or
+// else the one the Accept header prefers
+func negotiateFormat(r *http.Request) (string, error) {
+
+	if name := r.URL.Query().Get("format"); name != "" {
+		if formatMediaType(name) == "" {
+			return "", fmt.Errorf("invalid format query param : %s, must be one of %s", name, strings.Join(formatNames(), ", "))
+		}
+		return name, nil
+	}
+
+	header := r.Header.Get("Accept")
+	if header == "" {
+		return formatJSON, nil
+	}
+
+	// every format takes the quality of its most specific media range, an exact
+	// media type wins over a wildcard of the same quality
+	best, bestQuality, bestSpecificity := "", 0.0, -1
+	for _, format := range exportFormats {
+
+		quality, specificity := 0.0, -1
+		for _, accepted := range strings.Split(header, ",") {
+
+			mediaRange, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+			if err != nil {
+				continue
+			}
+			rangeQuality := 1.0
+			if value, ok := params["q"]; ok {
+				if rangeQuality, err = strconv.ParseFloat(value, 64); err != nil {
+					continue
+				}
+			}
+			if rangeSpecificity := mediaRangeMatch(mediaRange, format.mediaType); rangeSpecificity > specificity {
+				quality, specificity = rangeQuality, rangeSpecificity
+			}
+		}
+
+		if quality > bestQuality || quality == bestQuality && quality > 0 && specificity > bestSpecificity {
+			best, bestQuality, bestSpecificity = format.name, quality, specificity
+		}
+	}
+
+	if best == "" {
+		return "", errNotAcceptable
+	}
+	return best, nil
+}
+
+// mediaRangeMatch returns how specific the media range matching the media type
+// is, 2 for the type itself, 1 for type/*, 0 for */* and -1 if it does not match
+func mediaRangeMatch(mediaRange, mediaType string) int {
+
+	switch {
+	case mediaRange == mediaType:
+		return 2
+	case mediaRange == "*/*":
+		return 0
+	case strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*")):
+		return 1
+	}
+	return -1
+}
+
+// writeFormatError answers a negotiateFormat error
+func (app *App) writeFormatError(w http.ResponseWriter, r *http.Request, err error) {
+
+	if err == errNotAcceptable {
+		app.writeProblem(w, r, http.StatusNotAcceptable, "Accept must include one of "+strings.Join(exportMediaTypes(), ", ")+", or set the format query param")
+		return
+	}
+	app.writeProblem(w, r, http.StatusBadRequest, err.Error())
+}
+
+// exportMediaTypes returns the media types of the response formats
+func exportMediaTypes() []string {
+
+	mediaTypes := make([]string, len(exportFormats))
+	for i, format := range exportFormats {
+		mediaTypes[i] = format.mediaType
+	}
+	return mediaTypes
+}
+
+// rowEncoder writes companies as the rows of an export format
+type rowEncoder interface {
+
+	// header writes the column names, before any row
+	header(names []string) error
+
+	// row writes the fields of a company
+	row(fields []companyField, company *Company) error
+
+	// close ends the export
+	close() error
+}
+
+// companyRows passes the companies of an export to row one at a time, until
+// row fails
+type companyRows func(row func(company Company) error) error
+
+// singleCompany returns the rows of a single company export
+func singleCompany(company Company) companyRows {
+
+	return func(row func(company Company) error) error {
+		return row(company)
+	}
+}
+
+// writeExport streams the companies of rows in an export format, a row each.
+// The columns are the sparse fieldset, named after the key names of the request
+func (app *App) writeExport(w http.ResponseWriter, r *http.Request, format string, columns []string, rows companyRows) {
+
+	fields := selectFields(columns)
+	names := make([]string, len(fields))
+	for i, field := range fields {
+		names[i] = renameKey(keyNames(r), field.column)
+	}
+
+	// the response starts with the first row, so errors before it still get
+	// their status
+	var (
+		encoder rowEncoder
+		started bool
+		count   int
+	)
+	start := func() (err error) {
+
+		started = true
+		w.Header().Set("Content-Type", formatMediaType(format))
+		if format == formatCSV || format == formatXLSX {
+			w.Header().Set("Content-Disposition", `attachment; filename="Company_Detail.`+format+`"`)
+		}
+		w.WriteHeader(http.StatusOK)
+
+		switch format {
+		case formatCSV:
+			encoder = csvEncoder{csv.NewWriter(w)}
+		case formatNDJSON:
+			encoder = ndjsonEncoder{w, keyNames(r)}
+		case formatXLSX:
+			if encoder, err = newXLSXEncoder(w); err != nil {
+				return err
+			}
+		}
+		return encoder.header(names)
+	}
+
+	err := rows(func(company Company) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		count++
+		return encoder.row(fields, &company)
+	})
+	if err == nil && !started {
+		err = start()
+	}
+	if err == nil {
+		err = encoder.close()
+	}
+	switch {
+	case err == nil:
+		app.logger.Printf("exported %d companies as %s\n", count, format)
+		return
+	case !started:
+		app.writeStoreError(w, r, err)
+		return
+	}
+
+	// the status is sent, abort the response so the client sees it is incomplete
+	app.logger.Printf("request %s : %s export aborted : %s", requestID(r), format, err)
+	panic(http.ErrAbortHandler)
+}
+
+// cellValue returns the value of a Company field as an int64, a string, a
+// time.Time, or nil for NULL
+func cellValue(field companyField, company *Company) interface{} {
+
+	switch value := field.addr(company).(type) {
+	case *int:
+		return int64(*value)
+	case *string:
+		return *value
+	case *NullInt:
+		if value.Valid {
+			return value.Int64
+		}
+	case *NullTime:
+		if value.Valid {
+			return value.Time
+		}
+	case *NullDate:
+		if value.Valid {
+			return cellDate{value.Time}
+		}
+	}
+	return nil
+}
+
+// cellDate is the cellValue of a date column, exported without a time of day
+type cellDate struct {
+	time.Time
+}
+
+// csvEncoder writes an RFC 4180 CSV export, NULL is an empty cell and the
+// dates are written as in JSON. Text that a spreadsheet would run as a formula
+// is prefixed with a quote
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func (e csvEncoder) header(names []string) error {
+	return e.w.Write(names)
+}
+
+func (e csvEncoder) row(fields []companyField, company *Company) error {
+
+	record := make([]string, len(fields))
+	for i, field := range fields {
+		record[i] = cellText(cellValue(field, company))
+	}
+	return e.w.Write(record)
+}
+
+func (e csvEncoder) close() error {
+
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// csvFormulaPrefixes are the first characters that make a spreadsheet read a
+// CSV cell as a formula
+const csvFormulaPrefixes = "=+-@\t\r"
+
+// cellText returns the CSV text of a cellValue
+func cellText(value interface{}) string {
+
+	switch value := value.(type) {
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case string:
+		if value != "" && strings.ContainsRune(csvFormulaPrefixes, rune(value[0])) {
+			return "'" + value
+		}
+		return value
+	case time.Time:
+		return value.Format(time.RFC3339)
+	case cellDate:
+		return value.Format(dateLayout)
+	}
+	return ""
+}
+
+// ndjsonEncoder writes a JSON object per line, keyed as the header names
+type ndjsonEncoder struct {
+	w     io.Writer
+	names map[string]string
+}
+
+func (e ndjsonEncoder) header(names []string) error {
+	return nil
+}
+
+func (e ndjsonEncoder) row(fields []companyField, company *Company) error {
+
+	var buf bytes.Buffer
+	if err := writeFieldsJSON(&buf, fields, company, e.names); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err := e.w.Write(buf.Bytes())
+	return err
+}
+
+func (e ndjsonEncoder) close() error {
+	return nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+
+	for _, tc := range []struct {
+		url    string
+		accept string
+		want   string
+		err    bool
+	}{
+		{"/Company_Detail", "", formatJSON, false},
+		{"/Company_Detail", "*/*", formatJSON, false},
+		{"/Company_Detail", "text/csv", formatCSV, false},
+		{"/Company_Detail", "text/*", formatCSV, false},
+		{"/Company_Detail", "application/x-ndjson, application/json;q=0.5", formatNDJSON, false},
+		{"/Company_Detail", "*/*;q=0.8, " + xlsxType, formatXLSX, false},
+		{"/Company_Detail", "application/*", formatJSON, false},
+		{"/Company_Detail", "text/csv;q=0, */*;q=0.1", formatJSON, false},
+		{"/Company_Detail", "image/png", "", true},
+		{"/Company_Detail?format=xlsx", "text/csv", formatXLSX, false},
+		{"/Company_Detail?format=pdf", "", "", true},
+	} {
+		req := httptest.NewRequest("GET", tc.url, nil)
+		if tc.accept != "" {
+			req.Header.Set("Accept", tc.accept)
+		}
+		got, err := negotiateFormat(req)
+		if got != tc.want || (err != nil) != tc.err {
+			t.Errorf("%s Accept %q: got %q, %v want %q", tc.url, tc.accept, got, err, tc.want)
+		}
+	}
+}
+
+func TestExports(t *testing.T) {
+
+	for _, dbType := range testDBTypes() {
+
+		app := initTestModule(t, dbType)
+
+		seed := []Company{testCompany(1), testCompany(2)}
+		seed[1].Company_Name = `Quoted, "Name"`
+		seed[1].Total_Backfill = NullInt{}
+		if err := app.Store.CreateBatch(context.Background(), seed); err != nil {
+			t.Fatal(err)
+		}
+
+		serve := func(url, accept string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("GET", url, nil)
+			if accept != "" {
+				req.Header.Set("Accept", accept)
+			}
+			rr := httptest.NewRecorder()
+			app.Router.ServeHTTP(rr, req)
+			return rr
+		}
+
+		// CSV list, NULL is an empty cell
+		rr := serve("/Company_Detail", "text/csv")
+		records, err := csv.NewReader(rr.Body).ReadAll()
+		if rr.Code != http.StatusOK || err != nil || len(records) != 3 {
+			t.Fatalf("%s: CSV list got %d %v %v", dbType, rr.Code, records, err)
+		}
+		if got := strings.Join(records[0], ", "); got != columnList(companyFields) {
+			t.Errorf("%s: got CSV header %s", dbType, got)
+		}
+		want := []string{"2399029309", "2", `Quoted, "Name"`, "1234", "High", "Open", "1234", "", "2021-02-25T00:00:00Z", "2021-02-25T10:30:00Z", "2021-02-25"}
+		if !reflect.DeepEqual(records[2], want) {
+			t.Errorf("%s: got CSV row %q want %q", dbType, records[2], want)
+		}
+		if rr.Header().Get("Content-Type") != "text/csv" || rr.Header().Get("Content-Disposition") != `attachment; filename="Company_Detail.csv"` {
+			t.Errorf("%s: got CSV headers %v", dbType, rr.Header())
+		}
+		if !strings.Contains(strings.Join(rr.Header().Values("Vary"), ","), "Accept") {
+			t.Errorf("%s: CSV list does not vary on Accept", dbType)
+		}
+
+		// NDJSON of a sparse fieldset, filtered
+		rr = serve("/Company_Detail?fields=Company_ID,Total_Backfill&Company_Name=quoted", "application/x-ndjson")
+		if want := `{"Company_ID":2,"Total_Backfill":null}` + "\n"; rr.Code != http.StatusOK || rr.Body.String() != want {
+			t.Errorf("%s: NDJSON list got %d %q want %q", dbType, rr.Code, rr.Body, want)
+		}
+
+		// the /v1 exports name their columns in snake_case
+		rr = serve("/v1/companies?format=csv&fields=company_id,company_name&sort=-company_id&limit=1", "")
+		if want := "company_id,company_name\n2,\"Quoted, \"\"Name\"\"\"\n"; rr.Code != http.StatusOK || rr.Body.String() != want {
+			t.Errorf("%s: v1 CSV list got %d %q want %q", dbType, rr.Code, rr.Body, want)
+		}
+		rr = serve("/v1/companies/1?format=ndjson&fields=company_id,asic", "")
+		if want := `{"company_id":1,"asic":"1234"}` + "\n"; rr.Code != http.StatusOK || rr.Body.String() != want {
+			t.Errorf("%s: v1 NDJSON company got %d %q want %q", dbType, rr.Code, rr.Body, want)
+		}
+
+		// an empty list still has its header
+		rr = serve("/Company_Detail?format=csv&fields=Company_ID&Client_ID=1", "")
+		if rr.Code != http.StatusOK || rr.Body.String() != "Company_ID\n" {
+			t.Errorf("%s: empty CSV list got %d %q", dbType, rr.Code, rr.Body)
+		}
+
+		// the exports of a company have their own ETag
+		jsonTag := serve("/Company_Detail/1", "").Header().Get("ETag")
+		rr = serve("/Company_Detail/1", xlsxType)
+		if tag := rr.Header().Get("ETag"); rr.Code != http.StatusOK || tag == "" || tag == jsonTag {
+			t.Errorf("%s: XLSX company got %d ETag %q, JSON %q", dbType, rr.Code, tag, jsonTag)
+		}
+
+		// the XLSX sheet holds typed cells, dates and timestamps are styled serials
+		archive, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+		if err != nil {
+			t.Fatalf("%s: invalid XLSX: %v", dbType, err)
+		}
+		parts := make(map[string]string)
+		for _, file := range archive.File {
+			reader, _ := file.Open()
+			content, _ := io.ReadAll(reader)
+			reader.Close()
+			parts[file.Name] = string(content)
+		}
+		for _, part := range xlsxParts {
+			if parts[part.name] != xmlHeader+part.content {
+				t.Errorf("%s: XLSX part %s got %q", dbType, part.name, parts[part.name])
+			}
+		}
+		sheet := parts[xlsxSheetPart]
+		for _, cell := range []string{
+			`<c r="A1" t="inlineStr"><is><t xml:space="preserve">Client_ID</t></is></c>`,
+			`<c r="B2"><v>1</v></c>`,
+			`<c r="C2" t="inlineStr"><is><t xml:space="preserve">TEST_GO</t></is></c>`,
+			`<c r="I2" s="2"><v>44252</v></c>`,
+			`<c r="J2" s="2"><v>44252.4375</v></c>`,
+		} {
+			if !strings.Contains(sheet, cell) {
+				t.Errorf("%s: XLSX sheet lacks %s: %s", dbType, cell, sheet)
+			}
+		}
+
+		// the exports are refused before anything is sent
+		if rr = serve("/Company_Detail", "image/png"); rr.Code != http.StatusNotAcceptable {
+			t.Errorf("%s: image/png got %d", dbType, rr.Code)
+		}
+		if rr = serve("/Company_Detail/3?format=csv", ""); rr.Code != http.StatusNotFound || rr.Header().Get("Content-Type") != "application/problem+json" {
+			t.Errorf("%s: missing company export got %d %s", dbType, rr.Code, rr.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestCSVFormulaCells(t *testing.T) {
+
+	// text a spreadsheet would run as a formula is quoted, the other cells are not
+	for value, want := range map[interface{}]string{
+		"=HYPERLINK(\"x\")": "'=HYPERLINK(\"x\")",
+		"+1":                "'+1",
+		"-1":                "'-1",
+		"@SUM(A1)":          "'@SUM(A1)",
+		"\tx":               "'\tx",
+		"\rx":               "'\rx",
+		"a=b":               "a=b",
+		"":                  "",
+		int64(-1):           "-1",
+	} {
+		if got := cellText(value); got != want {
+			t.Errorf("cellText(%q) got %q want %q", value, got, want)
+		}
+	}
+}
+
+func TestXLSXColumn(t *testing.T) {
+
+	for i, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		if got := xlsxColumn(i); got != want {
+			t.Errorf("column %d: got %s want %s", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// companyView is the JSON output of a Company limited to a sparse fieldset,
+// every field is written when columns is empty
+type companyView struct {
+	company Company
+	columns []string
+}
+
+// parseFields parses the comma separated fields query param, the fields are
+// returned in column order without duplicates
+func parseFields(value string) ([]string, error) {
+
+	if value == "" {
+		return nil, nil
+	}
+
+	requested := strings.Split(value, ",")
+	for _, column := range requested {
+		if !hasCompanyColumn(column) {
+			return nil, fmt.Errorf("invalid fields query param : %s, must be one of %s", column, columnList(companyFields))
+		}
+	}
+
+	var columns []string
+	for _, field := range companyFields {
+		if contains(requested, field.column) {
+			columns = append(columns, field.column)
+		}
+	}
+	return columns, nil
+}
+
+// hasCompanyColumn reports whether the column is a mapped Company field
+func hasCompanyColumn(column string) bool {
+
+	for _, field := range companyFields {
+		if field.column == column {
+			return true
+		}
+	}
+	return false
+}
+
+// selectFields returns the Company fields of the columns, every field when
+// columns is empty
+func selectFields(columns []string) []companyField {
+
+	if len(columns) == 0 {
+		return companyFields
+	}
+
+	var fields []companyField
+	for _, field := range companyFields {
+		if contains(columns, field.column) {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// withColumns returns the columns extended with the extra ones, an empty
+// fieldset already selects every column
+func withColumns(columns []string, extra ...string) []string {
+
+	if len(columns) == 0 {
+		return nil
+	}
+
+	merged := append([]string(nil), columns...)
+	for _, column := range extra {
+		if !contains(merged, column) {
+			merged = append(merged, column)
+		}
+	}
+	return merged
+}
+
+// MarshalJSON writes the selected fields in column order
+func (v companyView) MarshalJSON() ([]byte, error) {
+
+	if len(v.columns) == 0 {
+		return json.Marshal(v.company)
+	}
+
+	var buf bytes.Buffer
+	if err := writeFieldsJSON(&buf, selectFields(v.columns), &v.company, nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeFieldsJSON writes the fields of the company as a JSON object in column
+// order, keyed by the column names renamed by names
+func writeFieldsJSON(buf *bytes.Buffer, fields []companyField, company *Company, names map[string]string) error {
+
+	buf.WriteByte('{')
+	for i, field := range fields {
+
+		value, err := json.Marshal(field.addr(company))
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(renameKey(names, field.column))
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return nil
+}
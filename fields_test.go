@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestParseFields(t *testing.T) {
+
+	if _, err := parseFields("Company_ID,title"); err == nil {
+		t.Errorf("unknown field accepted")
+	}
+
+	columns, err := parseFields("Flight_Risk_Status,Company_Name,Company_ID,Company_Name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Company_ID", "Company_Name", "Flight_Risk_Status"}
+	if !reflect.DeepEqual(columns, want) {
+		t.Errorf("got %v want %v", columns, want)
+	}
+}
+
+func TestSQLStoreGetColumns(t *testing.T) {
+
+	ctx := context.Background()
+	store := newTestSQLiteStore(t)
+
+	company := testCompany(1)
+	if err := store.Create(ctx, &company); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.Get(ctx, 1, "Company_Name", "Total_Backfill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Company{Company_Name: company.Company_Name, Total_Backfill: company.Total_Backfill}
+	if got != want {
+		t.Errorf("got %+v want %+v", got, want)
+	}
+}
+
+func TestSparseFieldsets(t *testing.T) {
+
+	for _, dbType := range testDBTypes() {
+
+		app := initTestModule(t, dbType)
+
+		seed := []Company{testCompany(1), testCompany(2), testCompany(3)}
+		seed[0].Total_Flight_Risk = newNullInt(3)
+		seed[1].Total_Flight_Risk = newNullInt(2)
+		seed[2].Total_Flight_Risk = newNullInt(1)
+		if err := app.Store.CreateBatch(context.Background(), seed); err != nil {
+			t.Fatal(err)
+		}
+
+		// single company
+		req := httptest.NewRequest("GET", "/Company_Detail/2?fields=Company_ID,Company_Name,Flight_Risk_Status", nil)
+		req = mux.SetURLVars(req, map[string]string{"Company_ID": "2"})
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(app.returnSingleCompany).ServeHTTP(rr, req)
+
+		want := `{"Company_ID":2,"Company_Name":"TEST_GO","Flight_Risk_Status":"High"}`
+		if rr.Code != http.StatusOK || rr.Body.String() != want+"\n" {
+			t.Errorf("%s: got %d %s want %s", dbType, rr.Code, rr.Body.String(), want)
+		}
+
+		// every page only holds the fields, paging on a column left out
+		query := "/Company_Detail?fields=Company_Name,Company_ID&sort=Total_Flight_Risk&limit=2"
+		var got []json.RawMessage
+		for page := 0; page < 3; page++ {
+
+			req = httptest.NewRequest("GET", query, nil)
+			rr = httptest.NewRecorder()
+			http.HandlerFunc(app.returnAllCompany_Detail).ServeHTTP(rr, req)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("%s: got status %d want %d", dbType, rr.Code, http.StatusOK)
+			}
+
+			var body struct {
+				Items      []json.RawMessage `json:"items"`
+				NextCursor string            `json:"next_cursor"`
+			}
+			json.NewDecoder(rr.Body).Decode(&body)
+			got = append(got, body.Items...)
+			if body.NextCursor == "" {
+				break
+			}
+			query = "/Company_Detail?fields=Company_Name,Company_ID&sort=Total_Flight_Risk&limit=2&cursor=" + body.NextCursor
+		}
+
+		var items []string
+		for _, item := range got {
+			items = append(items, string(item))
+		}
+		wantItems := []string{
+			`{"Company_ID":3,"Company_Name":"TEST_GO"}`,
+			`{"Company_ID":2,"Company_Name":"TEST_GO"}`,
+			`{"Company_ID":1,"Company_Name":"TEST_GO"}`,
+		}
+		if !reflect.DeepEqual(items, wantItems) {
+			t.Errorf("%s: got %v want %v", dbType, items, wantItems)
+		}
+
+		// unknown fields are rejected
+		req = httptest.NewRequest("GET", "/Company_Detail?fields=Company_ID,secret", nil)
+		rr = httptest.NewRecorder()
+		http.HandlerFunc(app.returnAllCompany_Detail).ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: unknown field got status %d want %d", dbType, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
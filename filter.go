@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CompanyFilter narrows CompanyStore.List, zero values match every company
+type CompanyFilter struct {
+	ClientID         int       // only companies of this client, 0 matches all
+	FlightRiskStatus []string  // any of these Flight_Risk_Status values
+	RecruitStatus    []string  // any of these Recruit_Status values
+	MinFlightRisk    NullInt   // Total_Flight_Risk lower bound, inclusive
+	MaxFlightRisk    NullInt   // Total_Flight_Risk upper bound, inclusive
+	MinBackfill      NullInt   // Total_Backfill lower bound, inclusive
+	MaxBackfill      NullInt   // Total_Backfill upper bound, inclusive
+	DataAsOfFrom     time.Time // Data_As_Of_Date lower bound, inclusive
+	DataAsOfTo       time.Time // Data_As_Of_Date upper bound, inclusive
+	NameContains     string    // case-insensitive Company_Name substring
+}
+
+// likeEscape escapes the LIKE wildcards, '!' is accepted as ESCAPE character by
+// every supported dialect without extra quoting
+const likeEscape = "!"
+
+// parseCompanyFilter reads the list filters from the query params, the param
+// names follow the column names
+func parseCompanyFilter(query url.Values) (filter CompanyFilter, err error) {
+
+	if value := query.Get("Client_ID"); value != "" {
+		if filter.ClientID, err = strconv.Atoi(value); err != nil {
+			return filter, fmt.Errorf("invalid Client_ID query param : %s", value)
+		}
+	}
+
+	// statuses accept a comma separated list of accepted values
+	for _, enum := range []struct {
+		param   string
+		allowed []string
+		target  *[]string
+	}{
+		{"Flight_Risk_Status", flightRiskStatuses, &filter.FlightRiskStatus},
+		{"Recruit_Status", recruitStatuses, &filter.RecruitStatus},
+	} {
+		value := query.Get(enum.param)
+		if value == "" {
+			continue
+		}
+		for _, status := range strings.Split(value, ",") {
+			if !contains(enum.allowed, status) {
+				return filter, fmt.Errorf("invalid %s query param : %s, must be one of %s", enum.param, status, strings.Join(enum.allowed, ", "))
+			}
+			*enum.target = append(*enum.target, status)
+		}
+	}
+
+	for _, bound := range []struct {
+		param  string
+		target *NullInt
+	}{
+		{"Total_Flight_Risk_min", &filter.MinFlightRisk},
+		{"Total_Flight_Risk_max", &filter.MaxFlightRisk},
+		{"Total_Backfill_min", &filter.MinBackfill},
+		{"Total_Backfill_max", &filter.MaxBackfill},
+	} {
+		value := query.Get(bound.param)
+		if value == "" {
+			continue
+		}
+		total, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s query param : %s", bound.param, value)
+		}
+		*bound.target = newNullInt(total)
+	}
+
+	for _, bound := range []struct {
+		param  string
+		target *time.Time
+	}{
+		{"Data_As_Of_Date_from", &filter.DataAsOfFrom},
+		{"Data_As_Of_Date_to", &filter.DataAsOfTo},
+	} {
+		value := query.Get(bound.param)
+		if value == "" {
+			continue
+		}
+		if *bound.target, err = parseDate(value); err != nil {
+			return filter, fmt.Errorf("invalid %s query param : %s, must be a YYYY-MM-DD or RFC 3339 date", bound.param, value)
+		}
+	}
+
+	filter.NameContains = query.Get("Company_Name")
+	return filter, nil
+}
+
+// matches reports whether the company passes the filter
+func (f CompanyFilter) matches(company Company) bool {
+
+	if f.ClientID != 0 && company.Client_ID != f.ClientID {
+		return false
+	}
+	if len(f.FlightRiskStatus) > 0 && !contains(f.FlightRiskStatus, company.Flight_Risk_Status) {
+		return false
+	}
+	if len(f.RecruitStatus) > 0 && !contains(f.RecruitStatus, company.Recruit_Status) {
+		return false
+	}
+
+	// NULL totals and dates never match a bound, as in SQL
+	for _, bound := range []struct {
+		value    NullInt
+		min, max NullInt
+	}{
+		{company.Total_Flight_Risk, f.MinFlightRisk, f.MaxFlightRisk},
+		{company.Total_Backfill, f.MinBackfill, f.MaxBackfill},
+	} {
+		if bound.min.Valid && (!bound.value.Valid || bound.value.Int64 < bound.min.Int64) {
+			return false
+		}
+		if bound.max.Valid && (!bound.value.Valid || bound.value.Int64 > bound.max.Int64) {
+			return false
+		}
+	}
+
+	date := company.Data_As_Of_Date
+	if !f.DataAsOfFrom.IsZero() && (!date.Valid || date.Time.Before(f.DataAsOfFrom)) {
+		return false
+	}
+	if !f.DataAsOfTo.IsZero() && (!date.Valid || date.Time.After(f.DataAsOfTo)) {
+		return false
+	}
+
+	if f.NameContains != "" && !strings.Contains(strings.ToLower(company.Company_Name), strings.ToLower(f.NameContains)) {
+		return false
+	}
+	return true
+}
+
+// where returns the SQL conditions of the filter and their arguments, the
+// placeholders are numbered from next
+func (f CompanyFilter) where(dbType string, next int) (conditions []string, args []interface{}) {
+
+	// add appends a condition, each "%s" is replaced by the next placeholder
+	add := func(condition string, values ...interface{}) {
+		placeholders := make([]interface{}, len(values))
+		for i := range values {
+			placeholders[i] = placeholder(dbType, next)
+			next++
+		}
+		conditions = append(conditions, fmt.Sprintf(condition, placeholders...))
+		args = append(args, values...)
+	}
+
+	// in adds a column IN (...) condition
+	in := func(column string, values []string) {
+		markers := make([]string, len(values))
+		params := make([]interface{}, len(values))
+		for i, value := range values {
+			markers[i] = "%s"
+			params[i] = value
+		}
+		add(column+" IN ("+strings.Join(markers, ", ")+")", params...)
+	}
+
+	if f.ClientID != 0 {
+		add("Client_ID = %s", f.ClientID)
+	}
+	if len(f.FlightRiskStatus) > 0 {
+		in("Flight_Risk_Status", f.FlightRiskStatus)
+	}
+	if len(f.RecruitStatus) > 0 {
+		in("Recruit_Status", f.RecruitStatus)
+	}
+
+	for _, bound := range []struct {
+		column   string
+		min, max NullInt
+	}{
+		{"Total_Flight_Risk", f.MinFlightRisk, f.MaxFlightRisk},
+		{"Total_Backfill", f.MinBackfill, f.MaxBackfill},
+	} {
+		if bound.min.Valid {
+			add(bound.column+" >= %s", bound.min.Int64)
+		}
+		if bound.max.Valid {
+			add(bound.column+" <= %s", bound.max.Int64)
+		}
+	}
+
+	if !f.DataAsOfFrom.IsZero() {
+		add("Data_As_Of_Date >= %s", f.DataAsOfFrom.UTC())
+	}
+	if !f.DataAsOfTo.IsZero() {
+		add("Data_As_Of_Date <= %s", f.DataAsOfTo.UTC())
+	}
+
+	if f.NameContains != "" {
+		add("LOWER(Company_Name) LIKE %s ESCAPE '"+likeEscape+"'", "%"+escapeLike(strings.ToLower(f.NameContains))+"%")
+	}
+	return conditions, args
+}
+
+// escapeLike escapes the LIKE wildcards of value with likeEscape
+func escapeLike(value string) string {
+	return strings.NewReplacer(likeEscape, likeEscape+likeEscape, "%", likeEscape+"%", "_", likeEscape+"_").Replace(value)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseCompanyFilter(t *testing.T) {
+
+	for _, query := range []string{
+		"Client_ID=x",
+		"Flight_Risk_Status=High,Extreme",
+		"Total_Backfill_min=1.5",
+		"Data_As_Of_Date_to=25/02/2021",
+	} {
+		values, _ := url.ParseQuery(query)
+		if _, err := parseCompanyFilter(values); err == nil {
+			t.Errorf("%s: invalid filter accepted", query)
+		}
+	}
+
+	values, _ := url.ParseQuery("Client_ID=7&Recruit_Status=Open,On Hold&Total_Flight_Risk_max=10&Data_As_Of_Date_from=2021-02-01&Company_Name=acme")
+	filter, err := parseCompanyFilter(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := CompanyFilter{
+		ClientID:      7,
+		RecruitStatus: []string{"Open", "On Hold"},
+		MaxFlightRisk: newNullInt(10),
+		DataAsOfFrom:  time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC),
+		NameContains:  "acme",
+	}
+	if !reflect.DeepEqual(filter, want) {
+		t.Errorf("got %+v want %+v", filter, want)
+	}
+}
+
+func TestReturnAllCompany_DetailFilters(t *testing.T) {
+
+	for _, dbType := range testDBTypes() {
+
+		app := initTestModule(t, dbType)
+
+		// seed companies differing in every filtered column
+		seed := []Company{testCompany(1), testCompany(2), testCompany(3), testCompany(4), testCompany(5)}
+		seed[1].Client_ID = 7
+		seed[1].Company_Name = "Acme 100% Ltd"
+		seed[2].Flight_Risk_Status = "Low"
+		seed[2].Recruit_Status = "Filled"
+		seed[3].Total_Flight_Risk = newNullInt(10)
+		seed[3].Total_Backfill = NullInt{}
+		seed[4].Data_As_Of_Date = newNullDate(time.Date(2021, 3, 10, 0, 0, 0, 0, time.UTC))
+		if err := app.Store.CreateBatch(context.Background(), seed); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, test := range []struct {
+			query string
+			want  []int
+		}{
+			{"Client_ID=7", []int{2}},
+			{"Flight_Risk_Status=Low,Medium", []int{3}},
+			{"Recruit_Status=Open", []int{1, 2, 4, 5}},
+			{"Total_Flight_Risk_min=11&Total_Flight_Risk_max=1234", []int{1, 2, 3, 5}},
+			{"Total_Backfill_min=0", []int{1, 2, 3, 5}},
+			{"Data_As_Of_Date_from=2021-03-01", []int{5}},
+			{"Data_As_Of_Date_to=2021-02-25", []int{1, 2, 3, 4}},
+			{"Company_Name=acme", []int{2}},
+			{"Company_Name=0%25", []int{2}},
+			{"Company_Name=e_t", nil},
+			{"Recruit_Status=Open&id=2&limit=2", []int{4, 5}},
+		} {
+			req := httptest.NewRequest("GET", "/Company_Detail?"+test.query, nil)
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(app.returnAllCompany_Detail).ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Errorf("%s %s: got status %d want %d", dbType, test.query, rr.Code, http.StatusOK)
+				continue
+			}
+
+			var page companyPage
+			json.NewDecoder(rr.Body).Decode(&page)
+
+			var got []int
+			for _, company := range page.Items {
+				got = append(got, company.Company_ID)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("%s %s: got %v want %v", dbType, test.query, got, test.want)
+			}
+		}
+
+		// invalid filters are rejected
+		req := httptest.NewRequest("GET", "/Company_Detail?Recruit_Status=Hired", nil)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(app.returnAllCompany_Detail).ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: invalid filter got status %d want %d", dbType, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
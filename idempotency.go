@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// idempotencyKeyHeader lets clients retry a POST without repeating its effect
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLength is the size of the stored key column
+const maxIdempotencyKeyLength = 255
+
+// maxIdempotentPayloadBytes caps the payloads buffered to fingerprint them, the
+// idempotent routes take the same JSON as /v1
+const maxIdempotentPayloadBytes = maxV1JSONBytes
+
+// idempotencyLease is how long a request holds its key. A request that never
+// finished, its process crashed, leaves the key to a retry after the lease
+const idempotencyLease = time.Minute
+
+// replayedHeaders are the response headers stored and replayed with the body
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+type (
+
+	// IdempotencyStore remembers the responses of requests sent with an
+	// Idempotency-Key until they expire
+	IdempotencyStore interface {
+
+		// Reserve claims a key for a new request until lockedUntil, expired keys
+		// and the keys of a same request whose lease ran out are claimed again.
+		// It returns the record of a key that is already claimed, nil otherwise
+		Reserve(ctx context.Context, key, fingerprint string, now, lockedUntil, expires time.Time) (*idempotencyRecord, error)
+
+		// Save stores the response of the request holding the key
+		Save(ctx context.Context, key string, record idempotencyRecord) error
+
+		// Release drops a claimed key without a response, so the request can be retried
+		Release(ctx context.Context, key string) error
+	}
+
+	// idempotencyRecord is the request fingerprint and response stored for a key,
+	// Status is 0 while the first request is in flight
+	idempotencyRecord struct {
+		Fingerprint string
+		Status      int
+		Header      http.Header
+		Body        []byte
+	}
+
+	// recordingWriter captures the status and body written to a response
+	recordingWriter struct {
+		http.ResponseWriter
+		status int
+		body   bytes.Buffer
+	}
+)
+
+// newIdempotencyStore returns the IdempotencyStore implementation for the given DB type
+func newIdempotencyStore(dbType string, db *sql.DB) (IdempotencyStore, error) {
+
+	switch dbType {
+	case "mysql", "postgres", "sqlite":
+		return &sqlIdempotencyStore{db: db, dbType: dbType}, nil
+	case "memory":
+		return newMemoryIdempotencyStore(), nil
+	}
+	return nil, fmt.Errorf("unsupported DB type %q", dbType)
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+// requestFingerprint hashes the method, path and payload of a request, JSON
+// payloads are compacted so formatting does not matter
+func requestFingerprint(r *http.Request, body []byte) string {
+
+	var compact bytes.Buffer
+	if json.Compact(&compact, body) == nil {
+		body = compact.Bytes()
+	}
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s\n", r.Method, r.URL.Path)
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// idempotent replays the stored response of requests repeating an
+// Idempotency-Key, requests without the header are passed through
+func (app *App) idempotent(next http.HandlerFunc) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			app.writeProblem(w, r, http.StatusBadRequest, fmt.Sprintf("%s must not exceed %d characters", idempotencyKeyHeader, maxIdempotencyKeyLength))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentPayloadBytes))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			app.writeProblem(w, r, http.StatusRequestEntityTooLarge, "payload must not exceed "+strconv.Itoa(maxIdempotentPayloadBytes)+" bytes")
+			return
+		}
+		if err != nil {
+			app.writeProblem(w, r, http.StatusBadRequest, "invalid payload : "+err.Error())
+			return
+		}
+		fingerprint := requestFingerprint(r, body)
+
+		now := time.Now()
+		record, err := app.Idempotency.Reserve(r.Context(), key, fingerprint, now, now.Add(idempotencyLease), now.Add(app.idempotencyTTL))
+		if err != nil {
+			app.writeStoreError(w, r, err)
+			return
+		}
+
+		switch {
+		case record == nil:
+			// first request with this key, handled below
+		case record.Fingerprint != fingerprint:
+			app.writeProblem(w, r, http.StatusUnprocessableEntity, idempotencyKeyHeader+" was already used with another payload")
+			return
+		case record.Status == 0:
+			app.writeProblem(w, r, http.StatusConflict, "a request with this "+idempotencyKeyHeader+" is still in progress")
+			return
+		default:
+			app.logger.Printf("replaying response of %s %s\n", idempotencyKeyHeader, key)
+			for name, values := range record.Header {
+				w.Header()[name] = values
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(record.Status)
+			w.Write(record.Body)
+			return
+		}
+
+		// server errors may not happen again, let the client retry them. The
+		// request context may be done, so use a fresh one
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		// a panicking handler releases the key too
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				if err := app.Idempotency.Release(ctx, key); err != nil {
+					app.logger.Printf("failed to release %s %s : %s\n", idempotencyKeyHeader, key, err)
+				}
+				panic(recovered)
+			}
+		}()
+
+		// run the request, recording its response
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		recorder := &recordingWriter{ResponseWriter: w}
+		next(recorder, r)
+
+		if recorder.status == 0 || recorder.status >= http.StatusInternalServerError {
+			err = app.Idempotency.Release(ctx, key)
+		} else {
+			header := make(http.Header)
+			for _, name := range replayedHeaders {
+				if value := w.Header().Get(name); value != "" {
+					header.Set(name, value)
+				}
+			}
+			err = app.Idempotency.Save(ctx, key, idempotencyRecord{
+				Fingerprint: fingerprint,
+				Status:      recorder.status,
+				Header:      header,
+				Body:        recorder.body.Bytes(),
+			})
+		}
+		if err != nil {
+			app.logger.Printf("failed to store the response of %s %s : %s\n", idempotencyKeyHeader, key, err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memoryIdempotencyStore keeps the Idempotency-Key records in memory
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]memoryIdempotencyRecord
+}
+
+// memoryIdempotencyRecord is a stored record with its lease and expiry
+type memoryIdempotencyRecord struct {
+	idempotencyRecord
+	lockedUntil time.Time
+	expires     time.Time
+}
+
+// newMemoryIdempotencyStore returns an empty in-memory IdempotencyStore
+func newMemoryIdempotencyStore() *memoryIdempotencyStore {
+	return &memoryIdempotencyStore{records: make(map[string]memoryIdempotencyRecord)}
+}
+
+// Reserve claims a key for a new request until lockedUntil, expired keys and
+// the keys of a same request whose lease ran out are claimed again. It returns
+// the record of a key that is already claimed, nil otherwise
+func (s *memoryIdempotencyStore) Reserve(ctx context.Context, key, fingerprint string, now, lockedUntil, expires time.Time) (*idempotencyRecord, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// drop the expired keys, so they can be claimed again
+	for stored, record := range s.records {
+		if !record.expires.After(now) {
+			delete(s.records, stored)
+		}
+	}
+
+	record, ok := s.records[key]
+	if ok && (record.Status != 0 || record.Fingerprint != fingerprint || record.lockedUntil.After(now)) {
+		return &record.idempotencyRecord, nil
+	}
+	s.records[key] = memoryIdempotencyRecord{
+		idempotencyRecord: idempotencyRecord{Fingerprint: fingerprint},
+		lockedUntil:       lockedUntil,
+		expires:           expires,
+	}
+	return nil, nil
+}
+
+// Save stores the response of the request holding the key
+func (s *memoryIdempotencyStore) Save(ctx context.Context, key string, record idempotencyRecord) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.records[key]
+	if ok && stored.Fingerprint == record.Fingerprint {
+		stored.idempotencyRecord = record
+		s.records[key] = stored
+	}
+	return nil
+}
+
+// Release drops a claimed key without a response, so the request can be retried
+func (s *memoryIdempotencyStore) Release(ctx context.Context, key string) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.records[key].Status == 0 {
+		delete(s.records, key)
+	}
+	return nil
+}
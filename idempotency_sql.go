@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// sqlIdempotencyStore keeps the Idempotency-Key records in the idempotency_key table
+type sqlIdempotencyStore struct {
+	db     *sql.DB
+	dbType string
+}
+
+// ph returns the n-th (1 based) placeholder of the store dialect
+func (s *sqlIdempotencyStore) ph(n int) string {
+	return placeholder(s.dbType, n)
+}
+
+// Reserve claims a key for a new request until lockedUntil, expired keys and
+// the keys of a same request whose lease ran out are claimed again. It returns
+// the record of a key that is already claimed, nil otherwise
+func (s *sqlIdempotencyStore) Reserve(ctx context.Context, key, fingerprint string, now, lockedUntil, expires time.Time) (*idempotencyRecord, error) {
+
+	// drop the expired keys, so they can be claimed again
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM idempotency_key WHERE expires_at <= "+s.ph(1), now.Unix()); err != nil {
+		return nil, err
+	}
+
+	// the primary key lets a single request claim the key, the others read it.
+	// A claim released in between is retried once
+	for attempt := 0; attempt < 2; attempt++ {
+
+		_, err := s.db.ExecContext(ctx,
+			"INSERT INTO idempotency_key (idem_key, fingerprint, status, locked_until, expires_at) VALUES ("+s.ph(1)+", "+s.ph(2)+", 0, "+s.ph(3)+", "+s.ph(4)+")",
+			key, fingerprint, lockedUntil.Unix(), expires.Unix())
+		if err == nil {
+			return nil, nil
+		}
+		if !isDuplicateKey(err) {
+			return nil, err
+		}
+
+		// the same request left in flight past its lease is taken over
+		result, err := s.db.ExecContext(ctx,
+			"UPDATE idempotency_key SET locked_until="+s.ph(1)+", expires_at="+s.ph(2)+
+				" WHERE idem_key="+s.ph(3)+" AND fingerprint="+s.ph(4)+" AND status=0 AND locked_until<="+s.ph(5),
+			lockedUntil.Unix(), expires.Unix(), key, fingerprint, now.Unix())
+		if err != nil {
+			return nil, err
+		}
+		if taken, err := result.RowsAffected(); err != nil || taken == 1 {
+			return nil, err
+		}
+
+		var (
+			record  idempotencyRecord
+			headers sql.NullString
+			body    sql.NullString
+		)
+		err = s.db.QueryRowContext(ctx,
+			"SELECT fingerprint, status, headers, body FROM idempotency_key WHERE idem_key="+s.ph(1), key,
+		).Scan(&record.Fingerprint, &record.Status, &headers, &body)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if headers.Valid {
+			if err = json.Unmarshal([]byte(headers.String), &record.Header); err != nil {
+				return nil, err
+			}
+		}
+		record.Body = []byte(body.String)
+		return &record, nil
+	}
+
+	// the key keeps being claimed and released, report it as in flight
+	return &idempotencyRecord{Fingerprint: fingerprint}, nil
+}
+
+// Save stores the response of the request holding the key
+func (s *sqlIdempotencyStore) Save(ctx context.Context, key string, record idempotencyRecord) error {
+
+	headers, err := json.Marshal(record.Header)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		"UPDATE idempotency_key SET status="+s.ph(1)+", headers="+s.ph(2)+", body="+s.ph(3)+" WHERE idem_key="+s.ph(4)+" AND fingerprint="+s.ph(5),
+		record.Status, string(headers), string(record.Body), key, record.Fingerprint)
+	return err
+}
+
+// Release drops a claimed key without a response, so the request can be retried
+func (s *sqlIdempotencyStore) Release(ctx context.Context, key string) error {
+
+	_, err := s.db.ExecContext(ctx, "DELETE FROM idempotency_key WHERE idem_key="+s.ph(1)+" AND status=0", key)
+	return err
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyStore(t *testing.T) {
+
+	for _, dbType := range testDBTypes() {
+
+		ctx := context.Background()
+		store := initTestModule(t, dbType).Idempotency
+		now := time.Now()
+
+		record, err := store.Reserve(ctx, "key", "a", now, now.Add(time.Second), now.Add(time.Minute))
+		if err != nil || record != nil {
+			t.Fatalf("%s: first reserve got %+v, %v", dbType, record, err)
+		}
+
+		// a claimed key without a response is pending
+		record, err = store.Reserve(ctx, "key", "a", now, now.Add(time.Second), now.Add(time.Minute))
+		if err != nil || record == nil || record.Status != 0 || record.Fingerprint != "a" {
+			t.Fatalf("%s: pending reserve got %+v, %v", dbType, record, err)
+		}
+
+		saved := idempotencyRecord{Fingerprint: "a", Status: http.StatusCreated, Header: http.Header{"Etag": {`"x"`}}, Body: []byte(`{"ok":true}`)}
+		if err = store.Save(ctx, "key", saved); err != nil {
+			t.Fatal(err)
+		}
+		record, err = store.Reserve(ctx, "key", "b", now, now.Add(time.Second), now.Add(time.Minute))
+		if err != nil || record == nil || record.Status != saved.Status || record.Fingerprint != "a" ||
+			record.Header.Get("ETag") != `"x"` || string(record.Body) != string(saved.Body) {
+			t.Fatalf("%s: saved reserve got %+v, %v", dbType, record, err)
+		}
+
+		// saved responses are not released, expired ones are claimed again
+		if err = store.Release(ctx, "key"); err != nil {
+			t.Fatal(err)
+		}
+		if record, _ = store.Reserve(ctx, "key", "a", now, now.Add(time.Second), now.Add(time.Minute)); record == nil {
+			t.Errorf("%s: release dropped a saved response", dbType)
+		}
+		later := now.Add(2 * time.Minute)
+		if record, err = store.Reserve(ctx, "key", "b", later, later.Add(time.Second), later.Add(time.Minute)); err != nil || record != nil {
+			t.Errorf("%s: expired reserve got %+v, %v", dbType, record, err)
+		}
+
+		// released keys are claimed again
+		if err = store.Release(ctx, "key"); err != nil {
+			t.Fatal(err)
+		}
+		if record, err = store.Reserve(ctx, "key", "c", later, later.Add(time.Second), later.Add(time.Minute)); err != nil || record != nil {
+			t.Errorf("%s: released reserve got %+v, %v", dbType, record, err)
+		}
+
+		// a request left in flight past its lease gives its key to a retry, not
+		// to another payload
+		if record, err = store.Reserve(ctx, "lease", "a", now, now.Add(time.Second), now.Add(time.Minute)); err != nil || record != nil {
+			t.Fatalf("%s: lease reserve got %+v, %v", dbType, record, err)
+		}
+		leased := now.Add(2 * time.Second)
+		if record, err = store.Reserve(ctx, "lease", "b", leased, leased.Add(time.Second), leased.Add(time.Minute)); err != nil || record == nil || record.Fingerprint != "a" {
+			t.Errorf("%s: other payload after the lease got %+v, %v", dbType, record, err)
+		}
+		if record, err = store.Reserve(ctx, "lease", "a", leased, leased.Add(time.Second), leased.Add(time.Minute)); err != nil || record != nil {
+			t.Errorf("%s: retry after the lease got %+v, %v", dbType, record, err)
+		}
+		if record, err = store.Reserve(ctx, "lease", "a", leased, leased.Add(time.Second), leased.Add(time.Minute)); err != nil || record == nil || record.Status != 0 {
+			t.Errorf("%s: retry within the new lease got %+v, %v", dbType, record, err)
+		}
+	}
+}
+
+func TestIdempotentCreate(t *testing.T) {
+
+	for _, dbType := range testDBTypes() {
+
+		app := initTestModule(t, dbType)
+		handler := app.idempotent(app.createNewCompany)
+
+		post := func(key, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("POST", "/Company_Detail", strings.NewReader(body))
+			if key != "" {
+				req.Header.Set(idempotencyKeyHeader, key)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			return rr
+		}
+
+		payload, _ := json.Marshal(testCompany(1))
+		first := post("create-1", string(payload))
+		if first.Code != http.StatusOK || first.Header().Get("Idempotent-Replayed") != "" {
+			t.Fatalf("%s: first POST got status %d : %s", dbType, first.Code, first.Body)
+		}
+
+		// the same key and payload, formatted differently, replays the response
+		indented, _ := json.MarshalIndent(testCompany(1), "", "  ")
+		replay := post("create-1", string(indented))
+		if replay.Code != first.Code || replay.Body.String() != first.Body.String() ||
+			replay.Header().Get("ETag") != first.Header().Get("ETag") || replay.Header().Get("Idempotent-Replayed") != "true" {
+			t.Errorf("%s: replay got status %d, headers %v : %s", dbType, replay.Code, replay.Header(), replay.Body)
+		}
+
+		// a reused key with another payload is rejected
+		changed := testCompany(1)
+		changed.ASIC = "changed"
+		payload, _ = json.Marshal(changed)
+		if rr := post("create-1", string(payload)); rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: reused key got status %d want %d", dbType, rr.Code, http.StatusUnprocessableEntity)
+		}
+
+		// without a key the duplicate is created again and conflicts
+		if rr := post("", string(indented)); rr.Code != http.StatusConflict {
+			t.Errorf("%s: POST without key got status %d want %d", dbType, rr.Code, http.StatusConflict)
+		}
+
+		// client errors are replayed too
+		invalid := post("create-2", `{"Company_ID": 2}`)
+		if invalid.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: invalid POST got status %d", dbType, invalid.Code)
+		}
+		if rr := post("create-2", `{"Company_ID": 2}`); rr.Code != invalid.Code || rr.Header().Get("Idempotent-Replayed") != "true" {
+			t.Errorf("%s: invalid replay got status %d", dbType, rr.Code)
+		}
+
+		if rr := post(strings.Repeat("k", maxIdempotencyKeyLength+1), string(indented)); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: long key got status %d want %d", dbType, rr.Code, http.StatusBadRequest)
+		}
+		if rr := post("create-3", `{"Company_Name": "`+strings.Repeat("x", maxIdempotentPayloadBytes)+`"}`); rr.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s: oversized payload got status %d want %d", dbType, rr.Code, http.StatusRequestEntityTooLarge)
+		}
+
+		// a panicking handler releases its key, the retry runs again
+		payload, _ = json.Marshal(testCompany(4))
+		panicking := app.idempotent(func(w http.ResponseWriter, r *http.Request) { panic(http.ErrAbortHandler) })
+		func() {
+			defer func() {
+				if recovered := recover(); recovered != http.ErrAbortHandler {
+					t.Errorf("%s: got panic %v", dbType, recovered)
+				}
+			}()
+			req := httptest.NewRequest("POST", "/Company_Detail", strings.NewReader(string(payload)))
+			req.Header.Set(idempotencyKeyHeader, "create-4")
+			panicking.ServeHTTP(httptest.NewRecorder(), req)
+		}()
+		if rr := post("create-4", string(payload)); rr.Code != http.StatusOK || rr.Header().Get("Idempotent-Replayed") != "" {
+			t.Errorf("%s: retry after a panic got status %d : %s", dbType, rr.Code, rr.Body)
+		}
+	}
+}
@@ -0,0 +1,579 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// import chunks and file size
+const (
+	defaultImportChunk = 500
+	maxImportBytes     = 32 << 20
+)
+
+// row error codes of an import, on top of the field error codes
+const (
+	codeInvalidRow = "invalid_row"
+	codeLoadFailed = "load_failed"
+	codeRolledBack = "rolled_back"
+	codeNotLoaded  = "not_loaded"
+)
+
+// errInvalidImport is wrapped by the errors of a file that cannot be imported
+var errInvalidImport = errors.New("invalid import file")
+
+type (
+
+	// importOptions controls how a file is imported
+	importOptions struct {
+		format    string            // formatCSV or formatXLSX
+		mapping   map[string]string // file headers to their column, an empty column skips the header
+		dryRun    bool              // validate the rows without loading them
+		chunkSize int               // rows upserted per transaction
+	}
+
+	// importReader reads the rows of an import file with their number, the
+	// header row first, and io.EOF after the last one
+	importReader interface {
+		next() (row int, cells []string, err error)
+	}
+
+	// importReport is the outcome of an import
+	importReport struct {
+		DryRun bool          `json:"dry_run"`
+		Rows   int           `json:"rows"`
+		Valid  int           `json:"valid"`
+		Loaded int           `json:"loaded"`
+		Failed int           `json:"failed"`
+		Chunks int           `json:"chunks"`
+		Errors []importError `json:"errors"`
+	}
+
+	// importError is a reason a row was not loaded, the rows of the error file
+	importError struct {
+		Row        int    `json:"row"`
+		Company_ID int    `json:"Company_ID,omitempty"`
+		Field      string `json:"field,omitempty"`
+		Code       string `json:"code"`
+		Message    string `json:"message"`
+	}
+
+	// importRow is a valid company of the file
+	importRow struct {
+		row     int
+		company Company
+	}
+)
+
+// csvReader reads the rows of a CSV import file, numbered after their first
+// line, as spreadsheets number them
+type csvReader struct {
+	r *csv.Reader
+}
+
+// newCSVReader reads a CSV file, the rows may have fewer cells than the header
+func newCSVReader(r io.Reader) *csvReader {
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	return &csvReader{r: reader}
+}
+
+func (c *csvReader) next() (int, []string, error) {
+
+	cells, err := c.r.Read()
+	if err != nil {
+		return 0, nil, err
+	}
+	row, _ := c.r.FieldPos(0)
+
+	// spreadsheets start their CSV exports with a byte order mark
+	if row == 1 {
+		cells[0] = strings.TrimPrefix(cells[0], "\ufeff")
+	}
+	return row, cells, nil
+}
+
+// newImportReader reads an import file of the given format
+func newImportReader(format string, r io.Reader) (importReader, error) {
+
+	switch format {
+	case formatCSV:
+		return newCSVReader(r), nil
+	case formatXLSX:
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w : %w", errInvalidImport, err)
+		}
+		reader, err := newXLSXReader(data)
+		if err != nil {
+			return nil, fmt.Errorf("%w : %w", errInvalidImport, err)
+		}
+		return reader, nil
+	}
+	return nil, fmt.Errorf("%w : unknown format %s, must be %s or %s", errInvalidImport, format, formatCSV, formatXLSX)
+}
+
+// importColumn returns the column named in any case
+func importColumn(name string) (string, bool) {
+
+	for _, field := range companyFields {
+		if strings.EqualFold(field.column, name) {
+			return field.column, true
+		}
+	}
+	return "", false
+}
+
+// parseMapping parses the header=column mappings of an import, a mapping
+// without column skips the header
+func parseMapping(values []string) (map[string]string, error) {
+
+	mapping := make(map[string]string, len(values))
+	for _, value := range values {
+
+		i := strings.LastIndex(value, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid mapping %s, must be header=column", value)
+		}
+		header, column := strings.TrimSpace(value[:i]), strings.TrimSpace(value[i+1:])
+		if column != "" {
+			known, ok := importColumn(column)
+			if !ok {
+				return nil, fmt.Errorf("invalid mapping %s, the column must be one of %s", value, columnList(companyFields))
+			}
+			column = known
+		}
+		mapping[header] = column
+	}
+	return mapping, nil
+}
+
+// importFields returns the field of every header cell, nil for the skipped
+// ones. A header is mapped to its column, or else names it in any case
+func importFields(header []string, mapping map[string]string) ([]*companyField, error) {
+
+	fields := make([]*companyField, len(header))
+	mapped := make(map[string]bool, len(header))
+	used := make(map[string]bool, len(mapping))
+	for i, name := range header {
+
+		name = strings.TrimSpace(name)
+		column, ok := mapping[name]
+		used[name] = ok
+		if !ok {
+			if column, ok = importColumn(name); !ok {
+				return nil, fmt.Errorf("%w : unknown header %q, map it to a column or skip it with map=%s=", errInvalidImport, name, name)
+			}
+		}
+		if column == "" {
+			continue
+		}
+		if mapped[column] {
+			return nil, fmt.Errorf("%w : more than one header maps to %s", errInvalidImport, column)
+		}
+		mapped[column] = true
+
+		for j := range companyFields {
+			if companyFields[j].column == column {
+				fields[i] = &companyFields[j]
+			}
+		}
+	}
+
+	for name := range mapping {
+		if !used[name] {
+			return nil, fmt.Errorf("%w : the mapped header %q is not in the file", errInvalidImport, name)
+		}
+	}
+	for _, column := range requiredColumns() {
+		if !mapped[column] {
+			return nil, fmt.Errorf("%w : no header maps to the required column %s", errInvalidImport, column)
+		}
+	}
+	return fields, nil
+}
+
+// setCell sets a Company field from the text of a cell, empty is NULL
+func setCell(field *companyField, company *Company, text string) *fieldError {
+
+	var err error
+	switch value := field.addr(company).(type) {
+	case *int:
+		if text != "" {
+			*value, err = strconv.Atoi(text)
+		}
+	case *string:
+		*value = text
+	case *NullInt:
+		if text != "" {
+			var parsed int64
+			if parsed, err = strconv.ParseInt(text, 10, 64); err == nil {
+				*value = newNullInt(parsed)
+			}
+		}
+	case *NullTime:
+		if text != "" {
+			parsed, parseErr := parseDate(text)
+			if parseErr != nil {
+				return &fieldError{field.column, codeInvalidDate, "must be a YYYY-MM-DD or RFC 3339 date"}
+			}
+			*value = newNullTime(parsed)
+		}
+	case *NullDate:
+		if text != "" {
+			parsed, parseErr := parseDate(text)
+			if parseErr != nil {
+				return &fieldError{field.column, codeInvalidDate, "must be a YYYY-MM-DD or RFC 3339 date"}
+			}
+			*value = newNullDate(parsed)
+		}
+	}
+	if err != nil {
+		return &fieldError{field.column, codeInvalidType, "invalid value " + strconv.Quote(text)}
+	}
+	return nil
+}
+
+// readImportRows reads and validates every row of an import file, returning
+// the valid companies and the errors of the others
+func readImportRows(rows importReader, mapping map[string]string, report *importReport) ([]importRow, error) {
+
+	// the header is the first row with a cell
+	var fields []*companyField
+	for fields == nil {
+		_, header, err := rows.next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%w : the file has no header row", errInvalidImport)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w : %w", errInvalidImport, err)
+		}
+		if strings.Join(header, "") == "" {
+			continue
+		}
+		if fields, err = importFields(header, mapping); err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		valid []importRow
+		seen  = make(map[int]int)
+	)
+	for {
+		row, cells, err := rows.next()
+		if err == io.EOF {
+			return valid, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w : %w", errInvalidImport, err)
+		}
+		if strings.TrimSpace(strings.Join(cells, "")) == "" {
+			continue
+		}
+		report.Rows++
+
+		company := Company{}
+		var errs validationErrors
+		extra := false
+		for i, cell := range cells {
+			switch {
+			case i >= len(fields):
+				extra = extra || strings.TrimSpace(cell) != ""
+			case fields[i] != nil:
+				if fieldErr := setCell(fields[i], &company, strings.TrimSpace(cell)); fieldErr != nil {
+					errs = append(errs, *fieldErr)
+				}
+			}
+		}
+		errs = withRuleErrors(errs, &company)
+
+		// a company is loaded once, the upsert of a chunk cannot repeat it
+		if first, ok := seen[company.Company_ID]; ok && len(errs) == 0 {
+			errs = append(errs, fieldError{"Company_ID", codeInvalidValue, fmt.Sprintf("repeats the company of row %d", first)})
+		}
+
+		if len(errs) == 0 && !extra {
+			seen[company.Company_ID] = row
+			valid = append(valid, importRow{row, company})
+			continue
+		}
+		report.Failed++
+		if extra {
+			report.Errors = append(report.Errors, importError{row, company.Company_ID, "", codeInvalidRow, "has more cells than the header"})
+		}
+		for _, fieldErr := range errs {
+			report.Errors = append(report.Errors, importError{row, company.Company_ID, fieldErr.Field, fieldErr.Code, fieldErr.Message})
+		}
+	}
+}
+
+// importCompanies validates every row of an import file and upserts the valid
+// companies in chunks of a transaction each, a failing row rolls its chunk
+// back. The file is read in full first so a malformed one loads nothing. A
+// store error stopping the import is returned with the report so far
+func (app *App) importCompanies(ctx context.Context, rows importReader, opts importOptions) (importReport, error) {
+
+	report := importReport{DryRun: opts.dryRun, Errors: []importError{}}
+	valid, err := readImportRows(rows, opts.mapping, &report)
+	if err != nil {
+		return report, err
+	}
+	report.Valid = len(valid)
+
+	// the errors are reported in row order
+	defer func() {
+		sort.SliceStable(report.Errors, func(i, j int) bool { return report.Errors[i].Row < report.Errors[j].Row })
+	}()
+	if opts.dryRun {
+		return report, nil
+	}
+
+	for start := 0; start < len(valid); start += opts.chunkSize {
+
+		chunk := valid[start:min(start+opts.chunkSize, len(valid))]
+		// the upserts are scoped to the client as in Store.Upsert, a company of
+		// another client fails its row instead of changing hands
+		ops := make([]BatchOp, len(chunk))
+		for i, row := range chunk {
+			ops[i] = BatchOp{Action: batchUpsert, Company: row.company}
+		}
+
+		errs, err := app.Store.Batch(ctx, ops, true)
+		if err != nil && !errors.Is(err, errBatchFailed) {
+			// the following chunks are not loaded either
+			_, detail := app.storeErrorStatus(err)
+			for _, row := range valid[start:] {
+				report.Failed++
+				report.Errors = append(report.Errors, importError{row.row, row.company.Company_ID, "", codeNotLoaded, "not loaded, the import stopped : " + detail})
+			}
+			return report, err
+		}
+		report.Chunks++
+
+		if err == nil {
+			report.Loaded += len(chunk)
+			continue
+		}
+		for i, row := range chunk {
+			report.Failed++
+			if errs[i] != nil {
+				_, detail := app.storeErrorStatus(errs[i])
+				report.Errors = append(report.Errors, importError{row.row, row.company.Company_ID, "", codeLoadFailed, detail})
+			} else {
+				report.Errors = append(report.Errors, importError{row.row, row.company.Company_ID, "", codeRolledBack, "not loaded, another row of its chunk failed"})
+			}
+		}
+	}
+	app.logger.Printf("imported %d of %d companies in %d chunks\n", report.Loaded, report.Rows, report.Chunks)
+	return report, nil
+}
+
+// writeImportErrors writes the errors of an import as a CSV error file, the
+// columns are named after the key names
+func writeImportErrors(w io.Writer, errs []importError, names map[string]string) error {
+
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"row", renameKey(names, "Company_ID"), "field", "code", "message"})
+	for _, e := range errs {
+		companyID := ""
+		if e.Company_ID != 0 {
+			companyID = strconv.Itoa(e.Company_ID)
+		}
+		writer.Write([]string{strconv.Itoa(e.Row), companyID, renameKey(names, e.Field), e.Code, e.Message})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// parseImportOptions reads the import options of the query params
+func parseImportOptions(r *http.Request) (opts importOptions, err error) {
+
+	query := r.URL.Query()
+	opts.chunkSize = defaultImportChunk
+	if opts.mapping, err = parseMapping(query["map"]); err != nil {
+		return
+	}
+	if dryRun := query.Get("dry_run"); dryRun != "" {
+		if opts.dryRun, err = strconv.ParseBool(dryRun); err != nil {
+			return opts, fmt.Errorf("invalid dry_run query param : %s", dryRun)
+		}
+	}
+	if chunkSize := query.Get("chunk_size"); chunkSize != "" {
+		if opts.chunkSize, err = strconv.Atoi(chunkSize); err != nil || opts.chunkSize < 1 || opts.chunkSize > maxBatchOperations {
+			return opts, fmt.Errorf("invalid chunk_size query param : %s, must be 1 to %d", chunkSize, maxBatchOperations)
+		}
+	}
+	return opts, nil
+}
+
+//	POST /Company_Detail/import
+//	payload : CSV or XLSX file, a header row naming the columns then a company per row
+//	query : map (header=column), dry_run and chunk_size
+//	response : import report as JSON, or its error file as text/csv
+//
+// upsert the valid companies of a file in chunks of a transaction each, reporting the rejected rows
+func (app *App) importCompanyFile(w http.ResponseWriter, r *http.Request) {
+
+	app.logger.Println("Endpoint hit : importCompanyFile")
+
+	// the report is JSON, its errors may be fetched as a CSV error file
+	w.Header().Add("Vary", "Accept")
+	format, err := negotiateFormat(r)
+	if err != nil {
+		app.writeFormatError(w, r, err)
+		return
+	}
+	if format != formatJSON && format != formatCSV {
+		app.writeProblem(w, r, http.StatusNotAcceptable, "the import report is sent as application/json, or its error file as text/csv")
+		return
+	}
+
+	// the file format is its media type
+	opts, err := parseImportOptions(r)
+	if err != nil {
+		app.writeProblem(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case formatMediaType(formatCSV):
+		opts.format = formatCSV
+	case formatMediaType(formatXLSX):
+		opts.format = formatXLSX
+	default:
+		app.writeProblem(w, r, http.StatusUnsupportedMediaType, "import payload must be text/csv or "+xlsxType)
+		return
+	}
+
+	// read, validate and load the rows
+	body := http.MaxBytesReader(w, r.Body, maxImportBytes)
+	rows, err := newImportReader(opts.format, body)
+	if err == nil {
+		var report importReport
+		if report, err = app.importCompanies(r.Context(), rows, opts); err == nil || report.Loaded > 0 {
+			app.writeImportReport(w, r, format, report)
+			return
+		}
+	}
+
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		app.writeProblem(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("import file must not exceed %d bytes", maxImportBytes))
+	case errors.Is(err, errInvalidImport):
+		app.writeProblem(w, r, http.StatusBadRequest, err.Error())
+	default:
+		app.writeStoreError(w, r, err)
+	}
+}
+
+// writeImportReport sends an import report, or its error file. Reports with
+// errors answer 207 when some rows were loaded and 422 otherwise
+func (app *App) writeImportReport(w http.ResponseWriter, r *http.Request, format string, report importReport) {
+
+	status := http.StatusOK
+	switch {
+	case len(report.Errors) == 0:
+	case report.Loaded > 0:
+		status = http.StatusMultiStatus
+	default:
+		status = http.StatusUnprocessableEntity
+	}
+
+	if format == formatJSON {
+		app.writeJSON(w, status, report)
+		return
+	}
+	w.Header().Set("Content-Type", formatMediaType(formatCSV))
+	w.Header().Set("Content-Disposition", `attachment; filename="Company_Detail_import_errors.csv"`)
+	w.WriteHeader(status)
+	if err := writeImportErrors(w, report.Errors, keyNames(r)); err != nil {
+		app.logger.Println(err)
+	}
+}
+
+// mappingFlag collects the repeated -map flags of the import command
+type mappingFlag []string
+
+func (m *mappingFlag) String() string {
+	return strings.Join(*m, ",")
+}
+
+func (m *mappingFlag) Set(value string) error {
+	*m = append(*m, value)
+	return nil
+}
+
+// runImportCommand imports the CSV or XLSX file named by the arguments of the
+// import command, writing the report to out. Rejected rows fail the command
+func runImportCommand(ctx context.Context, app *App, args []string, out io.Writer) error {
+
+	var mapping mappingFlag
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.Var(&mapping, "map", "map a file header to a column as header=column, or skip it as header=, repeatable")
+	dryRun := flags.Bool("dry-run", false, "validate the rows without loading them")
+	chunkSize := flags.Int("chunk-size", defaultImportChunk, "rows upserted per transaction")
+	errorsFile := flags.String("errors", "", "write the rejected rows to this CSV error file")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage : import [-map header=column] [-dry-run] [-chunk-size n] [-errors file] <file.csv|file.xlsx>")
+	}
+	if *chunkSize < 1 {
+		return errors.New("chunk-size must be positive")
+	}
+
+	opts := importOptions{dryRun: *dryRun, chunkSize: *chunkSize, format: strings.TrimPrefix(strings.ToLower(filepath.Ext(flags.Arg(0))), ".")}
+	var err error
+	if opts.mapping, err = parseMapping(mapping); err != nil {
+		return err
+	}
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	rows, err := newImportReader(opts.format, file)
+	if err != nil {
+		return err
+	}
+	report, err := app.importCompanies(ctx, rows, opts)
+	if errors.Is(err, errInvalidImport) {
+		return err
+	}
+
+	fmt.Fprintf(out, "rows %d, valid %d, loaded %d in %d chunks, failed %d\n", report.Rows, report.Valid, report.Loaded, report.Chunks, report.Failed)
+	for _, e := range report.Errors {
+		fmt.Fprintf(out, "row %d\t%s\t%s\t%s\n", e.Row, e.Field, e.Code, e.Message)
+	}
+	if *errorsFile != "" {
+		errorFile, createErr := os.Create(*errorsFile)
+		if createErr != nil {
+			return createErr
+		}
+		defer errorFile.Close()
+		if writeErr := writeImportErrors(errorFile, report.Errors, nil); writeErr != nil {
+			return writeErr
+		}
+	}
+
+	if err == nil && report.Failed > 0 {
+		err = fmt.Errorf("%d of %d rows were not loaded", report.Failed, report.Rows)
+	}
+	return err
+}
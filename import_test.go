@@ -0,0 +1,372 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// rejectingStore fails the batch upserts of a company, rolling its batch back
+type rejectingStore struct {
+	CompanyStore
+	companyID int
+}
+
+func (s rejectingStore) Batch(ctx context.Context, ops []BatchOp, atomic bool) ([]error, error) {
+
+	errs := make([]error, len(ops))
+	for i, op := range ops {
+		if op.Company.Company_ID == s.companyID {
+			errs[i] = ErrCompanyOfOtherClient
+			return errs, errBatchFailed
+		}
+	}
+	return s.CompanyStore.Batch(ctx, ops, atomic)
+}
+
+func TestImportCompanies(t *testing.T) {
+
+	for _, dbType := range testDBTypes() {
+
+		app := initTestModule(t, dbType)
+
+		serve := func(url, body, contentType, accept string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("POST", url, strings.NewReader(body))
+			req.Header.Set("Content-Type", contentType)
+			if accept != "" {
+				req.Header.Set("Accept", accept)
+			}
+			rr := httptest.NewRecorder()
+			app.Router.ServeHTTP(rr, req)
+			return rr
+		}
+		count := func() int {
+			count, err := app.Store.Count(context.Background(), CompanyFilter{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return count
+		}
+
+		// a spreadsheet export, with a byte order mark, a renamed and an extra column
+		file := "\ufeffclient_id,Company_ID,Company Name,Recruit_Status,Data_As_Of_Date,Notes\n" +
+			"2399029309,1,First,Open,2021-02-25,\n" +
+			"2399029309,2,Second,,,keep\n" +
+			"\n" +
+			"2399029309,3,,Nope,2021-02-30,\n" +
+			"2399029309,1,Again,,,\n" +
+			"2399029309,4,Extra,,,,surplus\n" +
+			"2399029309,5,\"Quoted, name\",Filled,2021-02-25T10:30:00Z,\n"
+		query := "?map=Company%20Name=Company_Name&map=Notes="
+
+		// a dry run loads nothing
+		rr := serve("/Company_Detail/import"+query+"&dry_run=true", file, "text/csv", "")
+		var report importReport
+		json.Unmarshal(rr.Body.Bytes(), &report)
+		if rr.Code != http.StatusUnprocessableEntity || !report.DryRun || report.Rows != 6 || report.Valid != 3 || report.Failed != 3 || report.Loaded != 0 || count() != 0 {
+			t.Fatalf("%s: dry run got %d %s", dbType, rr.Code, rr.Body)
+		}
+
+		// the errors are reported by line, once per field
+		want := []importError{
+			{5, 3, "Data_As_Of_Date", codeInvalidDate, "must be a YYYY-MM-DD or RFC 3339 date"},
+			{5, 3, "Company_Name", codeRequired, "must not be empty"},
+			{5, 3, "Recruit_Status", codeInvalidValue, "must be one of " + strings.Join(recruitStatuses, ", ")},
+			{6, 1, "Company_ID", codeInvalidValue, "repeats the company of row 2"},
+			{7, 4, "", codeInvalidRow, "has more cells than the header"},
+		}
+		if !reflect.DeepEqual(report.Errors, want) {
+			t.Errorf("%s: got errors %+v want %+v", dbType, report.Errors, want)
+		}
+
+		// the valid rows are loaded, in chunks
+		rr = serve("/Company_Detail/import"+query+"&chunk_size=2", file, "text/csv", "")
+		report = importReport{}
+		json.Unmarshal(rr.Body.Bytes(), &report)
+		if rr.Code != http.StatusMultiStatus || report.Loaded != 3 || report.Chunks != 2 || count() != 3 {
+			t.Fatalf("%s: import got %d %s", dbType, rr.Code, rr.Body)
+		}
+		company, err := app.Store.Get(context.Background(), 5)
+		if err != nil || company.Company_Name != "Quoted, name" || !company.Data_As_Of_Date.Valid || company.Recruit_Status != "Filled" {
+			t.Errorf("%s: got imported company %+v, %v", dbType, company, err)
+		}
+
+		// imports upsert, the error file names the /v1 keys
+		rr = serve("/v1/companies:import", "company_id,client_id,company_name,total_backfill\n2,2399029309,Renamed,-1\n1,2399029309,Renamed,\n", "text/csv", "text/csv")
+		if want := "row,company_id,field,code,message\n2,2,total_backfill,invalid_value,must not be negative\n"; rr.Code != http.StatusMultiStatus || rr.Body.String() != want {
+			t.Errorf("%s: v1 error file got %d %q want %q", dbType, rr.Code, rr.Body, want)
+		}
+		if company, err = app.Store.Get(context.Background(), 1); err != nil || company.Company_Name != "Renamed" || company.Recruit_Status != "" {
+			t.Errorf("%s: got upserted company %+v, %v", dbType, company, err)
+		}
+
+		// a failing row rolls its chunk back, the other chunks are loaded
+		store := app.Store
+		app.Store = rejectingStore{store, 7}
+		rr = serve("/Company_Detail/import?chunk_size=2", "Client_ID,Company_ID,Company_Name\n2399029309,6,A\n2399029309,7,B\n2399029309,8,C\n", "text/csv", "")
+		app.Store = store
+		report = importReport{}
+		json.Unmarshal(rr.Body.Bytes(), &report)
+		want = []importError{
+			{2, 6, "", codeRolledBack, "not loaded, another row of its chunk failed"},
+			{3, 7, "", codeLoadFailed, ErrCompanyOfOtherClient.Error()},
+		}
+		if rr.Code != http.StatusMultiStatus || report.Loaded != 1 || !reflect.DeepEqual(report.Errors, want) || count() != 4 {
+			t.Errorf("%s: rolled back chunk got %d %s", dbType, rr.Code, rr.Body)
+		}
+
+		// a company of another client is not taken over by the import
+		rr = serve("/Company_Detail/import", "Client_ID,Company_ID,Company_Name\n2,8,Hijacked\n2399029309,9,D\n", "text/csv", "")
+		report = importReport{}
+		json.Unmarshal(rr.Body.Bytes(), &report)
+		want = []importError{
+			{2, 8, "", codeLoadFailed, ErrCompanyOfOtherClient.Error()},
+			{3, 9, "", codeRolledBack, "not loaded, another row of its chunk failed"},
+		}
+		if rr.Code != http.StatusUnprocessableEntity || report.Loaded != 0 || !reflect.DeepEqual(report.Errors, want) || count() != 4 {
+			t.Errorf("%s: other client's company got %d %s", dbType, rr.Code, rr.Body)
+		}
+		if company, err = app.Store.Get(context.Background(), 8); err != nil || company.Client_ID != 2399029309 || company.Company_Name != "C" {
+			t.Errorf("%s: got other client's company %+v, %v", dbType, company, err)
+		}
+
+		// an XLSX export imports back as is
+		before := httptest.NewRecorder()
+		app.Router.ServeHTTP(before, httptest.NewRequest("GET", "/Company_Detail", nil))
+		export := httptest.NewRecorder()
+		app.Router.ServeHTTP(export, httptest.NewRequest("GET", "/Company_Detail?format=xlsx", nil))
+		if err = app.Store.DeleteBatch(context.Background(), []int{1, 2, 5, 8}); err != nil {
+			t.Fatal(err)
+		}
+		if rr = serve("/Company_Detail/import", export.Body.String(), xlsxType, ""); rr.Code != http.StatusOK {
+			t.Fatalf("%s: XLSX import got %d %s", dbType, rr.Code, rr.Body)
+		}
+		after := httptest.NewRecorder()
+		app.Router.ServeHTTP(after, httptest.NewRequest("GET", "/Company_Detail", nil))
+		if after.Body.String() != before.Body.String() {
+			t.Errorf("%s: XLSX round trip got %s want %s", dbType, after.Body, before.Body)
+		}
+
+		// files that cannot be imported load nothing
+		for name, tc := range map[string]struct {
+			url         string
+			body        string
+			contentType string
+			accept      string
+			status      int
+		}{
+			"unknown header":   {"/Company_Detail/import", "Client_ID,Company_ID,Company_Name,Size\n2399029309,9,A,1\n", "text/csv", "", http.StatusBadRequest},
+			"missing column":   {"/Company_Detail/import", "Client_ID,Company_Name\n2399029309,A\n", "text/csv", "", http.StatusBadRequest},
+			"unused mapping":   {"/Company_Detail/import?map=Name=Company_Name", "Client_ID,Company_ID,Company_Name\n2399029309,9,A\n", "text/csv", "", http.StatusBadRequest},
+			"mapped twice":     {"/Company_Detail/import?map=Name=Company_Name", "Client_ID,Company_ID,Company_Name,Name\n2399029309,9,A,B\n", "text/csv", "", http.StatusBadRequest},
+			"malformed CSV":    {"/Company_Detail/import", "Client_ID,Company_ID,Company_Name\n2399029309,9,\"A\n", "text/csv", "", http.StatusBadRequest},
+			"empty file":       {"/Company_Detail/import", "", "text/csv", "", http.StatusBadRequest},
+			"malformed XLSX":   {"/Company_Detail/import", "Client_ID", xlsxType, "", http.StatusBadRequest},
+			"invalid chunk":    {"/Company_Detail/import?chunk_size=0", "", "text/csv", "", http.StatusBadRequest},
+			"JSON payload":     {"/Company_Detail/import", "{}", "application/json", "", http.StatusUnsupportedMediaType},
+			"XLSX report":      {"/Company_Detail/import", "", "text/csv", xlsxType, http.StatusNotAcceptable},
+			"oversized upload": {"/Company_Detail/import", strings.Repeat("x", maxImportBytes+1), xlsxType, "", http.StatusRequestEntityTooLarge},
+		} {
+			if rr = serve(tc.url, tc.body, tc.contentType, tc.accept); rr.Code != tc.status || rr.Header().Get("Content-Type") != "application/problem+json" {
+				t.Errorf("%s: %s got %d %s", dbType, name, rr.Code, rr.Body)
+			}
+		}
+		if count() != 4 {
+			t.Errorf("%s: invalid files changed the companies, %d left", dbType, count())
+		}
+
+		// a store down before loading anything answers its status
+		app.Store = failingStore{err: driver.ErrBadConn}
+		rr = serve("/Company_Detail/import", "Client_ID,Company_ID,Company_Name\n2399029309,9,A\n", "text/csv", "")
+		app.Store = store
+		if rr.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s: import with the store down got %d %s", dbType, rr.Code, rr.Body)
+		}
+	}
+}
+
+func TestXLSXReader(t *testing.T) {
+
+	// a workbook as spreadsheets write it, with shared strings, rich text, styled
+	// dates, sparse cells and its sheet not named sheet1
+	reader, err := newXLSXReader(zipWorkbook(map[string]string{
+		xlsxWorkbook: `<workbook xmlns="` + spreadsheetNS + `" xmlns:r="` + officeRelNS + `"><sheets><sheet name="Data" sheetId="1" r:id="rId3"/></sheets></workbook>`,
+		xlsxWorkbookRel: `<Relationships xmlns="` + relationshipNS + `">` +
+			`<Relationship Id="rId1" Type="` + officeRelNS + `/sharedStrings" Target="sharedStrings.xml"/>` +
+			`<Relationship Id="rId2" Type="` + officeRelNS + `/styles" Target="/xl/styles.xml"/>` +
+			`<Relationship Id="rId3" Type="` + officeRelNS + `/worksheet" Target="worksheets/data.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst xmlns="` + spreadsheetNS + `"><si><t>Company_Name</t></si><si><r><t>Rich </t></r><r><t>Text</t></r></si></sst>`,
+		"xl/styles.xml": `<styleSheet xmlns="` + spreadsheetNS + `"><numFmts><numFmt numFmtId="170" formatCode="[Red]&quot;day&quot; 0"/><numFmt numFmtId="171" formatCode="d/m/yyyy h:mm"/></numFmts>` +
+			`<cellXfs><xf numFmtId="0"/><xf numFmtId="14"/><xf numFmtId="170"/><xf numFmtId="171"/></cellXfs></styleSheet>`,
+		"xl/worksheets/data.xml": `<worksheet xmlns="` + spreadsheetNS + `"><sheetData>` +
+			`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="C1" t="inlineStr"><is><t>Date</t></is></c></row>` +
+			`<row r="3"><c r="A3" t="s"><v>1</v></c><c r="B3" s="2"><v>12</v></c><c r="C3" s="1"><v>44252</v></c><c r="D3" s="3"><v>44252.4375</v></c></row>` +
+			`<row><c t="str"><v>formula</v></c><c><v>7</v></c></row>` +
+			`</sheetData></worksheet>`,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []struct {
+		row   int
+		cells []string
+	}{
+		{1, []string{"Company_Name", "", "Date"}},
+		{3, []string{"Rich Text", "12", "2021-02-25", "2021-02-25T10:30:00Z"}},
+		{4, []string{"formula", "7"}},
+	} {
+		row, cells, err := reader.next()
+		if err != nil || row != want.row || !reflect.DeepEqual(cells, want.cells) {
+			t.Errorf("got row %d %q, %v want %d %q", row, cells, err, want.row, want.cells)
+		}
+	}
+	if _, _, err = reader.next(); err != io.EOF {
+		t.Errorf("got %v after the last row", err)
+	}
+
+	for _, invalid := range [][]byte{nil, []byte("not a zip")} {
+		if _, err = newXLSXReader(invalid); err == nil {
+			t.Errorf("invalid workbook %q read", invalid)
+		}
+	}
+}
+
+func TestXLSXReaderLimits(t *testing.T) {
+
+	workbook := func(sheet string) []byte {
+		return zipWorkbook(map[string]string{
+			xlsxWorkbook: `<workbook xmlns="` + spreadsheetNS + `" xmlns:r="` + officeRelNS + `"><sheets><sheet name="Data" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+			xlsxWorkbookRel: `<Relationships xmlns="` + relationshipNS + `">` +
+				`<Relationship Id="rId1" Type="` + officeRelNS + `/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`,
+			xlsxSheetPart: `<worksheet xmlns="` + spreadsheetNS + `"><sheetData>` + sheet + `</sheetData></worksheet>`,
+		})
+	}
+
+	// the columns end at XFD
+	if got := xlsxColumnIndex("XFD1"); got != xlsxMaxColumns-1 {
+		t.Errorf("got column %d for XFD", got)
+	}
+	for _, ref := range []string{"XFE1", strings.Repeat("Z", 20) + "1"} {
+		reader, err := newXLSXReader(workbook(`<row><c r="` + ref + `"><v>1</v></c></row>`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err = reader.next(); err == nil || !strings.Contains(err.Error(), "invalid cell reference") {
+			t.Errorf("%.10s: got %v", ref, err)
+		}
+	}
+
+	// a part inflating past maxXLSXPartBytes fails the import
+	reader, err := newXLSXReader(workbook(`<row><c t="str"><v>Client_ID</v></c><c t="str"><v>Company_ID</v></c><c t="str"><v>Company_Name</v></c></row>` + strings.Repeat(" ", maxXLSXPartBytes) + `<row><c><v>2</v></c></row>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = readImportRows(reader, nil, &importReport{}); !errors.Is(err, errInvalidImport) || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("oversized part got %v", err)
+	}
+}
+
+func TestXLSXDateSerials(t *testing.T) {
+
+	// the serials of the date style are bounded to the days spreadsheets write
+	reader := &xlsxReader{dateStyles: []bool{false, true}}
+	for value, want := range map[string]string{
+		"0":            "1899-12-30",
+		"44252.4375":   "2021-02-25T10:30:00Z",
+		"2958465":      "9999-12-31",
+		"2958465.5":    "9999-12-31T12:00:00Z",
+		"-1":           "",
+		"2958466":      "",
+		"1e300":        "",
+		"NaN":          "",
+		"not a serial": "",
+	} {
+		got, err := reader.cellText("n", 1, value, xlsxText{})
+		if got != want || (err == nil) != (want != "") {
+			t.Errorf("serial %s got %q, %v want %q", value, got, err, want)
+		}
+	}
+}
+
+// zipWorkbook zips the parts of a workbook
+func zipWorkbook(parts map[string]string) []byte {
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range parts {
+		entry, _ := archive.Create(name)
+		io.WriteString(entry, content)
+	}
+	archive.Close()
+	return buf.Bytes()
+}
+
+func TestIsDateFormat(t *testing.T) {
+
+	for code, want := range map[string]bool{
+		"yyyy-mm-dd":          true,
+		"d/m/yy h:mm":         true,
+		"[$-409]mmmm d, yyyy": true,
+		"General":             false,
+		"0.00":                false,
+		`#,##0 "days"`:        false,
+		`0\d`:                 false,
+		"[Red]0":              false,
+	} {
+		if got := isDateFormat(code); got != want {
+			t.Errorf("%s: got %v want %v", code, got, want)
+		}
+	}
+}
+
+func TestImportCommand(t *testing.T) {
+
+	app := initTestModule(t, "memory")
+	dir := t.TempDir()
+
+	file := filepath.Join(dir, "companies.CSV")
+	os.WriteFile(file, []byte("Client,Company_ID,Company_Name\n2399029309,1,A\n2399029309,2,\n"), 0o600)
+	errorsFile := filepath.Join(dir, "errors.csv")
+
+	var out bytes.Buffer
+	err := runImportCommand(context.Background(), app, []string{"-map", "Client=Client_ID", "-errors", errorsFile, file}, &out)
+	if err == nil || err.Error() != "1 of 2 rows were not loaded" {
+		t.Errorf("got %v", err)
+	}
+	if !strings.HasPrefix(out.String(), "rows 2, valid 1, loaded 1 in 1 chunks, failed 1\n") {
+		t.Errorf("got output %q", out.String())
+	}
+	errorCSV, _ := os.ReadFile(errorsFile)
+	if want := "row,Company_ID,field,code,message\n3,2,Company_Name,required,must not be empty\n"; string(errorCSV) != want {
+		t.Errorf("got error file %q want %q", errorCSV, want)
+	}
+	if _, err = app.Store.Get(context.Background(), 1); err != nil {
+		t.Errorf("imported company missing: %v", err)
+	}
+
+	// a dry run loads nothing, invalid commands fail before reading
+	out.Reset()
+	os.WriteFile(file, []byte("Client_ID,Company_ID,Company_Name\n2399029309,3,C\n"), 0o600)
+	if err = runImportCommand(context.Background(), app, []string{"-dry-run", file}, &out); err != nil {
+		t.Errorf("dry run got %v", err)
+	}
+	if _, err = app.Store.Get(context.Background(), 3); err != ErrCompanyNotFound {
+		t.Errorf("dry run loaded the company: %v", err)
+	}
+	for _, args := range [][]string{nil, {"-chunk-size", "0", file}, {filepath.Join(dir, "companies.txt")}, {filepath.Join(dir, "missing.csv")}} {
+		if err = runImportCommand(context.Background(), app, args, io.Discard); err == nil {
+			t.Errorf("%q imported", args)
+		}
+	}
+}
@@ -1,465 +1,694 @@
-/*
-REST API DEMO
-
-Methods :
-createNewCompany, returnAllCompany, returnSingleCompany, updateCompany, homepage, deleteCompany, handleRequests, connectToDB, main
-*/
-package main
-
-import (
-	"database/sql"
-	"encoding/json"
-	"fmt"
-	"log"
-	"net/http"
-	"os"
-
-	_ "github.com/go-sql-driver/mysql"
-	"github.com/gorilla/mux"
-	_ "github.com/lib/pq"
-)
-
-type (
-
-	// App controlls the rest API demo app
-	App struct {
-		DBType   string
-		Router   *mux.Router
-		Database *sql.DB
-		logger   *log.Logger
-	}
-
-	// Company contains the data to be details for data to be stored into DB
-	// prepare Company data
-
-	Company struct {
-		Client_ID          int    `json:"Client_ID"`
-		Company_ID         int    `json:"Company_ID"`
-		Company_Name       string `json:"Company_Name"`
-		ASIC               string `json:"ASIC"`
-		Flight_Risk_Status string `json:"Flight_Risk_Status"`
-		Recruit_Status     string `json:"Recruit_Status"`
-		Total_Flight_Risk  string `json:"Total_Flight_Risk"`
-		Total_Backfill     string `json:"Total_Backfill"`
-		Create_Date        string `json:"Create_Date"`
-		Last_Update        string `json:"Last_Update"`
-		Data_As_Of_Date    string `json:"Data_As_Of_Date"`
-	}
-)
-
-//	POST /createNewCompany
-//	payload : Company struct
-//
-// creates new Company entry to DB
-func (app *App) createNewCompany(w http.ResponseWriter, r *http.Request) {
-
-	var (
-		query   string
-		Company Company
-	)
-
-	app.logger.Println("Endpoint hit : createNewCompany")
-	// get the payload from request
-	err := json.NewDecoder(r.Body).Decode(&Company)
-	if err != nil {
-		app.logger.Println(err)
-	}
-
-	if app.DBType == "mysql" {
-		query = "INSERT INTO Company_Detail (Client_ID, Company_ID, Company_Name, ASIC, Flight_Risk_Status, Recruit_Status, Total_Flight_Risk, Total_Backfill, Create_Date, Last_Update, Data_as_of_Date) VALUES (?,?,?,?,?,?,?,?,?,?,?)"
-	} else if app.DBType == "postgres" {
-		query = "INSERT INTO Company_Detail (title, descr, content) VALUES ($1,$2,$3)"
-	}
-
-	// insert data into DB
-	response, err := app.Database.Exec(query, Company.Client_ID, Company.Company_ID, Company.Company_Name)
-	// if there is an error inserting, handle it
-	if err != nil {
-		app.logger.Println(err.Error())
-		return
-	}
-	app.logger.Print(response.RowsAffected())
-	app.logger.Println("inserted new record to DB")
-
-	// return the added Company
-	json.NewEncoder(w).Encode(Company)
-}
-
-//	GET /returnAllCompany_Detail
-//	query params : id (last displayed ID for pagination), limit (max entry count in display)
-//	response     : Company struct array
-//
-// get all the Company_Detail from DB
-func (app *App) returnAllCompany_Detail(w http.ResponseWriter, r *http.Request) {
-
-	var (
-		query          string
-		queryParams    []interface{}
-		Company_Detail []Company
-	)
-
-	app.logger.Println("Endpoint hit : returnAllCompany_Detail")
-
-	// get the id and limit from param
-	lastID := r.URL.Query().Get("id")
-	limit := r.URL.Query().Get("limit")
-
-	// if last id is empty, set as 0
-	if lastID == "" {
-		lastID = "0"
-	}
-
-	// if limti is empty, get all entries else get all entries with limit
-	if limit == "" {
-
-		if app.DBType == "mysql" {
-			query = "SELECT * FROM Company_Detail WHERE Company_ID > ? ORDER BY Company_ID ASC"
-		} else if app.DBType == "postgres" {
-			query = "SELECT * FROM Company_Detail WHERE id > $1 ORDER BY id ASC"
-		}
-		queryParams = append(queryParams, lastID)
-	} else {
-
-		if app.DBType == "mysql" {
-			query = "SELECT * FROM Company_Detail WHERE Company_ID > ? ORDER BY Company_ID ASC LIMIT ?"
-		} else if app.DBType == "postgres" {
-			query = "SELECT * FROM Company_Detail WHERE id > $1 ORDER BY id ASC LIMIT $2"
-		}
-		queryParams = append(queryParams, lastID, limit)
-	}
-	app.logger.Println(query, queryParams)
-
-	// insert data into DB
-	response, err := app.Database.Query(
-		query,
-		queryParams...,
-	)
-	// if there is an error inserting, handle it
-	if err != nil {
-		app.logger.Println(err.Error())
-		return
-	}
-	defer response.Close()
-
-	// get all records until all are read
-	for response.Next() {
-
-		var Company Company
-
-		// get data from DB for Company fields
-		err = response.Scan(
-			&Company.Client_ID,
-			&Company.Company_ID,
-			&Company.Company_Name,
-			&Company.ASIC,
-		)
-		// if there is an error inserting, handle it
-		if err != nil {
-			app.logger.Println(err.Error())
-			return
-		}
-
-		// append to final list of Company_Detail
-		Company_Detail = append(Company_Detail, Company)
-	}
-	app.logger.Printf("Company : %+v\n", Company_Detail)
-
-	// generate JSON resopnse
-	err = json.NewEncoder(w).Encode(Company_Detail)
-	if err != nil {
-		app.logger.Println(err)
-	}
-	app.logger.Println("Endpoint hit : return all Company_Detail")
-}
-
-//	GET /returnSingleCompany/{id}
-//	url params : id (Company ID to be retrieved)
-//	response   : Company struct
-//
-// return a selected Company value from DB
-func (app *App) returnSingleCompany(w http.ResponseWriter, r *http.Request) {
-
-	var (
-		query   string
-		Company Company
-	)
-
-	app.logger.Println("Endpoint hit : returnSingleCompany")
-	// get url path parameters
-	vars := mux.Vars(r)
-	key := vars["id"]
-
-	if app.DBType == "mysql" {
-		query = "SELECT * FROM Company_Detail WHERE Company_ID=?"
-	} else if app.DBType == "postgres" {
-		query = "SELECT * FROM Company_Detail WHERE id=$1"
-	}
-
-	// insert data into DB
-	response, err := app.Database.Query(query, key)
-	// if there is an error inserting, handle it
-	if err != nil {
-		app.logger.Println(err.Error())
-		return
-	}
-	defer response.Close()
-
-	// iterate until entries from db are read
-	for response.Next() {
-
-		// scan and get Company fields value
-		err = response.Scan(
-			&Company.Client_ID,
-			&Company.Company_ID,
-			&Company.Company_Name,
-			&Company.ASIC,
-		)
-		// if there is an error inserting, handle it
-		if err != nil {
-			app.logger.Println(err.Error())
-			return
-		}
-	}
-	app.logger.Printf("Company : %+v\n", Company)
-
-	// if Company ID is not empty, return JSON response
-	if Company.Company_ID != 0 {
-		json.NewEncoder(w).Encode(Company)
-	} else {
-		http.Error(w, "no record", http.StatusNotFound)
-	}
-}
-
-//	PUT /updateCompany/{id}
-//	url params : id (Company ID to be retrieved)
-//
-// update the Company for a given Company ID
-func (app *App) updateCompany(w http.ResponseWriter, r *http.Request) {
-
-	var (
-		query          string
-		updatedCompany Company
-	)
-
-	app.logger.Println("Endpoint hit : updateCompany")
-	// get the path parameter
-	vars := mux.Vars(r)
-	key := vars["Company_ID"]
-
-	// get the payload data for Company
-	err := json.NewDecoder(r.Body).Decode(&updatedCompany)
-	if err != nil {
-		app.logger.Println(err)
-	}
-
-	if app.DBType == "mysql" {
-		query = "UPDATE Company_Detail SET Client_ID=? , Company_ID=?, Company_Name=?, ASIC=?, Flight_Risk_Status=?, Recruit_Status=?, Total_Flight_Risk=?, Total_Backfill=?, Create_Date=?, Last_Update=?, Data_as_of_Date=? WHERE id=?"
-	} else if app.DBType == "postgres" {
-		query = "UPDATE Company_Detail SET title=$1, descr=$2, content=$3 WHERE id=$4"
-	}
-
-	// update data in DB
-	response, err := app.Database.Exec(query, updatedCompany.Client_ID, updatedCompany.Company_ID, updatedCompany.Company_Name, key)
-	// if there is an error inserting, handle it
-	if err != nil {
-		app.logger.Println(err.Error())
-		return
-	}
-	app.logger.Print(response.RowsAffected())
-	app.logger.Println(" DB update performed.")
-
-	// return the JSON response for added Company
-	json.NewEncoder(w).Encode(updatedCompany)
-}
-
-//	DELETE /deleteCompany/{id}
-//	url params : id (Company ID to be retrieved)
-//
-// remove an Company from DB
-func (app *App) deleteCompany(w http.ResponseWriter, r *http.Request) {
-
-	var query string
-
-	app.logger.Println("Endpoint hit : deleteCompany")
-	// get url path parameter
-	vars := mux.Vars(r)
-	key := vars["Company_ID"]
-
-	if app.DBType == "mysql" {
-		query = "DELETE FROM Company_Detail WHERE Company_ID=?"
-	} else if app.DBType == "postgres" {
-		query = "DELETE FROM Company_Detail WHERE id=$1"
-	}
-
-	// insert data into DB
-	response, err := app.Database.Exec(query, key)
-	// if there is an error inserting, handle it
-	if err != nil {
-		app.logger.Println(err.Error())
-		return
-	}
-	app.logger.Print(response.RowsAffected())
-	app.logger.Println(" DB delete performed.")
-}
-
-//	ANY /homepage
-//
-// home page of web server
-func (app *App) homepage(w http.ResponseWriter, r *http.Request) {
-
-	app.logger.Println("Endpoint hit : homepage")
-	fmt.Fprint(w, `
-- POST /Company
-  - Add new Company to DB
-  - payload :
-    {
-		Client_ID 	(string)
-		Company_ID 	(string)
-		Company_Name (string)
-		ASIC 		(string)
-		Flight_Risk_Status (string)
-		Recruit_Status (string)
-		Total_Flight_Risk (string)
-		Total_Backfill   (string)
-		Create_Date (string)
-		Last_Update   (string)
-		Data_As_Of_Date  (string)
-    }
-
-- PUT /Company/{id}
-  - Update an existing Company DB
-  - query param : id (Company id from GET API)
-  - payload :
-  {
-	  Client_ID 	(string)
-	  Company_ID 	(string)
-	  Company_Name (string)
-	  ASIC 		(string)
-	  Flight_Risk_Status (string)
-	  Recruit_Status (string)
-	  Total_Flight_Risk (string)
-	  Total_Backfill   (string)
-	  Create_Date (string)
-	  Last_Update   (string)
-	  Data_As_Of_Date  (string)
-  }
-
-- DELETE /Company/{id}
-  - Deletes an entry from DB
-  - query param : id (Company id from GET API)
-
-- GET /Company/{id}
-  - Retrieves Company data from DB for a given ID
-  - query param : id (Company id from GET API) 
-
-- GET /Company_Detail
-  - retrives all Company_Detail from DB
-  - query params : id (last ID from previous GET call for pagination), limit (max entry per page)
-  - response : list of Company_Detail
-`)
-}
-
-// http handler methods init
-func handleRequests(app *App, port string) {
-
-	// start the gorilla mux router
-	app.Router = mux.NewRouter().StrictSlash(true)
-
-	// http routes
-	app.Router.HandleFunc("/", app.homepage)
-	app.Router.HandleFunc("/Company_Detail", app.returnAllCompany_Detail).Methods("GET")
-	app.Router.HandleFunc("/Company_Detail", app.createNewCompany).Methods("POST")
-	app.Router.HandleFunc("/Company_Detail/{Company_ID}", app.updateCompany).Methods("PUT")
-	app.Router.HandleFunc("/Company_Detail/{Company_ID}", app.deleteCompany).Methods("DELETE")
-	app.Router.HandleFunc("/Company_Detail/{Company_ID}", app.returnSingleCompany).Methods("GET")
-
-	// start the server on port
-	app.logger.Fatal(http.ListenAndServe(":"+port, app.Router))
-}
-
-// establish DB connection for mysql DB
-func connectToDB(dbType, connectionString string, logger *log.Logger) (db *sql.DB, err error) {
-
-	// establish new db connection
-	db, err = sql.Open(dbType, connectionString)
-
-	// if there is an error opening the connection, handle it
-	if err != nil {
-		logger.Println(err.Error())
-		return
-	}
-
-	// execute a ping on DB
-	err = db.Ping()
-
-	// if there is an error opening the connection, handle it
-	if err != nil {
-		logger.Println(err.Error())
-		return
-	}
-	logger.Println("Established "+dbType+" DB connection for ", connectionString)
-	return
-}
-
-// main function
-func main() {
-
-	var connectionString string
-
-	//dbType := flag.String("mysql")
-	//dbUser := flag.String("admin")
-	//dbPass := flag.String("44_FUNtime")
-	//dbHost := flag.String("happy1.cwkfm0ctmqb3.us-east-2.rds.amazonaws.com")
-	//dbPort := flag.String("3306")
-	//	dbName := flag.String("Happy1")
-	//	port := flag.String("7777")
-	//	flag.Parse()
-
-	// based on the db type set the connection string
-	const dbType = "mysql"
-
-	//	connectionString = fmt.Sprintf("%s:%s@tcp(%s:%s)/%s", *dbUser, *dbPass, *dbHost, *dbPort, *dbName)
-	connectionString = "admin:44_FUNtime@tcp(happy1.cwkfm0ctmqb3.us-east-2.rds.amazonaws.com:3306)/Happy1"
-
-	//} else if *dbType == "postgres" {
-
-	//	connectionString = fmt.Sprintf(
-	//		"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-	//		*dbHost, *dbPort, *dbUser, *dbPass, *dbName,
-	//	)
-	//}
-
-	// store the log file data to log file
-	logFile, _ := os.OpenFile(
-		"./restful_api.log",
-		os.O_TRUNC|os.O_CREATE|os.O_RDWR,
-		os.ModePerm,
-	)
-
-	logger := log.New(
-		logFile,
-		"INFO: ",
-		log.Ldate|log.Ltime|log.Lshortfile,
-	)
-
-	// connect to DB
-	dbConn, err := connectToDB("mysql", connectionString, logger)
-	if err != nil {
-		log.Println(err)
-	}
-
-	// set new router
-	app := &App{
-		DBType:   "mysql",
-		Router:   mux.NewRouter().StrictSlash(true),
-		Database: dbConn,
-		logger:   logger,
-	}
-
-	// defer the close till after the main function has finished
-	// executing
-	defer app.Database.Close()
-
-	// initialize the routes for rest API server
-	handleRequests(app, "7777")
-}
+/*
+REST API DEMO
+
+Methods :
+createNewCompany, returnAllCompany_Detail, returnSingleCompany, updateCompany, patchCompany, deleteCompany, upsertCompany, handleRequests, connectToDB, main
+
+the routes are listed in routes.go
+*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/gorilla/mux"
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+type (
+
+	// App controlls the rest API demo app
+	App struct {
+		DBType   string
+		Router   *mux.Router
+		Database *sql.DB
+		Store    CompanyStore
+		logger   *log.Logger
+
+		// cursorKey signs the list cursors
+		cursorKey []byte
+
+		// Idempotency replays the responses of repeated Idempotency-Key requests
+		// for idempotencyTTL
+		Idempotency    IdempotencyStore
+		idempotencyTTL time.Duration
+
+		// legacySunset is sent in the Sunset header of the legacy routes
+		legacySunset time.Time
+	}
+
+	// Company contains the data to be details for data to be stored into DB
+	// prepare Company data
+
+	Company struct {
+		Client_ID          int      `json:"Client_ID"`
+		Company_ID         int      `json:"Company_ID"`
+		Company_Name       string   `json:"Company_Name"`
+		ASIC               string   `json:"ASIC"`
+		Flight_Risk_Status string   `json:"Flight_Risk_Status"`
+		Recruit_Status     string   `json:"Recruit_Status"`
+		Total_Flight_Risk  NullInt  `json:"Total_Flight_Risk"`
+		Total_Backfill     NullInt  `json:"Total_Backfill"`
+		Create_Date        NullTime `json:"Create_Date"`
+		Last_Update        NullTime `json:"Last_Update"`
+		Data_As_Of_Date    NullDate `json:"Data_As_Of_Date"`
+
+		// nullText flags the text columns a store read as NULL, see nullTextBit.
+		// They hold "" but sort before it
+		nullText uint16
+	}
+)
+
+//	POST /Company_Detail
+//	payload : Company struct
+//
+// creates new Company entry to DB
+func (app *App) createNewCompany(w http.ResponseWriter, r *http.Request) {
+
+	var Company Company
+
+	app.logger.Println("Endpoint hit : createNewCompany")
+	// get the payload from request and validate it
+	if !app.readCompany(w, r, &Company) {
+		return
+	}
+
+	// insert data into DB
+	err := app.Store.Create(r.Context(), &Company)
+	// if there is an error inserting, handle it
+	if err != nil {
+		app.writeStoreError(w, r, err)
+		return
+	}
+	app.logger.Println("inserted new record to DB")
+
+	// return the added Company as stored with its version
+	app.writeStoredCompany(w, r, http.StatusOK, Company.Company_ID)
+}
+
+//	GET /Company_Detail
+//	query params : filters, sort, cursor, limit, total, fields and format, see the README
+//	response     : Company struct array, or a CSV, NDJSON or XLSX export
+//
+// get all the Company_Detail from DB
+func (app *App) returnAllCompany_Detail(w http.ResponseWriter, r *http.Request) {
+
+	var (
+		opts ListOptions
+		prev bool
+		err  error
+	)
+
+	app.logger.Println("Endpoint hit : returnAllCompany_Detail")
+
+	// get the sort, cursor, id, limit, total and fields from param
+	sortParam := r.URL.Query().Get("sort")
+	cursor := r.URL.Query().Get("cursor")
+	lastID := r.URL.Query().Get("id")
+	limit := r.URL.Query().Get("limit")
+	total := r.URL.Query().Get("total")
+
+	// if fields is empty, return every field
+	columns, err := parseFields(r.URL.Query().Get("fields"))
+	if err != nil {
+		app.writeProblem(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// JSON unless the format param or the Accept header ask for an export
+	w.Header().Add("Vary", "Accept")
+	format, err := negotiateFormat(r)
+	if err != nil {
+		app.writeFormatError(w, r, err)
+		return
+	}
+
+	// if sort is empty, order by Company_ID
+	if opts.Sort, err = parseSort(sortParam); err != nil {
+		app.writeProblem(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// resume from the cursor of an adjacent page, or after the last id when
+	// ordered by Company_ID
+	switch {
+	case cursor != "" && lastID != "":
+		app.writeProblem(w, r, http.StatusBadRequest, "cursor and id query params are exclusive")
+		return
+	case cursor != "":
+		if opts.After, prev, err = decodeCursor(app.cursorKey, opts.Sort, cursor); err != nil {
+			app.writeProblem(w, r, http.StatusBadRequest, "invalid cursor query param, it was altered or does not match the sort")
+			return
+		}
+	case lastID != "":
+		if sortParam != "" && sortParam != companyKeyColumn {
+			app.writeProblem(w, r, http.StatusBadRequest, "id query param needs the default sort, use cursor instead")
+			return
+		}
+		after := Company{}
+		if after.Company_ID, err = strconv.Atoi(lastID); err != nil {
+			app.writeProblem(w, r, http.StatusBadRequest, "invalid id query param : "+lastID)
+			return
+		}
+		opts.After = &after
+	}
+
+	// if limit is empty, get all entries else get all entries with limit
+	if limit != "" {
+		if opts.Limit, err = strconv.Atoi(limit); err != nil || opts.Limit < 0 {
+			app.writeProblem(w, r, http.StatusBadRequest, "invalid limit query param : "+limit)
+			return
+		}
+	}
+
+	// narrow the list with the filter params
+	if opts.Filter, err = parseCompanyFilter(r.URL.Query()); err != nil {
+		app.writeProblem(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// the total count is optional as it costs an extra query
+	withTotal := false
+	if total != "" {
+		if withTotal, err = strconv.ParseBool(total); err != nil {
+			app.writeProblem(w, r, http.StatusBadRequest, "invalid total query param : "+total)
+			return
+		}
+	}
+
+	// the cursors need the sort columns on top of the requested fields
+	sortColumns := make([]string, len(opts.Sort))
+	for i, key := range opts.Sort {
+		sortColumns[i] = key.Column
+	}
+	opts.Columns = withColumns(columns, sortColumns...)
+	app.logger.Printf("list options : %+v\n", opts)
+
+	// the exports stream the rows from the cursor on, the previous page would
+	// need them in reverse
+	if format != formatJSON {
+		if prev {
+			app.writeProblem(w, r, http.StatusBadRequest, "prev_cursor only pages JSON lists")
+			return
+		}
+		if withTotal {
+			count, err := app.Store.Count(r.Context(), opts.Filter)
+			if err != nil {
+				app.writeStoreError(w, r, err)
+				return
+			}
+			w.Header().Set("X-Total-Count", strconv.Itoa(count))
+		}
+		app.writeExport(w, r, format, columns, func(row func(company Company) error) error {
+			return app.Store.Each(r.Context(), opts, row)
+		})
+		return
+	}
+
+	// get the records from DB
+	page, err := app.listPage(r.Context(), opts, prev)
+	// if there is an error reading, handle it
+	if err != nil {
+		app.writeStoreError(w, r, err)
+		return
+	}
+	if withTotal {
+		count, err := app.Store.Count(r.Context(), opts.Filter)
+		if err != nil {
+			app.writeStoreError(w, r, err)
+			return
+		}
+		page.Total = &count
+	}
+	page.columns = columns
+	app.logger.Printf("Company : %+v\n", page.Items)
+
+	// generate JSON resopnse with links to the adjacent pages
+	setPageLinks(w, r, page)
+	app.writeJSON(w, http.StatusOK, page)
+	app.logger.Println("Endpoint hit : return all Company_Detail")
+}
+
+//	GET /Company_Detail/{Company_ID}
+//	url params : Company_ID (Company ID to be retrieved)
+//	response   : Company struct, or a CSV, NDJSON or XLSX export
+//
+// return a selected Company value from DB
+func (app *App) returnSingleCompany(w http.ResponseWriter, r *http.Request) {
+
+	app.logger.Println("Endpoint hit : returnSingleCompany")
+	// get url path parameters
+	key, ok := app.companyIDVar(w, r, "Company_ID")
+	if !ok {
+		return
+	}
+
+	// if fields is empty, return every field
+	columns, err := parseFields(r.URL.Query().Get("fields"))
+	if err != nil {
+		app.writeProblem(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// JSON unless the format param or the Accept header ask for an export
+	w.Header().Add("Vary", "Accept")
+	format, err := negotiateFormat(r)
+	if err != nil {
+		app.writeFormatError(w, r, err)
+		return
+	}
+
+	// read the Company from DB
+	Company, err := app.Store.Get(r.Context(), key, columns...)
+	// if there is an error reading, handle it
+	if err != nil {
+		app.writeStoreError(w, r, err)
+		return
+	}
+	app.logger.Printf("Company : %+v\n", Company)
+
+	// the client may already hold this version
+	view := companyView{Company, columns}
+	etag := formatETag(viewETag(view), format)
+	if notModified(w, r, etag) {
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+	if format != formatJSON {
+		app.writeExport(w, r, format, columns, singleCompany(Company))
+		return
+	}
+	app.writeJSON(w, http.StatusOK, view)
+}
+
+//	PUT /Company_Detail/{Company_ID}
+//	url params : Company_ID (Company ID to be replaced)
+//
+// update the Company for a given Company ID
+func (app *App) updateCompany(w http.ResponseWriter, r *http.Request) {
+
+	var updatedCompany Company
+
+	app.logger.Println("Endpoint hit : updateCompany")
+	// get the path parameter
+	key, ok := app.companyIDVar(w, r, "Company_ID")
+	if !ok {
+		return
+	}
+
+	// get the payload data for Company and validate it
+	if !app.readCompany(w, r, &updatedCompany) {
+		return
+	}
+
+	// update data in DB, if the client sent If-Match only over that version
+	err := app.Store.Update(r.Context(), key, &updatedCompany, ifMatch(r)...)
+	// if there is an error updating, handle it
+	if err != nil {
+		app.writeStoreError(w, r, err)
+		return
+	}
+	app.logger.Println(" DB update performed.")
+
+	// return the JSON response for the Company as stored with its new version
+	app.writeStoredCompany(w, r, http.StatusOK, updatedCompany.Company_ID)
+}
+
+//	PATCH /Company_Detail/{Company_ID}
+//	url params : Company_ID (Company ID to be patched)
+//	payload    : merge patch or JSON Patch document
+//
+// apply a partial update to a Company in DB
+func (app *App) patchCompany(w http.ResponseWriter, r *http.Request) {
+
+	var patchedCompany Company
+
+	app.logger.Println("Endpoint hit : patchCompany")
+	// get the path parameter
+	key, ok := app.companyIDVar(w, r, "Company_ID")
+	if !ok {
+		return
+	}
+
+	// the content type tells merge-patch from JSON Patch documents
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != mergePatchType && mediaType != jsonPatchType {
+		w.Header().Set("Accept-Patch", mergePatchType+", "+jsonPatchType)
+		app.writeProblem(w, r, http.StatusUnsupportedMediaType, "PATCH needs a "+mergePatchType+" or "+jsonPatchType+" body")
+		return
+	}
+
+	// read the current Company from DB
+	currentCompany, err := app.Store.Get(r.Context(), key)
+	if err != nil {
+		app.writeStoreError(w, r, err)
+		return
+	}
+
+	// the patch must be applied to the version the client expects
+	if header := r.Header.Get("If-Match"); header != "" && !etagMatch(header, companyETag(currentCompany), false) {
+		app.writeStoreError(w, r, errPreconditionFailed)
+		return
+	}
+
+	// apply the patch, failed tests or missing paths conflict with the record
+	patched, err := applyPatch(mediaType, currentCompany, r.Body)
+	if err != nil {
+		var conflict patchConflict
+		if errors.As(err, &conflict) {
+			app.writeProblem(w, r, http.StatusConflict, "patch cannot be applied : "+err.Error())
+		} else {
+			app.writeProblem(w, r, http.StatusBadRequest, "invalid patch : "+err.Error())
+		}
+		return
+	}
+
+	// the patched Company must pass the same rules as a PUT payload
+	if !app.readCompanyFrom(w, r, bytes.NewReader(patched), &patchedCompany) {
+		return
+	}
+	if patchedCompany.Company_ID != key {
+		app.writeProblemDetails(w, r, problem{
+			Status: http.StatusUnprocessableEntity,
+			Detail: "invalid company payload",
+			Errors: validationErrors{{"Company_ID", codeInvalidValue, "must not be changed by a patch"}},
+		})
+		return
+	}
+
+	// update only the changed columns in DB
+	columns := changedColumns(&currentCompany, &patchedCompany)
+	if len(columns) > 0 {
+		if err = app.Store.UpdateColumns(r.Context(), key, &patchedCompany, columns, ifMatch(r)...); err != nil {
+			app.writeStoreError(w, r, err)
+			return
+		}
+	}
+	app.logger.Printf(" DB patch performed on %v.\n", columns)
+
+	// return the JSON response for the patched Company as stored with its new version
+	app.writeStoredCompany(w, r, http.StatusOK, key)
+}
+
+//	PUT /clients/{Client_ID}/companies/{Company_ID}
+//	url params : Client_ID and Company_ID (keys of the Company to be inserted or replaced)
+//	payload    : Company struct, the keys default to the url params
+//
+// insert the Company of a client, or replace it if it exists
+func (app *App) upsertCompany(w http.ResponseWriter, r *http.Request) {
+
+	app.logger.Println("Endpoint hit : upsertCompany")
+	// get the path parameters
+	clientID, ok := app.companyIDVar(w, r, "Client_ID")
+	if !ok {
+		return
+	}
+	companyID, ok := app.companyIDVar(w, r, "Company_ID")
+	if !ok {
+		return
+	}
+
+	// get the payload data for Company and validate it, the keys of the path
+	// are used when the payload has none
+	company := Company{Client_ID: clientID, Company_ID: companyID}
+	if !app.readCompany(w, r, &company) {
+		return
+	}
+	var errs validationErrors
+	if company.Client_ID != clientID {
+		errs = append(errs, fieldError{"Client_ID", codeInvalidValue, "must match the path"})
+	}
+	if company.Company_ID != companyID {
+		errs = append(errs, fieldError{"Company_ID", codeInvalidValue, "must match the path"})
+	}
+	if len(errs) > 0 {
+		app.writeProblemDetails(w, r, problem{
+			Status: http.StatusUnprocessableEntity,
+			Detail: "invalid company payload",
+			Errors: errs,
+		})
+		return
+	}
+
+	// insert or update in DB in a single statement
+	created, err := app.Store.Upsert(r.Context(), &company)
+	if err != nil {
+		app.writeStoreError(w, r, err)
+		return
+	}
+
+	// return the JSON response for the Company with its version, 201 if it is new
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		w.Header().Set("Location", r.URL.Path)
+	}
+	app.logger.Printf(" DB upsert performed, created %t.\n", created)
+
+	app.writeStoredCompany(w, r, status, companyID)
+}
+
+//	DELETE /Company_Detail/{Company_ID}
+//	url params : Company_ID (Company ID to be deleted)
+//
+// remove an Company from DB
+func (app *App) deleteCompany(w http.ResponseWriter, r *http.Request) {
+
+	app.logger.Println("Endpoint hit : deleteCompany")
+	// get url path parameter
+	key, ok := app.companyIDVar(w, r, "Company_ID")
+	if !ok {
+		return
+	}
+
+	// delete data from DB, if the client sent If-Match only that version
+	err := app.Store.Delete(r.Context(), key, ifMatch(r)...)
+	// if there is an error deleting, handle it
+	if err != nil {
+		app.writeStoreError(w, r, err)
+		return
+	}
+	app.logger.Println(" DB delete performed.")
+}
+
+// companyIDVar parses the Company ID path variable, answering 400 if it is not a number
+func (app *App) companyIDVar(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+
+	value := mux.Vars(r)[name]
+	key, err := strconv.Atoi(value)
+	if err != nil {
+		app.writeProblem(w, r, http.StatusBadRequest, "invalid "+name+" path param : "+value)
+		return 0, false
+	}
+	return key, true
+}
+
+// http handler methods init
+func handleRequests(app *App, addr string) {
+
+	// register the route table
+	app.Router = app.newRouter()
+
+	// start the server on the listen address, tagging every request with an id
+	app.logger.Fatal(http.ListenAndServe(addr, withRequestID(app.Router)))
+}
+
+// establish DB connection for mysql DB
+func connectToDB(dbType, connectionString string, logger *log.Logger) (db *sql.DB, err error) {
+
+	connector, err := newDSNConnector(dbType, connectionString)
+	if err != nil {
+		logger.Println(err.Error())
+		return
+	}
+	return openDB(dbType, connector, logger)
+}
+
+// establish DB connection through a connector, the connection string is never
+// logged as it holds the DB password
+func openDB(dbType string, connector *dsnConnector, logger *log.Logger) (db *sql.DB, err error) {
+
+	// establish new db connection
+	db = sql.OpenDB(connector)
+
+	// execute a ping on DB
+	err = db.Ping()
+
+	// if there is an error opening the connection, handle it
+	if err != nil {
+		logger.Println(err.Error())
+		return
+	}
+	logger.Println("Established " + dbType + " DB connection")
+	return
+}
+
+// main function
+func main() {
+
+	// resolve the config from flags, APP_* env variables and the config file
+	cfg, args, err := loadConfig(os.Args[1:], os.Getenv)
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// dump the config with secrets hidden instead of serving
+	if cfg.PrintConfig {
+		if err = cfg.print(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// store the log file data to log file, or stderr if no file is set
+	logFile := os.Stderr
+	if cfg.LogFile != "" {
+		logFile, err = os.OpenFile(
+			cfg.LogFile,
+			os.O_TRUNC|os.O_CREATE|os.O_RDWR,
+			os.ModePerm,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	logger := log.New(
+		logFile,
+		cfg.LogPrefix,
+		log.Ldate|log.Ltime|log.Lshortfile,
+	)
+
+	// "migrate <up|down|status>" runs a migrate command instead of the server
+	migrateCommand, runMigrate := "", len(args) > 0 && args[0] == "migrate"
+	if runMigrate && len(args) > 1 {
+		migrateCommand = args[1]
+	}
+
+	// "import <file>" loads a CSV or XLSX file of companies instead of serving
+	runImport := len(args) > 0 && args[0] == "import"
+
+	// connect to DB, the in-memory store needs no connection
+	var dbConn *sql.DB
+	if cfg.DBType == "memory" && runMigrate {
+		log.Fatal("the memory store has no schema to migrate")
+	}
+	if cfg.DBType == "memory" && runImport {
+		log.Fatal("the memory store would lose the imported companies on exit")
+	}
+	if cfg.DBType != "memory" {
+
+		// read the DB credentials from the password / credentials files
+		if err = loadSecrets(&cfg); err != nil {
+			log.Fatal(err)
+		}
+		if err = cfg.checkDB(); err != nil {
+			log.Fatal(err)
+		}
+
+		connector, err := newDSNConnector(cfg.DBType, cfg.connectionString())
+		if err != nil {
+			log.Fatal(err)
+		}
+		dbConn, err = openDB(cfg.DBType, connector, logger)
+		if err != nil {
+			log.Println(err)
+		}
+		defer dbConn.Close()
+		dbConn.SetMaxIdleConns(cfg.DBMaxIdleConns)
+
+		// rotated credentials are picked up on SIGHUP without a restart. SQLite
+		// has no credentials and reopening a :memory: DB would lose it
+		if cfg.DBType == "mysql" || cfg.DBType == "postgres" {
+			reloadSecretsOnSIGHUP(cfg, connector, dbConn, logger)
+		}
+
+		// run the migrate command on demand, or bring the schema up to date
+		if runMigrate || cfg.Migrate {
+			migrator, err := newMigrator(cfg.DBType, dbConn)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			if runMigrate {
+				if err = runMigrateCommand(context.Background(), migrator, migrateCommand, os.Stdout); err != nil {
+					log.Fatal(err)
+				}
+				return
+			}
+
+			if err = runMigrateCommand(context.Background(), migrator, "up", logger.Writer()); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	// pick the Company store for the DB type
+	store, err := newCompanyStore(cfg.DBType, dbConn)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// sign the list cursors with the configured key, so they survive restarts
+	cursorKey := []byte(cfg.CursorSecret)
+	if len(cursorKey) == 0 {
+		if cursorKey, err = newCursorKey(); err != nil {
+			log.Fatal(err)
+		}
+		logger.Println("no cursor secret configured, list cursors expire on restart")
+	}
+
+	// the TTL and sunset were validated by loadConfig
+	idempotencyTTL, err := time.ParseDuration(cfg.IdempotencyTTL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	idempotency, err := newIdempotencyStore(cfg.DBType, dbConn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	legacySunset, err := time.Parse(dateLayout, cfg.LegacySunset)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// set new router
+	app := &App{
+		DBType:    cfg.DBType,
+		Database:  dbConn,
+		Store:     store,
+		logger:    logger,
+		cursorKey: cursorKey,
+
+		Idempotency:    idempotency,
+		idempotencyTTL: idempotencyTTL,
+		legacySunset:   legacySunset,
+	}
+
+	// run the import command on demand
+	if runImport {
+		if err = runImportCommand(context.Background(), app, args[1:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// initialize the routes for rest API server
+	handleRequests(app, cfg.Listen)
+}
@@ -2,21 +2,44 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"flag"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
-//const PostgresConn = "host=localhost port=5432 user=postgres password=mysecretpassword dbname=postgres sslmode=disable"
-const MySQLConn = "admin:44_FUNtime@tcp(happy1.cwkfm0ctmqb3.us-east-2.rds.amazonaws.com:3306)/Happy1"
+const PostgresConn = "host=localhost port=5432 user=postgres password=mysecretpassword dbname=postgres sslmode=disable"
+
+// MySQLConn is read from TEST_MYSQL_CONN, the DB password must not be committed
+var MySQLConn = os.Getenv("TEST_MYSQL_CONN")
+
+// live enables the tests against the MySQL (TEST_MYSQL_CONN) and Postgres instances, by default
+// only the in-memory and SQLite stores are exercised
+var live = flag.Bool("live", false, "run tests against live mysql and postgres DBs")
+
+// testDBTypes returns the DB types the handler tests run against
+func testDBTypes() []string {
+
+	if *live {
+		return []string{"memory", "sqlite", "mysql", "postgres"}
+	}
+	return []string{"memory", "sqlite"}
+}
 
 func TestConnectToDB(t *testing.T) {
 
+	if !*live {
+		t.Skip("live DB tests disabled, run with -live")
+	}
+
 	logFile, _ := os.OpenFile(
 		"./restful_api.log",
 		os.O_TRUNC|os.O_CREATE|os.O_RDWR,
@@ -34,14 +57,14 @@ func TestConnectToDB(t *testing.T) {
 	dbConn.Close()
 
 	// negative case for mysql DB conn
-	dbConn, err = connectToDB("mysql", "admin:44_FUNtime@tcp(happy1.cwkfm0ctmqb3.us-east-2.rds.amazonaws.com:3306)/Happy1", logger)
+	dbConn, err = connectToDB("mysql", "unknown:unknown@tcp(happy1.cwkfm0ctmqb3.us-east-2.rds.amazonaws.com:3306)/Happy1", logger)
 	if err == nil || dbConn.Ping() == nil {
 		t.Errorf("DB Connection established for wrong user name / password")
 		dbConn.Close()
 	}
 
 	// negative case for mysql DB conn
-	dbConn, err = connectToDB("mysql", "admin:44_FUNtime@tcp(happy1.cwkfm0ctmqb3.us-east-2.rds.amazonaws.com:3306)/Happy1", logger)
+	dbConn, err = connectToDB("mysql", "unknown:unknown@tcp(happy1.cwkfm0ctmqb3.us-east-2.rds.amazonaws.com:1234)/Happy1", logger)
 	if err == nil || dbConn.Ping() == nil {
 		t.Errorf("DB Connection established for db host/port")
 	}
@@ -69,7 +92,7 @@ func TestConnectToDB(t *testing.T) {
 	dbConn.Close()
 }
 
-func initTestModule(db, connectionString string) (app *App) {
+func initTestModule(t *testing.T, db string) (app *App) {
 
 	logFile, _ := os.OpenFile(
 		"./restful_api.log",
@@ -80,74 +103,76 @@ func initTestModule(db, connectionString string) (app *App) {
 	logger := log.New(logFile, "INFO: ",
 		log.Ldate|log.Ltime|log.Lshortfile)
 
-	// connect to DB
-	dbConn, err := connectToDB(db, connectionString, logger)
-	if err != nil {
-		log.Println(err)
+	// connect to DB, the in-memory store needs no connection
+	var connectionString string
+	switch db {
+	case "mysql":
+		connectionString = MySQLConn
+	case "postgres":
+		connectionString = PostgresConn
+	case "sqlite":
+		connectionString = ":memory:"
 	}
 
-	// set new router
 	app = &App{
-		DBType:   db,
-		Router:   mux.NewRouter().StrictSlash(true),
-		Database: dbConn,
-		logger:   logger,
+		DBType:    db,
+		logger:    logger,
+		cursorKey: []byte("test cursor secret"),
 	}
 
+	if connectionString != "" {
+		dbConn, err := connectToDB(db, connectionString, logger)
+		// if db connection fails, add as fatal error
+		if err != nil {
+			t.Fatal(err)
+		}
+		app.Database = dbConn
+		t.Cleanup(func() { dbConn.Close() })
+
+		// bring the schema up to date
+		migrator, err := newMigrator(db, dbConn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = migrator.Up(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store, err := newCompanyStore(db, app.Database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.Store = store
+
+	if app.Idempotency, err = newIdempotencyStore(db, app.Database); err != nil {
+		t.Fatal(err)
+	}
+	app.idempotencyTTL = time.Hour
+	app.Router = app.newRouter()
+
 	return
 }
 
-func TestHomepage(t *testing.T) {
+// testCompany returns a Company payload used by the handler tests
+func testCompany(companyID int) Company {
+
+	return Company{
+		Client_ID:          2399029309,
+		Company_ID:         companyID,
+		Company_Name:       "TEST_GO",
+		ASIC:               "1234",
+		Flight_Risk_Status: "High",
+		Recruit_Status:     "Open",
+		Total_Flight_Risk:  newNullInt(1234),
+		Total_Backfill:     newNullInt(12345),
+		Create_Date:        newNullTime(time.Date(2021, 2, 25, 0, 0, 0, 0, time.UTC)),
+		Last_Update:        newNullTime(time.Date(2021, 2, 25, 10, 30, 0, 0, time.UTC)),
+		Data_As_Of_Date:    newNullDate(time.Date(2021, 2, 25, 0, 0, 0, 0, time.UTC)),
+	}
+}
 
-	const homepageResponse = `
-- POST /company
-  - Add new article to DB
-  - payload :
-    {
-		Client_ID 	(string)
-		Company_ID 	(string)
-		Company_Name (string)
-		ASIC 		(string)
-		Flight_Risk_Status (string)
-		Recruit_Status (string)
-		Total_Flight_Risk (string)
-		Total_Backfill   (string)
-		Create_Date (string)
-		Last_Update   (string)
-		Data_As_Of_Date  (string)
-    }
-
-- PUT /company/{id}
-  - Update an existing article DB
-  - query param : id (article id from GET API)
-  - payload :
-    {
-		Client_ID 	(string)
-		Company_ID 	(string)
-		Company_Name (string)
-		ASIC 		(string)
-		Flight_Risk_Status (string)
-		Recruit_Status (string)
-		Total_Flight_Risk (string)
-		Total_Backfill   (string)
-		Create_Date (string)
-		Last_Update   (string)
-		Data_As_Of_Date  (string)
-    }
-
-- DELETE /company/{id}
-  - Deletes an entry from DB
-  - query param : id (article id from GET API)
-
-- GET /company/{id}
-  - Retrieves article data from DB for a given ID
-  - query param : id (article id from GET API) 
-
-- GET /company
-  - retrives all articles from DB
-  - query params : id (last ID from previous GET call for pagination), limit (max entry per page)
-  - response : list of articles
-`
+func TestHomepage(t *testing.T) {
 
 	// creating new request to homepage
 	req, err := http.NewRequest("GET", "/", nil)
@@ -155,13 +180,8 @@ func TestHomepage(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	// start the DB connection and router for app
-	app := initTestModule("mysql", MySQLConn)
-
-	// if db connection fails, add as fatal error
-	if app.Database == nil || app.Database.Ping() != nil {
-		t.Fatal(err)
-	}
+	// start the router for app
+	app := initTestModule(t, "memory")
 
 	// new recorder for capturing response from request
 	rr := httptest.NewRecorder()
@@ -176,163 +196,241 @@ func TestHomepage(t *testing.T) {
 			status, http.StatusOK)
 	}
 
-	// Check the response string matches expected response
-	if rr.Body.String() != homepageResponse {
-		t.Errorf("handler returned unexpected body: got %v want %v",
-			rr.Body.String(), homepageResponse)
+	// Check the response lists every route, one per line
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	if len(lines) != len(routes())+2 {
+		t.Fatalf("handler returned %d lines want %d : %s", len(lines), len(routes())+2, rr.Body)
+	}
+	for i, rt := range routes() {
+		if fields := strings.Fields(lines[i+2]); len(fields) < 3 || fields[0] != rt.method || fields[1] != rt.path {
+			t.Errorf("handler listed %q want %s %s", lines[i+2], rt.method, rt.path)
+		}
 	}
 }
 
 func TestCreateNewCompany(t *testing.T) {
 
-	for _, dbType := range []string{"mysql", "postgres"} {
-
-		var (
-			connectionString string
-			responseArticle  company
-		)
+	for _, dbType := range testDBTypes() {
 
-		if dbType == "mysql" {
-			connectionString = MySQLConn
-		} else {
-			connectionString = PostgresConn
-		}
+		var responseCompany Company
 
 		// start the DB connection and router for app
-		app := initTestModule(
-			dbType,
-			connectionString,
-		)
-
-		// prepare article data
-		company := Company{
-			Client_ID 	"2399029309299"
-			Company_ID 	"21271d86-baf1-40c3-b803-77b526f8e4c5"
-			Company_Name "TEST_GO"
-			ASIC 		"1234"
-			Flight_Risk_Status "Test"
-			Recruit_Status "Test"
-			Total_Flight_Risk "1234"
-			Total_Backfill   "12345"
-			Create_Date "2021-02-25"
-			Last_Update   "2021-02-25"
-			Data_As_Of_Date  "2021-02-25"
-		}
+		app := initTestModule(t, dbType)
 
-		// convert the article data as json
+		// prepare company data
+		company := testCompany(1)
+
+		// convert the company data as json
 		payload, err := json.Marshal(company)
 		if err != nil {
 			t.Fatal(err)
 		}
 
-		// creating new request to homepage
-		req, err := http.NewRequest("POST", "/company", bytes.NewBuffer(payload))
+		// creating new request to create a company
+		req, err := http.NewRequest("POST", "/Company_Detail", bytes.NewBuffer(payload))
 		if err != nil {
 			t.Fatal(err)
 		}
 
-		// if db connection fails, add as fatal error
-		if app.Database == nil || app.Database.Ping() != nil {
+		// new recorder for capturing response from request
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(app.createNewCompany)
+
+		// serve http call on request
+		handler.ServeHTTP(rr, req)
+
+		// checking http status code if 200
+		if status := rr.Code; status != http.StatusOK {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				dbType, status, http.StatusOK)
+		}
+
+		// decode the response body to a new company struct
+		json.NewDecoder(rr.Body).Decode(&responseCompany)
+
+		// Check the response matches the created company
+		if responseCompany != company {
+			t.Errorf("%s: handler returned unexpected body: got %+v want %+v",
+				dbType, responseCompany, company)
+		}
+
+		// Check every field got persisted
+		stored, err := app.Store.Get(req.Context(), company.Company_ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameCompany(stored, company) {
+			t.Errorf("%s: stored unexpected company: got %+v want %+v",
+				dbType, stored, company)
+		}
+	}
+}
+
+func TestReturnAllCompany_Detail(t *testing.T) {
+
+	for _, dbType := range testDBTypes() {
+
+		var responsePage companyPage
+
+		// start the DB connection and router for app
+		app := initTestModule(t, dbType)
+
+		// seed companies out of order
+		for _, companyID := range []int{3, 1, 2} {
+			company := testCompany(companyID)
+			if err := app.Store.Create(context.Background(), &company); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// creating new request for the page after ID 1
+		req, err := http.NewRequest("GET", "/Company_Detail?id=1&limit=1", nil)
+		if err != nil {
 			t.Fatal(err)
 		}
 
 		// new recorder for capturing response from request
 		rr := httptest.NewRecorder()
-		handler := http.HandlerFunc(app.createNewArticle)
+		handler := http.HandlerFunc(app.returnAllCompany_Detail)
 
 		// serve http call on request
 		handler.ServeHTTP(rr, req)
 
 		// checking http status code if 200
 		if status := rr.Code; status != http.StatusOK {
-			t.Errorf("handler returned wrong status code: got %v want %v",
-				status, http.StatusOK)
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				dbType, status, http.StatusOK)
 		}
 
-		// decode the response body to a new article struct
-		json.NewDecoder(rr.Body).Decode(&responseArticle)
+		// decode the response body to a company page
+		json.NewDecoder(rr.Body).Decode(&responsePage)
 
-		// Check the response string matches expected response
-		if responseCompany.Id != 0 && responseCompany.Company_Name != company.Company_Name {
-			t.Errorf("handler returned unexpected body: got %+v want %+v",
-				responseCompany, company)
+		// Check the page holds the next company only
+		if len(responsePage.Items) != 1 || responsePage.Items[0].Company_ID != 2 || !responsePage.HasMore {
+			t.Errorf("%s: handler returned unexpected body: got %+v want company 2 with more",
+				dbType, responsePage)
 		}
 	}
 }
 
-func TestReturnAllArticles(t *testing.T) {
+func TestReturnSingleCompany(t *testing.T) {
 
-	for _, dbType := range []string{"mysql", "postgres"} {
+	for _, dbType := range testDBTypes() {
 
-		var (
-			connectionString string
-			responseCompany  company
-		)
+		// start the DB connection and router for app
+		app := initTestModule(t, dbType)
 
-		if dbType == "mysql" {
-			connectionString = MySQLConn
-		} else {
-			connectionString = PostgresConn
+		company := testCompany(1)
+		if err := app.Store.Create(context.Background(), &company); err != nil {
+			t.Fatal(err)
 		}
 
-		// start the DB connection and router for app
-		app := initTestModule(
-			dbType,
-			connectionString,
-		)
-
-		// prepare article data
-		company := Company{
-			Client_ID 	"2399029309299"
-			Company_ID 	"21271d86-baf1-40c3-b803-77b526f8e4c5"
-			Company_Name "TEST_GO"
-			ASIC 		"1234"
-			Flight_Risk_Status "Test"
-			Recruit_Status "Test"
-			Total_Flight_Risk "1234"
-			Total_Backfill   "12345"
-			Create_Date "2021-02-25"
-			Last_Update   "2021-02-25"
-			Data_As_Of_Date  "2021-02-25"
+		for id, want := range map[string]int{"1": http.StatusOK, "2": http.StatusNotFound} {
+
+			req, err := http.NewRequest("GET", "/Company_Detail/"+id, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req = mux.SetURLVars(req, map[string]string{"Company_ID": id})
+
+			// new recorder for capturing response from request
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(app.returnSingleCompany)
+
+			// serve http call on request
+			handler.ServeHTTP(rr, req)
+
+			// checking http status code
+			if status := rr.Code; status != want {
+				t.Errorf("%s: handler returned wrong status code for %s: got %v want %v",
+					dbType, id, status, want)
+			}
 		}
+	}
+}
 
-		// convert the article data as json
-		payload, err := json.Marshal(article)
-		if err != nil {
+func TestUpdateAndDeleteCompany(t *testing.T) {
+
+	for _, dbType := range testDBTypes() {
+
+		// start the DB connection and router for app
+		app := initTestModule(t, dbType)
+
+		company := testCompany(1)
+		if err := app.Store.Create(context.Background(), &company); err != nil {
 			t.Fatal(err)
 		}
 
-		// creating new request to homepage
-		req, err := http.NewRequest("GET", "/company", bytes.NewBuffer(payload))
+		// update the company name
+		company.Company_Name = "TEST_GO_UPDATED"
+		payload, err := json.Marshal(company)
 		if err != nil {
 			t.Fatal(err)
 		}
 
-		// if db connection fails, add as fatal error
-		if app.Database == nil || app.Database.Ping() != nil {
+		req, err := http.NewRequest("PUT", "/Company_Detail/1", bytes.NewBuffer(payload))
+		if err != nil {
 			t.Fatal(err)
 		}
+		req = mux.SetURLVars(req, map[string]string{"Company_ID": "1"})
 
-		// new recorder for capturing response from request
 		rr := httptest.NewRecorder()
-		handler := http.HandlerFunc(app.createNewCompany)
+		http.HandlerFunc(app.updateCompany).ServeHTTP(rr, req)
 
-		// serve http call on request
-		handler.ServeHTTP(rr, req)
+		if stored, err := app.Store.Get(req.Context(), 1); err != nil || stored.Company_Name != company.Company_Name {
+			t.Errorf("%s: company not updated: got %+v, %v", dbType, stored, err)
+		}
 
-		// checking http status code if 200
-		if status := rr.Code; status != http.StatusOK {
-			t.Errorf("handler returned wrong status code: got %v want %v",
-				status, http.StatusOK)
+		// delete the company
+		req, err = http.NewRequest("DELETE", "/Company_Detail/1", nil)
+		if err != nil {
+			t.Fatal(err)
 		}
+		req = mux.SetURLVars(req, map[string]string{"Company_ID": "1"})
 
-		// decode the response body to a new article struct
-		json.NewDecoder(rr.Body).Decode(&responseCompany)
+		rr = httptest.NewRecorder()
+		http.HandlerFunc(app.deleteCompany).ServeHTTP(rr, req)
+
+		if _, err := app.Store.Get(req.Context(), 1); err != ErrCompanyNotFound {
+			t.Errorf("%s: company not deleted: got %v", dbType, err)
+		}
+	}
+}
+
+func TestDateColumnsJSON(t *testing.T) {
+
+	for _, dbType := range testDBTypes() {
+
+		app := initTestModule(t, dbType)
+
+		// a timestamp at midnight stays a timestamp, the date keeps its day only
+		body := `{"Client_ID": 1, "Company_ID": 1, "Company_Name": "TEST_GO", "Create_Date": "2021-02-25T00:00:00+05:00", "Data_As_Of_Date": "2021-02-25T23:30:00-05:00"}`
+		rr := httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, httptest.NewRequest("POST", "/Company_Detail", strings.NewReader(body)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: create got %d %s", dbType, rr.Code, rr.Body)
+		}
 
-		// Check the response string matches expected response
-		if responseCompany.Id != 0 && responseCompany.Company_Name != company.Company_Name {
-			t.Errorf("handler returned unexpected body: got %+v want %+v",
-				responseCompany, company)
+		rr = httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, httptest.NewRequest("GET", "/Company_Detail/1", nil))
+		var got struct {
+			Create_Date     time.Time
+			Data_As_Of_Date string
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%s: got %s, %v", dbType, rr.Body, err)
+		}
+		if want := time.Date(2021, 2, 24, 19, 0, 0, 0, time.UTC); !got.Create_Date.Equal(want) || got.Data_As_Of_Date != "2021-02-25" {
+			t.Errorf("%s: got %s", dbType, rr.Body)
 		}
 	}
 }
+
+// sameCompany reports whether both companies hold the same values, timestamps
+// read back from a DB may carry another location
+func sameCompany(a, b Company) bool {
+
+	encodedA, errA := json.Marshal(a)
+	encodedB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(encodedA) == string(encodedB)
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// migrationFiles holds the versioned up/down scripts, one directory per DB type,
+// named <version>_<name>.up.sql and <version>_<name>.down.sql
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// schemaVersionTable records the applied migrations
+const schemaVersionTable = `CREATE TABLE IF NOT EXISTS schema_version (
+	version    INTEGER NOT NULL PRIMARY KEY,
+	name       VARCHAR(255) NOT NULL,
+	applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`
+
+type (
+
+	// migration is a versioned schema change with its up and down scripts
+	migration struct {
+		version int
+		name    string
+		up      string
+		down    string
+	}
+
+	// migrationStatus reports whether a migration is applied
+	migrationStatus struct {
+		migration
+		applied   bool
+		appliedAt string
+	}
+
+	// migrator applies the embedded migrations of a DB type to a DB
+	migrator struct {
+		db         *sql.DB
+		dbType     string
+		migrations []migration
+	}
+)
+
+// newMigrator loads the embedded migrations for the DB type
+func newMigrator(dbType string, db *sql.DB) (*migrator, error) {
+
+	migrations, err := loadMigrations(dbType)
+	if err != nil {
+		return nil, err
+	}
+	return &migrator{db: db, dbType: dbType, migrations: migrations}, nil
+}
+
+// loadMigrations reads the migration scripts of a DB type ordered by version
+func loadMigrations(dbType string) ([]migration, error) {
+
+	dir := path.Join("migrations", dbType)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for DB type %q", dbType)
+	}
+
+	byVersion := make(map[int]*migration)
+	for _, entry := range entries {
+
+		// split <version>_<name>.<direction>.sql
+		base := strings.TrimSuffix(entry.Name(), ".sql")
+		ext := path.Ext(base)
+		base = strings.TrimSuffix(base, ext)
+		parts := strings.SplitN(base, "_", 2)
+
+		version, err := strconv.Atoi(parts[0])
+		if err != nil || len(parts) != 2 || (ext != ".up" && ext != ".down") {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+
+		script, err := migrationFiles.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: parts[1]}
+			byVersion[version] = m
+		}
+		if ext == ".up" {
+			m.up = string(script)
+		} else {
+			m.down = string(script)
+		}
+	}
+
+	var migrations []migration
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %04d_%s is missing its up or down script", m.version, m.name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
+
+// Up applies every pending migration, returning the applied ones
+func (m *migrator) Up(ctx context.Context) ([]migration, error) {
+
+	applied, err := m.appliedVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []migration
+	for _, mig := range m.migrations {
+		if _, ok := applied[mig.version]; ok {
+			continue
+		}
+
+		insert := "INSERT INTO schema_version (version, name) VALUES (" + placeholder(m.dbType, 1) + ", " + placeholder(m.dbType, 2) + ")"
+		if err = m.run(ctx, mig.up, insert, mig.version, mig.name); err != nil {
+			return done, fmt.Errorf("migration %04d_%s up: %w", mig.version, mig.name, err)
+		}
+		done = append(done, mig)
+	}
+	return done, nil
+}
+
+// Down reverts the latest applied migration, returning nil if none is applied
+func (m *migrator) Down(ctx context.Context) (*migration, error) {
+
+	applied, err := m.appliedVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		mig := m.migrations[i]
+		if _, ok := applied[mig.version]; !ok {
+			continue
+		}
+
+		remove := "DELETE FROM schema_version WHERE version=" + placeholder(m.dbType, 1)
+		if err = m.run(ctx, mig.down, remove, mig.version); err != nil {
+			return nil, fmt.Errorf("migration %04d_%s down: %w", mig.version, mig.name, err)
+		}
+		return &mig, nil
+	}
+	return nil, nil
+}
+
+// Status lists every known migration and whether it is applied
+func (m *migrator) Status(ctx context.Context) ([]migrationStatus, error) {
+
+	applied, err := m.appliedVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]migrationStatus, len(m.migrations))
+	for i, mig := range m.migrations {
+		appliedAt, ok := applied[mig.version]
+		status[i] = migrationStatus{migration: mig, applied: ok, appliedAt: appliedAt}
+	}
+	return status, nil
+}
+
+// appliedVersions returns the applied migration versions with their apply time
+func (m *migrator) appliedVersions(ctx context.Context) (map[int]string, error) {
+
+	if _, err := m.db.ExecContext(ctx, schemaVersionTable); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.db.QueryContext(ctx, "SELECT version, applied_at FROM schema_version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]string)
+	for rows.Next() {
+		var (
+			version   int
+			appliedAt string
+		)
+		if err = rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// run executes the statements of a migration script followed by the
+// schema_version bookkeeping query in a single transaction. MySQL commits
+// implicitly after every DDL statement, so a MySQL migration failing part way
+// stays partly applied without its version recorded. Its data statements check
+// the column types before changing rows, the schema statements it committed
+// may have to be reverted by hand before it runs again
+func (m *migrator) run(ctx context.Context, script, bookkeeping string, args ...interface{}) error {
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, statement := range strings.Split(script, ";") {
+		if strings.TrimSpace(statement) == "" {
+			continue
+		}
+		if _, err = tx.ExecContext(ctx, statement); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if _, err = tx.ExecContext(ctx, bookkeeping, args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// runMigrateCommand runs the migrate up, down or status command, writing a
+// report to out
+func runMigrateCommand(ctx context.Context, m *migrator, command string, out io.Writer) error {
+
+	switch command {
+	case "up":
+		done, err := m.Up(ctx)
+		for _, mig := range done {
+			fmt.Fprintf(out, "applied  %04d_%s\n", mig.version, mig.name)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Fprintln(out, "schema is up to date")
+		}
+		return err
+
+	case "down":
+		mig, err := m.Down(ctx)
+		if mig != nil {
+			fmt.Fprintf(out, "reverted %04d_%s\n", mig.version, mig.name)
+		} else if err == nil {
+			fmt.Fprintln(out, "no migration to revert")
+		}
+		return err
+
+	case "status":
+		status, err := m.Status(ctx)
+		for _, s := range status {
+			if s.applied {
+				fmt.Fprintf(out, "applied  %04d_%s  %s\n", s.version, s.name, s.appliedAt)
+			} else {
+				fmt.Fprintf(out, "pending  %04d_%s\n", s.version, s.name)
+			}
+		}
+		return err
+	}
+	return fmt.Errorf("unknown migrate command %q, expected up, down or status", command)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestLoadMigrations(t *testing.T) {
+
+	for _, dbType := range []string{"mysql", "postgres", "sqlite"} {
+
+		migrations, err := loadMigrations(dbType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(migrations) == 0 || migrations[0].version != 1 {
+			t.Errorf("%s: unexpected migrations %+v", dbType, migrations)
+		}
+	}
+
+	if _, err := loadMigrations("oracle"); err == nil {
+		t.Errorf("loaded migrations for unknown DB type")
+	}
+}
+
+func TestMigrateCommands(t *testing.T) {
+
+	ctx := context.Background()
+
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	migrator, err := newMigrator("sqlite", db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrations, err := loadMigrations("sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := migrations[0]
+	name := func(m migration) string { return fmt.Sprintf("%04d_%s", m.version, m.name) }
+
+	steps := []struct {
+		command string
+		want    string
+	}{
+		{"status", "pending  " + name(first)},
+		{"up", "applied  " + name(first)},
+		{"up", "schema is up to date"},
+		{"status", "applied  " + name(first)},
+	}
+
+	// down reverts one migration at a time, latest first
+	for i := len(migrations) - 1; i >= 0; i-- {
+		steps = append(steps, struct {
+			command string
+			want    string
+		}{"down", "reverted " + name(migrations[i])})
+	}
+	steps = append(steps, struct {
+		command string
+		want    string
+	}{"down", "no migration to revert"})
+
+	for _, tc := range steps {
+		var out bytes.Buffer
+		if err = runMigrateCommand(ctx, migrator, tc.command, &out); err != nil {
+			t.Fatalf("migrate %s: %v", tc.command, err)
+		}
+		if !strings.HasPrefix(out.String(), tc.want) {
+			t.Errorf("migrate %s: got %q want %q", tc.command, out.String(), tc.want)
+		}
+	}
+	// the table is gone after the last down
+	if _, err = db.Exec("SELECT 1 FROM Company_Detail"); err == nil {
+		t.Errorf("Company_Detail still exists after migrate down")
+	}
+
+	if err = runMigrateCommand(ctx, migrator, "sideways", &bytes.Buffer{}); err == nil {
+		t.Errorf("unknown migrate command accepted")
+	}
+}
+
+func TestMigrateTypedColumns(t *testing.T) {
+
+	ctx := context.Background()
+
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	migrator, err := newMigrator("sqlite", db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// apply the untyped schema and store a record the way the string model did
+	migrator.migrations = migrator.migrations[:1]
+	if _, err = migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`INSERT INTO Company_Detail VALUES (1, 1, 'TEST_GO', '1234', 'High', 'Open', '1234', '', '2021-02-25', '', '2021-02-25')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the typing migration converts the stored strings
+	if migrator, err = newMigrator("sqlite", db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var company Company
+	err = db.QueryRow("SELECT Total_Flight_Risk, Total_Backfill, Create_Date, Last_Update, Data_As_Of_Date FROM Company_Detail").Scan(
+		&company.Total_Flight_Risk, &company.Total_Backfill, &company.Create_Date, &company.Last_Update, &company.Data_As_Of_Date,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if company.Total_Flight_Risk != newNullInt(1234) || company.Total_Backfill.Valid || company.Last_Update.Valid {
+		t.Errorf("totals not converted: %+v", company)
+	}
+	if !company.Data_As_Of_Date.Valid || company.Data_As_Of_Date.Time.Format(dateLayout) != "2021-02-25" {
+		t.Errorf("dates not converted: %+v", company)
+	}
+}
+
+func TestMySQLMigrationRerun(t *testing.T) {
+
+	if !*live {
+		t.Skip("live DB tests disabled, run with -live")
+	}
+	ctx := context.Background()
+	app := initTestModule(t, "mysql")
+
+	company := testCompany(1)
+	company.Total_Flight_Risk = newNullInt(0)
+	company.Total_Backfill = newNullInt(0)
+	app.Store.Delete(ctx, company.Company_ID)
+	if err := app.Store.Create(ctx, &company); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { app.Store.Delete(ctx, company.Company_ID) })
+
+	// MySQL commits the typing ALTER on its own, a failure after it leaves the
+	// migration unrecorded and it runs again on the typed columns
+	if _, err := app.Database.ExecContext(ctx, "DELETE FROM schema_version WHERE version=2"); err != nil {
+		t.Fatal(err)
+	}
+	migrator, err := newMigrator("mysql", app.Database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done, err := migrator.Up(ctx); err != nil || len(done) != 1 || done[0].version != 2 {
+		t.Fatalf("rerun got %+v, %v", done, err)
+	}
+
+	// the zeros and dates survive the second run
+	stored, err := app.Store.Get(ctx, company.Company_ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Total_Flight_Risk != newNullInt(0) || stored.Total_Backfill != newNullInt(0) || !stored.Create_Date.Valid || !stored.Data_As_Of_Date.Valid {
+		t.Errorf("rerun changed the company: %+v", stored)
+	}
+}
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS Company_Detail (
+	Client_ID          BIGINT NOT NULL,
+	Company_ID         BIGINT NOT NULL PRIMARY KEY,
+	Company_Name       VARCHAR(255) NOT NULL,
+	ASIC               VARCHAR(64),
+	Flight_Risk_Status VARCHAR(64),
+	Recruit_Status     VARCHAR(64),
+	Total_Flight_Risk  VARCHAR(64),
+	Total_Backfill     VARCHAR(64),
+	Create_Date        VARCHAR(32),
+	Last_Update        VARCHAR(32),
+	Data_As_Of_Date    VARCHAR(32)
+);
@@ -0,0 +1,6 @@
+ALTER TABLE Company_Detail
+	MODIFY Total_Flight_Risk VARCHAR(64),
+	MODIFY Total_Backfill    VARCHAR(64),
+	MODIFY Create_Date       VARCHAR(32),
+	MODIFY Last_Update       VARCHAR(32),
+	MODIFY Data_As_Of_Date   VARCHAR(32);
@@ -0,0 +1,23 @@
+-- the cleanup only runs while a column is still text, a run repeated after the ALTER below
+-- committed must not compare the typed values to ''
+UPDATE Company_Detail SET Total_Flight_Risk = NULL
+	WHERE EXISTS (SELECT 1 FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'Company_Detail' AND COLUMN_NAME = 'Total_Flight_Risk' AND DATA_TYPE = 'varchar')
+	AND Total_Flight_Risk = '';
+UPDATE Company_Detail SET Total_Backfill = NULL
+	WHERE EXISTS (SELECT 1 FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'Company_Detail' AND COLUMN_NAME = 'Total_Backfill' AND DATA_TYPE = 'varchar')
+	AND Total_Backfill = '';
+UPDATE Company_Detail SET Create_Date = NULL
+	WHERE EXISTS (SELECT 1 FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'Company_Detail' AND COLUMN_NAME = 'Create_Date' AND DATA_TYPE = 'varchar')
+	AND Create_Date = '';
+UPDATE Company_Detail SET Last_Update = NULL
+	WHERE EXISTS (SELECT 1 FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'Company_Detail' AND COLUMN_NAME = 'Last_Update' AND DATA_TYPE = 'varchar')
+	AND Last_Update = '';
+UPDATE Company_Detail SET Data_As_Of_Date = NULL
+	WHERE EXISTS (SELECT 1 FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'Company_Detail' AND COLUMN_NAME = 'Data_As_Of_Date' AND DATA_TYPE = 'varchar')
+	AND Data_As_Of_Date = '';
+ALTER TABLE Company_Detail
+	MODIFY Total_Flight_Risk BIGINT NULL,
+	MODIFY Total_Backfill    BIGINT NULL,
+	MODIFY Create_Date       DATETIME NULL,
+	MODIFY Last_Update       DATETIME NULL,
+	MODIFY Data_As_Of_Date   DATE NULL;
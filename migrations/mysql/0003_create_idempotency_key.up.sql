@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS idempotency_key (
+	idem_key    VARCHAR(255) NOT NULL PRIMARY KEY,
+	fingerprint CHAR(64) NOT NULL,
+	status      INT NOT NULL DEFAULT 0,
+	headers     TEXT,
+	body        MEDIUMTEXT,
+	expires_at  BIGINT NOT NULL
+);
+CREATE INDEX idempotency_key_expires_at ON idempotency_key (expires_at);
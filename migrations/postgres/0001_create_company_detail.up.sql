@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS Company_Detail (
+	Client_ID          BIGINT NOT NULL,
+	Company_ID         BIGINT NOT NULL PRIMARY KEY,
+	Company_Name       TEXT NOT NULL,
+	ASIC               TEXT,
+	Flight_Risk_Status TEXT,
+	Recruit_Status     TEXT,
+	Total_Flight_Risk  TEXT,
+	Total_Backfill     TEXT,
+	Create_Date        TEXT,
+	Last_Update        TEXT,
+	Data_As_Of_Date    TEXT
+);
@@ -0,0 +1,6 @@
+ALTER TABLE Company_Detail
+	ALTER COLUMN Total_Flight_Risk TYPE TEXT USING Total_Flight_Risk::TEXT,
+	ALTER COLUMN Total_Backfill    TYPE TEXT USING Total_Backfill::TEXT,
+	ALTER COLUMN Create_Date       TYPE TEXT USING Create_Date::TEXT,
+	ALTER COLUMN Last_Update       TYPE TEXT USING Last_Update::TEXT,
+	ALTER COLUMN Data_As_Of_Date   TYPE TEXT USING Data_As_Of_Date::TEXT;
@@ -0,0 +1,6 @@
+ALTER TABLE Company_Detail
+	ALTER COLUMN Total_Flight_Risk TYPE BIGINT USING NULLIF(Total_Flight_Risk, '')::BIGINT,
+	ALTER COLUMN Total_Backfill    TYPE BIGINT USING NULLIF(Total_Backfill, '')::BIGINT,
+	ALTER COLUMN Create_Date       TYPE TIMESTAMP USING NULLIF(Create_Date, '')::TIMESTAMP,
+	ALTER COLUMN Last_Update       TYPE TIMESTAMP USING NULLIF(Last_Update, '')::TIMESTAMP,
+	ALTER COLUMN Data_As_Of_Date   TYPE DATE USING NULLIF(Data_As_Of_Date, '')::DATE;
@@ -0,0 +1 @@
+ALTER TABLE idempotency_key ADD COLUMN IF NOT EXISTS locked_until BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,16 @@
+CREATE TABLE Company_Detail_untyped (
+	Client_ID          INTEGER NOT NULL,
+	Company_ID         INTEGER PRIMARY KEY,
+	Company_Name       TEXT NOT NULL,
+	ASIC               TEXT,
+	Flight_Risk_Status TEXT,
+	Recruit_Status     TEXT,
+	Total_Flight_Risk  TEXT,
+	Total_Backfill     TEXT,
+	Create_Date        TEXT,
+	Last_Update        TEXT,
+	Data_As_Of_Date    TEXT
+);
+INSERT INTO Company_Detail_untyped SELECT * FROM Company_Detail;
+DROP TABLE Company_Detail;
+ALTER TABLE Company_Detail_untyped RENAME TO Company_Detail;
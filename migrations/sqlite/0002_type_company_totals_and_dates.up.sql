@@ -0,0 +1,20 @@
+CREATE TABLE Company_Detail_typed (
+	Client_ID          INTEGER NOT NULL,
+	Company_ID         INTEGER PRIMARY KEY,
+	Company_Name       TEXT NOT NULL,
+	ASIC               TEXT,
+	Flight_Risk_Status TEXT,
+	Recruit_Status     TEXT,
+	Total_Flight_Risk  INTEGER,
+	Total_Backfill     INTEGER,
+	Create_Date        DATETIME,
+	Last_Update        DATETIME,
+	Data_As_Of_Date    DATE
+);
+INSERT INTO Company_Detail_typed
+	SELECT Client_ID, Company_ID, Company_Name, ASIC, Flight_Risk_Status, Recruit_Status,
+		CAST(NULLIF(Total_Flight_Risk, '') AS INTEGER), CAST(NULLIF(Total_Backfill, '') AS INTEGER),
+		NULLIF(Create_Date, ''), NULLIF(Last_Update, ''), NULLIF(Data_As_Of_Date, '')
+	FROM Company_Detail;
+DROP TABLE Company_Detail;
+ALTER TABLE Company_Detail_typed RENAME TO Company_Detail;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS idempotency_key (
+	idem_key    TEXT PRIMARY KEY,
+	fingerprint TEXT NOT NULL,
+	status      INTEGER NOT NULL DEFAULT 0,
+	headers     TEXT,
+	body        TEXT,
+	expires_at  INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idempotency_key_expires_at ON idempotency_key (expires_at);
@@ -0,0 +1 @@
+ALTER TABLE idempotency_key ADD COLUMN locked_until INTEGER NOT NULL DEFAULT 0;
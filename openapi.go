@@ -0,0 +1,449 @@
+package main
+
+import (
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	swaggerFiles "github.com/swaggo/files/v2"
+)
+
+// openAPIVersion is the OpenAPI version of the generated document
+const openAPIVersion = "3.1.0"
+
+// response schemas without a component, the others are named after their
+// component and sent as application/json
+const (
+	noContent     = ""
+	textSchema    = "text"
+	problemSchema = "Problem"
+)
+
+type (
+
+	// jsonObject is a JSON object of the OpenAPI document
+	jsonObject = map[string]interface{}
+
+	// operationDoc describes a route in the OpenAPI document beyond its path,
+	// whose variables are integer path params
+	operationDoc struct {
+		params    []paramDoc        // query and header params
+		body      map[string]string // request media types to their schema
+		responses map[int]string    // response statuses to their schema, 500 and 503 are added
+		formats   []string          // formats the JSON responses are also sent in, negotiated by Accept
+	}
+
+	// paramDoc is a query or header param of an operation
+	paramDoc struct {
+		name        string
+		in          string
+		description string
+		schema      jsonObject
+	}
+)
+
+var (
+	// idempotencyKeyParam lets POST requests be retried
+	idempotencyKeyParam = paramDoc{idempotencyKeyHeader, "header", "replays the stored response of a request repeating the key",
+		jsonObject{"type": "string", "maxLength": maxIdempotencyKeyLength}}
+
+	// ifMatchParam guards the writes of a single company
+	ifMatchParam = paramDoc{"If-Match", "header", "only write over the company with one of these ETags",
+		jsonObject{"type": "string"}}
+
+	// ifNoneMatchParam saves reading an unchanged company
+	ifNoneMatchParam = paramDoc{"If-None-Match", "header", "answer 304 while the company has one of these ETags",
+		jsonObject{"type": "string"}}
+
+	// fieldsParam selects the returned company fields
+	fieldsParam = paramDoc{"fields", "query", "comma separated columns to return, every column when empty",
+		jsonObject{"type": "string"}}
+
+	// formatParam overrides the Accept header of the company reads
+	formatParam = paramDoc{"format", "query", "response format, instead of the one negotiated by the Accept header",
+		jsonObject{"type": "string", "enum": formatNames()}}
+
+	// pathVarPattern matches the variables of a mux path template
+	pathVarPattern = regexp.MustCompile(`\{([^}:]+)(:[^}]*)?\}`)
+)
+
+// listParams returns the filter, sort and page params of the company list
+func listParams() []paramDoc {
+
+	integer := jsonObject{"type": "integer", "minimum": 0}
+	date := jsonObject{"type": "string", "format": "date"}
+
+	return []paramDoc{
+		{"Client_ID", "query", "companies of this client", jsonObject{"type": "integer", "minimum": 1}},
+		{"Flight_Risk_Status", "query", "comma separated statuses among " + strings.Join(flightRiskStatuses, ", "), jsonObject{"type": "string"}},
+		{"Recruit_Status", "query", "comma separated statuses among " + strings.Join(recruitStatuses, ", "), jsonObject{"type": "string"}},
+		{"Total_Flight_Risk_min", "query", "lowest Total_Flight_Risk", integer},
+		{"Total_Flight_Risk_max", "query", "highest Total_Flight_Risk", integer},
+		{"Total_Backfill_min", "query", "lowest Total_Backfill", integer},
+		{"Total_Backfill_max", "query", "highest Total_Backfill", integer},
+		{"Data_As_Of_Date_from", "query", "earliest Data_As_Of_Date", date},
+		{"Data_As_Of_Date_to", "query", "latest Data_As_Of_Date", date},
+		{"Company_Name", "query", "case insensitive part of the name", jsonObject{"type": "string"}},
+		{"sort", "query", "comma separated columns among " + strings.Join(sortableColumns, ", ") + ", descending with a - prefix", jsonObject{"type": "string"}},
+		{"cursor", "query", "next_cursor or prev_cursor of a previous page", jsonObject{"type": "string"}},
+		{"id", "query", "last Company_ID of the previous page, with the default sort only", jsonObject{"type": "integer"}},
+		{"limit", "query", "max companies per page, every company when 0", integer},
+		{"total", "query", "count the matching companies", jsonObject{"type": "boolean"}},
+	}
+}
+
+// importParams returns the options of a file import
+func importParams() []paramDoc {
+
+	return []paramDoc{
+		{"map", "query", "header=column mapping a file header to a column, or header= skipping it, repeatable. Other headers name a column in any case", jsonObject{"type": "string"}},
+		{"dry_run", "query", "validate the rows without loading them", jsonObject{"type": "boolean"}},
+		{"chunk_size", "query", "rows upserted per transaction", jsonObject{"type": "integer", "minimum": 1, "maximum": maxBatchOperations, "default": defaultImportChunk}},
+		{"format", "query", "json for the import report or csv for its error file, instead of the one negotiated by the Accept header", jsonObject{"type": "string", "enum": []string{formatJSON, formatCSV}}},
+	}
+}
+
+// openAPIDocument generates the OpenAPI document of the route table, the /v1
+// routes have a snake_case copy of the components
+func openAPIDocument() jsonObject {
+
+	schemas := openAPISchemas()
+	for name, schema := range openAPISchemas() {
+		schemas[v1SchemaPrefix+name] = v1Schema(schema)
+	}
+
+	paths := jsonObject{}
+	for _, rt := range routes() {
+		if rt.hidden {
+			continue
+		}
+		item, ok := paths[rt.path].(jsonObject)
+		if !ok {
+			item = jsonObject{}
+			paths[rt.path] = item
+		}
+		item[strings.ToLower(rt.method)] = rt.operation()
+	}
+
+	return jsonObject{
+		"openapi": openAPIVersion,
+		"info": jsonObject{
+			"title":       "golang-rest-api-demo",
+			"version":     "1.0.0",
+			"description": "REST API of the Company_Detail records",
+		},
+		"paths":      paths,
+		"components": jsonObject{"schemas": schemas},
+	}
+}
+
+// v1Schema returns a copy of an OpenAPI node with the column properties in
+// snake_case, referencing the /v1 copy of the components
+func v1Schema(node interface{}) interface{} {
+
+	switch node := node.(type) {
+	case jsonObject:
+		copied := jsonObject{}
+		for key, value := range node {
+			properties, isProperties := value.(jsonObject)
+			required, isRequired := value.([]string)
+			switch {
+			case key == "properties" && isProperties:
+				renamed := jsonObject{}
+				for name, property := range properties {
+					renamed[renameKey(v1Keys, name)] = v1Schema(property)
+				}
+				copied[key] = renamed
+			case key == "required" && isRequired:
+				renamed := make([]string, len(required))
+				for i, name := range required {
+					renamed[i] = renameKey(v1Keys, name)
+				}
+				copied[key] = renamed
+			case key == "$ref":
+				copied[key] = strings.Replace(value.(string), "/schemas/", "/schemas/"+v1SchemaPrefix, 1)
+			default:
+				copied[key] = v1Schema(value)
+			}
+		}
+		return copied
+	case []jsonObject:
+		copied := make([]jsonObject, len(node))
+		for i, item := range node {
+			copied[i] = v1Schema(item).(jsonObject)
+		}
+		return copied
+	}
+	return node
+}
+
+// operation returns the OpenAPI operation of the route
+func (rt route) operation() jsonObject {
+
+	params := []jsonObject{}
+	for _, name := range pathVars(rt.path) {
+		params = append(params, jsonObject{"name": name, "in": "path", "required": true, "schema": jsonObject{"type": "integer", "minimum": 1}})
+	}
+	for _, param := range rt.doc.params {
+		name := param.name
+		if rt.snakeCase && param.in == "query" {
+			name = renameKey(v1Keys, name)
+		}
+		params = append(params, jsonObject{"name": name, "in": param.in, "description": param.description, "schema": param.schema})
+	}
+
+	// any operation may fail on the DB
+	responses := jsonObject{}
+	for _, status := range []int{http.StatusInternalServerError, http.StatusServiceUnavailable} {
+		responses[strconv.Itoa(status)] = responseDoc(status, problemSchema)
+	}
+	for status, schema := range rt.doc.responses {
+		responses[strconv.Itoa(status)] = responseDoc(status, schema)
+	}
+	if len(rt.doc.formats) > 0 {
+		for status, schema := range rt.doc.responses {
+			if schema == noContent || schema == textSchema || schema == problemSchema {
+				continue
+			}
+			content := responses[strconv.Itoa(status)].(jsonObject)["content"].(jsonObject)
+			for _, format := range rt.doc.formats {
+				content[formatMediaType(format)] = jsonObject{"schema": jsonObject{"type": "string"}}
+			}
+		}
+		responses[strconv.Itoa(http.StatusNotAcceptable)] = responseDoc(http.StatusNotAcceptable, problemSchema)
+	}
+
+	operation := jsonObject{"operationId": rt.name, "summary": rt.summary, "responses": responses}
+	if len(params) > 0 {
+		operation["parameters"] = params
+	}
+	if len(rt.doc.body) > 0 {
+		content := jsonObject{}
+		for mediaType, schema := range rt.doc.body {
+			content[mediaType] = jsonObject{"schema": schemaRef(schema)}
+		}
+		operation["requestBody"] = jsonObject{"required": true, "content": content}
+	}
+	if rt.deprecated {
+		operation["deprecated"] = true
+	}
+	if rt.snakeCase {
+		return v1Schema(operation).(jsonObject)
+	}
+	return operation
+}
+
+// pathVars returns the variable names of a mux path template
+func pathVars(path string) []string {
+
+	var names []string
+	for _, match := range pathVarPattern.FindAllStringSubmatch(path, -1) {
+		names = append(names, match[1])
+	}
+	return names
+}
+
+// responseDoc returns the OpenAPI response of a status with the given schema
+func responseDoc(status int, schema string) jsonObject {
+
+	response := jsonObject{"description": http.StatusText(status)}
+	switch schema {
+	case noContent:
+	case textSchema:
+		response["content"] = jsonObject{"text/plain": jsonObject{"schema": jsonObject{"type": "string"}}}
+	case problemSchema:
+		response["content"] = jsonObject{"application/problem+json": jsonObject{"schema": schemaRef(schema)}}
+	default:
+		response["content"] = jsonObject{"application/json": jsonObject{"schema": schemaRef(schema)}}
+	}
+	return response
+}
+
+// schemaRef references a schema of the components
+func schemaRef(name string) jsonObject {
+	return jsonObject{"$ref": "#/components/schemas/" + name}
+}
+
+// openAPISchemas returns the component schemas, generated from the Go types
+// with the rules of their validation added
+func openAPISchemas() jsonObject {
+
+	// the Company rules of validate, empty enumerations mean unknown
+	company := structSchema(reflect.TypeOf(Company{}))
+	properties := company["properties"].(jsonObject)
+	properties["Flight_Risk_Status"].(jsonObject)["enum"] = append([]string{""}, flightRiskStatuses...)
+	properties["Recruit_Status"].(jsonObject)["enum"] = append([]string{""}, recruitStatuses...)
+	for _, column := range []string{"Client_ID", "Company_ID"} {
+		properties[column].(jsonObject)["minimum"] = 1
+	}
+	for _, column := range []string{"Total_Flight_Risk", "Total_Backfill"} {
+		properties[column].(jsonObject)["minimum"] = 0
+	}
+	company["required"] = requiredColumns()
+
+	// the views hold the fields= columns only
+	view := structSchema(reflect.TypeOf(Company{}))
+	view["properties"] = properties
+	delete(view, "required")
+	view["description"] = "a Company limited to the columns of the fields query param"
+
+	page := structSchema(reflect.TypeOf(companyPage{}))
+	page["properties"].(jsonObject)["items"] = jsonObject{"type": "array", "items": schemaRef("CompanyView")}
+
+	batchRequest := structSchema(reflect.TypeOf(batchRequest{}))
+	batchRequest["required"] = []string{"operations"}
+	batchRequest["properties"].(jsonObject)["mode"].(jsonObject)["enum"] = []string{batchTransaction, batchPerItem}
+	batchRequest["properties"].(jsonObject)["operations"].(jsonObject)["maxItems"] = maxBatchOperations
+
+	batchOperation := structSchema(reflect.TypeOf(batchOperation{}))
+	batchOperation["required"] = []string{"op"}
+	batchOperation["properties"].(jsonObject)["op"].(jsonObject)["enum"] = []BatchAction{batchCreate, batchUpsert, batchDelete}
+	batchOperation["properties"].(jsonObject)["company"] = schemaRef("Company")
+
+	patchOp := structSchema(reflect.TypeOf(jsonPatchOp{}))
+	patchOp["required"] = []string{"op", "path"}
+	patchOp["properties"].(jsonObject)["op"].(jsonObject)["enum"] = []string{"add", "remove", "replace", "move", "copy", "test"}
+
+	return jsonObject{
+		"Company":        company,
+		"CompanyView":    view,
+		"CompanyPage":    page,
+		"MergePatch":     jsonObject{"type": "object", "description": "RFC 7396 merge patch of the Company fields, null clears a field"},
+		"JSONPatch":      jsonObject{"type": "array", "items": patchOp, "description": "RFC 6902 JSON Patch of the Company fields"},
+		"BatchRequest":   batchRequest,
+		"BatchOperation": batchOperation,
+		"BatchResponse":  structSchema(reflect.TypeOf(batchResponse{})),
+		"BatchResult":    structSchema(reflect.TypeOf(batchResult{})),
+		"Problem":        structSchema(reflect.TypeOf(problem{})),
+		"FieldError":     structSchema(reflect.TypeOf(fieldError{})),
+		"ImportFile":     jsonObject{"type": "string", "description": "CSV or XLSX file, a header row naming the columns then a company per row"},
+		"ImportReport":   structSchema(reflect.TypeOf(importReport{})),
+		"ImportError":    structSchema(reflect.TypeOf(importError{})),
+
+		"OpenAPIDocument": jsonObject{"type": "object", "description": "OpenAPI " + openAPIVersion + " document"},
+	}
+}
+
+// schemaOf returns the JSON schema of a Go type from its JSON encoding, types
+// with a component are referenced
+func schemaOf(t reflect.Type) jsonObject {
+
+	switch t {
+	case reflect.TypeOf(Company{}):
+		return schemaRef("Company")
+	case reflect.TypeOf(companyView{}):
+		return schemaRef("CompanyView")
+	case reflect.TypeOf(batchOperation{}):
+		return schemaRef("BatchOperation")
+	case reflect.TypeOf(batchResult{}):
+		return schemaRef("BatchResult")
+	case reflect.TypeOf(fieldError{}):
+		return schemaRef("FieldError")
+	case reflect.TypeOf(importError{}):
+		return schemaRef("ImportError")
+	case reflect.TypeOf(NullInt{}):
+		return jsonObject{"type": []string{"integer", "null"}}
+	case reflect.TypeOf(NullTime{}):
+		return jsonObject{"type": []string{"string", "null"}, "format": "date-time", "description": "RFC 3339 timestamp, a YYYY-MM-DD date is read as midnight UTC"}
+	case reflect.TypeOf(NullDate{}):
+		return jsonObject{"type": []string{"string", "null"}, "format": "date", "description": "YYYY-MM-DD date, the day of an RFC 3339 timestamp is read"}
+	case reflect.TypeOf(json.RawMessage{}):
+		return jsonObject{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaOf(t.Elem())
+	case reflect.Bool:
+		return jsonObject{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return jsonObject{"type": "integer"}
+	case reflect.String:
+		return jsonObject{"type": "string"}
+	case reflect.Slice:
+		return jsonObject{"type": "array", "items": schemaOf(t.Elem())}
+	case reflect.Struct:
+		return structSchema(t)
+	}
+	return jsonObject{}
+}
+
+// structSchema returns the object schema of a struct from its exported fields,
+// the fields without omitempty are required
+func structSchema(t reflect.Type) jsonObject {
+
+	properties := jsonObject{}
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+
+		field := t.Field(i)
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = schemaOf(field.Type)
+		if !strings.Contains(options, "omitempty") {
+			required = append(required, name)
+		}
+	}
+
+	schema := jsonObject{"type": "object", "properties": properties, "additionalProperties": false}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+//	GET /openapi.json
+//	response : OpenAPI document of the API
+//
+// describe the API, generated from the route table
+func (app *App) openAPI(w http.ResponseWriter, r *http.Request) {
+
+	app.logger.Println("Endpoint hit : openAPI")
+	app.writeJSON(w, http.StatusOK, openAPIDocument())
+}
+
+// swaggerInitializer points the embedded Swagger UI at the OpenAPI document
+const swaggerInitializer = `window.onload = function() {
+  window.ui = SwaggerUIBundle({
+    url: "../openapi.json",
+    dom_id: "#swagger-ui",
+    deepLinking: true,
+    presets: [SwaggerUIBundle.presets.apis, SwaggerUIStandalonePreset],
+    layout: "StandaloneLayout"
+  });
+};
+`
+
+//	GET /docs/
+//
+// Swagger UI of the OpenAPI document, its files are embedded so it works offline
+func (app *App) docs(w http.ResponseWriter, r *http.Request) {
+
+	// the relative links of the UI need the trailing slash
+	file := strings.TrimPrefix(r.URL.Path, "/docs")
+	switch file {
+	case "":
+		http.Redirect(w, r, "/docs/", http.StatusMovedPermanently)
+		return
+	case "/swagger-initializer.js":
+		w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+		w.Write([]byte(swaggerInitializer))
+		return
+	}
+
+	if _, err := fs.Stat(swaggerFiles.FS, strings.TrimPrefix(file, "/")); file != "/" && err != nil {
+		app.notFound(w, r)
+		return
+	}
+	http.StripPrefix("/docs", http.FileServer(http.FS(swaggerFiles.FS))).ServeHTTP(w, r)
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// specValidator checks requests and responses against an OpenAPI document,
+// covering the JSON schema keywords the generated document uses
+type specValidator struct {
+	doc map[string]interface{}
+}
+
+// newSpecValidator reads the OpenAPI document served by the app
+func newSpecValidator(t *testing.T, app *App) specValidator {
+
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, httptest.NewRequest("GET", "/openapi.json", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("GET /openapi.json got status %d", rr.Code)
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	return specValidator{doc}
+}
+
+// object returns the object at the slash separated path of the document
+func (v specValidator) object(path ...string) map[string]interface{} {
+
+	node := v.doc
+	for _, key := range path {
+		next, ok := node[key].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		node = next
+	}
+	return node
+}
+
+// resolve follows the $ref of a schema
+func (v specValidator) resolve(schema map[string]interface{}) map[string]interface{} {
+
+	if ref, ok := schema["$ref"].(string); ok {
+		return v.resolve(v.object(strings.Split(strings.TrimPrefix(ref, "#/"), "/")...))
+	}
+	return schema
+}
+
+// validate returns why value does not match the schema
+func (v specValidator) validate(schema map[string]interface{}, value interface{}, at string) (errs []string) {
+
+	if schema = v.resolve(schema); schema == nil {
+		return []string{at + ": unresolved schema"}
+	}
+
+	if types, ok := schema["type"]; ok {
+		var allowed []interface{}
+		switch types := types.(type) {
+		case string:
+			allowed = []interface{}{types}
+		case []interface{}:
+			allowed = types
+		}
+
+		matched := false
+		for _, typ := range allowed {
+			matched = matched || jsonType(value, typ.(string))
+		}
+		if !matched {
+			return []string{fmt.Sprintf("%s: %v is not of type %v", at, value, types)}
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			found = found || reflect.DeepEqual(allowed, value)
+		}
+		if !found {
+			errs = append(errs, fmt.Sprintf("%s: %v is not one of %v", at, value, enum))
+		}
+	}
+
+	if minimum, ok := schema["minimum"].(float64); ok {
+		if number, ok := value.(float64); ok && number < minimum {
+			errs = append(errs, fmt.Sprintf("%s: %v is below %v", at, value, minimum))
+		}
+	}
+	if maxLength, ok := schema["maxLength"].(float64); ok {
+		if text, ok := value.(string); ok && float64(len(text)) > maxLength {
+			errs = append(errs, fmt.Sprintf("%s: longer than %v", at, maxLength))
+		}
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := value[name.(string)]; !ok {
+				errs = append(errs, fmt.Sprintf("%s: %s is required", at, name))
+			}
+		}
+		for name, field := range value {
+			property, ok := properties[name].(map[string]interface{})
+			if !ok {
+				if schema["additionalProperties"] == false {
+					errs = append(errs, fmt.Sprintf("%s: %s is not a property", at, name))
+				}
+				continue
+			}
+			errs = append(errs, v.validate(property, field, at+"/"+name)...)
+		}
+
+	case []interface{}:
+		if maxItems, ok := schema["maxItems"].(float64); ok && float64(len(value)) > maxItems {
+			errs = append(errs, fmt.Sprintf("%s: more than %v items", at, maxItems))
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range value {
+				errs = append(errs, v.validate(items, item, at+"/"+strconv.Itoa(i))...)
+			}
+		}
+	}
+	return errs
+}
+
+// jsonType reports whether a decoded JSON value has the JSON schema type
+func jsonType(value interface{}, typ string) bool {
+
+	switch value := value.(type) {
+	case nil:
+		return typ == "null"
+	case bool:
+		return typ == "boolean"
+	case string:
+		return typ == "string"
+	case float64:
+		return typ == "number" || typ == "integer" && value == float64(int64(value))
+	case []interface{}:
+		return typ == "array"
+	case map[string]interface{}:
+		return typ == "object"
+	}
+	return false
+}
+
+// validateJSON decodes a JSON body and validates it against the schema
+func (v specValidator) validateJSON(schema map[string]interface{}, body []byte, at string) []string {
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return []string{at + ": " + err.Error()}
+	}
+	return v.validate(schema, value, at)
+}
+
+// checkExchange returns why a request to the route template, or its response,
+// does not match the document
+func (v specValidator) checkExchange(template string, req *http.Request, body string, rr *httptest.ResponseRecorder) (errs []string) {
+
+	operation := v.object("paths", template, strings.ToLower(req.Method))
+	if operation == nil {
+		return []string{"undocumented operation"}
+	}
+
+	// every query param is declared and valid
+	params := make(map[string]map[string]interface{})
+	declared, _ := operation["parameters"].([]interface{})
+	for _, param := range declared {
+		param := param.(map[string]interface{})
+		params[param["in"].(string)+" "+param["name"].(string)] = param
+	}
+	for name, values := range req.URL.Query() {
+		param, ok := params["query "+name]
+		if !ok {
+			errs = append(errs, "undeclared query param "+name)
+			continue
+		}
+		schema := param["schema"].(map[string]interface{})
+		for _, value := range values {
+			var decoded interface{} = value
+			if schema["type"] != "string" {
+				json.Unmarshal([]byte(value), &decoded)
+			}
+			errs = append(errs, v.validate(schema, decoded, "query "+name)...)
+		}
+	}
+
+	// the body has a declared media type and matches its schema
+	if body != "" {
+		mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		schema := v.object("paths", template, strings.ToLower(req.Method), "requestBody", "content", mediaType, "schema")
+		if schema == nil {
+			errs = append(errs, "undeclared request media type "+mediaType)
+		} else if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+			errs = append(errs, v.validateJSON(schema, []byte(body), "request")...)
+		}
+	}
+
+	// the response status is declared, with the media type and schema of its body
+	responses := operation["responses"].(map[string]interface{})
+	response, ok := responses[strconv.Itoa(rr.Code)].(map[string]interface{})
+	if !ok {
+		return append(errs, fmt.Sprintf("undeclared response status %d", rr.Code))
+	}
+	content, _ := response["content"].(map[string]interface{})
+	if content == nil {
+		if rr.Body.Len() > 0 {
+			errs = append(errs, fmt.Sprintf("response %d declares no body", rr.Code))
+		}
+		return errs
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(rr.Header().Get("Content-Type"))
+	media, ok := content[mediaType].(map[string]interface{})
+	if !ok {
+		return append(errs, fmt.Sprintf("undeclared response media type %s for %d", mediaType, rr.Code))
+	}
+	if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+		errs = append(errs, v.validateJSON(media["schema"].(map[string]interface{}), rr.Body.Bytes(), "response")...)
+	}
+	return errs
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+
+	v := newSpecValidator(t, initTestModule(t, "memory"))
+	if v.doc["openapi"] != openAPIVersion {
+		t.Errorf("got openapi %v want %s", v.doc["openapi"], openAPIVersion)
+	}
+
+	// every documented route is an operation with its path params
+	operations := 0
+	for _, rt := range routes() {
+
+		operation := v.object("paths", rt.path, strings.ToLower(rt.method))
+		if rt.hidden {
+			if operation != nil {
+				t.Errorf("hidden route %s %s is documented", rt.method, rt.path)
+			}
+			continue
+		}
+		if operation == nil || operation["operationId"] != rt.name {
+			t.Errorf("route %s %s got operation %v", rt.method, rt.path, operation)
+			continue
+		}
+		operations++
+
+		var declared []string
+		params, _ := operation["parameters"].([]interface{})
+		for _, param := range params {
+			if param := param.(map[string]interface{}); param["in"] == "path" {
+				declared = append(declared, param["name"].(string))
+			}
+		}
+		if !reflect.DeepEqual(declared, pathVars(rt.path)) {
+			t.Errorf("route %s %s declares path params %v", rt.method, rt.path, declared)
+		}
+	}
+	if operations == 0 {
+		t.Errorf("no documented operation")
+	}
+
+	// every reference resolves
+	var walk func(node interface{}, at string)
+	walk = func(node interface{}, at string) {
+		switch node := node.(type) {
+		case map[string]interface{}:
+			if ref, ok := node["$ref"].(string); ok && v.resolve(node) == nil {
+				t.Errorf("%s: unresolved %s", at, ref)
+			}
+			keys := make([]string, 0, len(node))
+			for key := range node {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				walk(node[key], at+"/"+key)
+			}
+		case []interface{}:
+			for i, item := range node {
+				walk(item, at+"/"+strconv.Itoa(i))
+			}
+		}
+	}
+	walk(v.doc, "#")
+
+	// the Company schema follows the payload rules
+	company := v.object("components", "schemas", "Company")
+	valid, _ := json.Marshal(testCompany(1))
+	if errs := v.validateJSON(company, valid, "company"); len(errs) > 0 {
+		t.Errorf("valid company rejected: %v", errs)
+	}
+	for _, invalid := range []string{
+		`{"Client_ID": 1, "Company_ID": 1}`,
+		`{"Client_ID": 1, "Company_ID": 1, "Company_Name": "x", "Recruit_Status": "Hired"}`,
+		`{"Client_ID": 1, "Company_ID": 1, "Company_Name": "x", "Total_Backfill": -1}`,
+		`{"Client_ID": 1, "Company_ID": 1, "Company_Name": "x", "title": "x"}`,
+	} {
+		if errs := v.validateJSON(company, []byte(invalid), "company"); len(errs) == 0 {
+			t.Errorf("invalid company %s accepted", invalid)
+		}
+	}
+}
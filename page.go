@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// companyPage is the company list response envelope, the cursors are only set
+// when the adjacent page exists
+type companyPage struct {
+	Items      []Company `json:"items"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+	PrevCursor string    `json:"prev_cursor,omitempty"`
+	HasMore    bool      `json:"has_more"`
+	Total      *int      `json:"total,omitempty"`
+
+	// columns is the sparse fieldset of the items, every field when empty
+	columns []string
+}
+
+// MarshalJSON writes the items limited to the sparse fieldset
+func (p companyPage) MarshalJSON() ([]byte, error) {
+
+	// envelope drops the methods of companyPage to avoid recursing
+	type envelope companyPage
+
+	items := make([]companyView, len(p.Items))
+	for i, company := range p.Items {
+		items[i] = companyView{company, p.columns}
+	}
+
+	return json.Marshal(struct {
+		envelope
+		Items []companyView `json:"items"`
+	}{envelope(p), items})
+}
+
+// listPage returns the page of companies after opts.After, or before it when
+// prev is set, with the cursors of the adjacent pages
+func (app *App) listPage(ctx context.Context, opts ListOptions, prev bool) (companyPage, error) {
+
+	keys := opts.sortKeys()
+
+	// the previous page is the next one in the reverse order
+	query := opts
+	if prev {
+		query.Sort = reverseSort(keys)
+	}
+
+	// fetch one more company to know whether there is another page
+	if opts.Limit > 0 {
+		query.Limit = opts.Limit + 1
+	}
+
+	companies, err := app.Store.List(ctx, query)
+	if err != nil {
+		return companyPage{}, err
+	}
+	more := opts.Limit > 0 && len(companies) > opts.Limit
+	if more {
+		companies = companies[:opts.Limit]
+	}
+	if prev {
+		for i, j := 0, len(companies)-1; i < j; i, j = i+1, j-1 {
+			companies[i], companies[j] = companies[j], companies[i]
+		}
+	}
+
+	page := companyPage{Items: make([]Company, 0, len(companies))}
+	page.Items = append(page.Items, companies...)
+	if len(companies) == 0 {
+		return page, nil
+	}
+
+	// a cursor always has a page on its other side
+	hasNext, hasPrev := more, opts.After != nil
+	if prev {
+		hasNext, hasPrev = true, more
+	}
+
+	if hasNext {
+		if page.NextCursor, err = encodeCursor(app.cursorKey, keys, companies[len(companies)-1], false); err != nil {
+			return companyPage{}, err
+		}
+	}
+	if hasPrev {
+		if page.PrevCursor, err = encodeCursor(app.cursorKey, keys, companies[0], true); err != nil {
+			return companyPage{}, err
+		}
+	}
+	page.HasMore = hasNext
+	return page, nil
+}
+
+// setPageLinks sets the RFC 8288 Link header to the adjacent pages, keeping the
+// other query params of the request
+func setPageLinks(w http.ResponseWriter, r *http.Request, page companyPage) {
+
+	var links []string
+	for _, link := range []struct {
+		rel    string
+		cursor string
+	}{
+		{"next", page.NextCursor},
+		{"prev", page.PrevCursor},
+	} {
+		if link.cursor == "" {
+			continue
+		}
+
+		// the cursor replaces the legacy id
+		query := r.URL.Query()
+		query.Del("id")
+		query.Set("cursor", link.cursor)
+		links = append(links, "<"+r.URL.Path+"?"+query.Encode()+`>; rel="`+link.rel+`"`)
+	}
+
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
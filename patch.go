@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// PATCH document media types
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+)
+
+type (
+
+	// jsonPatchOp is a single RFC 6902 JSON Patch operation, missing members are
+	// told apart from empty pointers and null values by nil
+	jsonPatchOp struct {
+		Op    string          `json:"op"`
+		Path  *string         `json:"path"`
+		From  *string         `json:"from"`
+		Value json.RawMessage `json:"value"`
+	}
+
+	// patchConflict reports a patch that cannot be applied to the current
+	// document, as opposed to a malformed patch
+	patchConflict struct {
+		message string
+	}
+)
+
+func (err patchConflict) Error() string {
+	return err.message
+}
+
+// applyPatch applies the merge-patch or JSON Patch document read from body to
+// the company, and returns the patched company JSON
+func applyPatch(mediaType string, company Company, body io.Reader) ([]byte, error) {
+
+	data, err := json.Marshal(company)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := decodeJSONValue(data)
+	if err != nil {
+		return nil, err
+	}
+
+	patch, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch mediaType {
+	case mergePatchType:
+		value, err := decodeJSONValue(patch)
+		if err != nil {
+			return nil, fmt.Errorf("invalid merge patch : %w", err)
+		}
+		doc = mergePatch(doc, value)
+
+	case jsonPatchType:
+		var ops []jsonPatchOp
+		if err = json.Unmarshal(patch, &ops); err != nil {
+			return nil, fmt.Errorf("invalid JSON patch : %w", err)
+		}
+		if doc, err = applyJSONPatch(doc, ops); err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported patch media type %q", mediaType)
+	}
+
+	return json.Marshal(doc)
+}
+
+// decodeJSONValue decodes a JSON document, keeping the exact numbers
+func decodeJSONValue(data []byte) (value interface{}, err error) {
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err = decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, errors.New("trailing data after the JSON document")
+	}
+	return value, nil
+}
+
+// mergePatch applies an RFC 7396 merge patch to target
+func mergePatch(target, patch interface{}) interface{} {
+
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{}, len(patchObject))
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+		} else {
+			targetObject[key] = mergePatch(targetObject[key], value)
+		}
+	}
+	return targetObject
+}
+
+// applyJSONPatch applies the RFC 6902 operations to doc in order, stopping at
+// the first failing one
+func applyJSONPatch(doc interface{}, ops []jsonPatchOp) (interface{}, error) {
+
+	for i, op := range ops {
+
+		if op.Path == nil {
+			return nil, fmt.Errorf("operation %d : missing path", i)
+		}
+		path, err := parsePointer(*op.Path)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d : %w", i, err)
+		}
+
+		// value returns the decoded value of the operation
+		value := func() (interface{}, error) {
+			if op.Value == nil {
+				return nil, fmt.Errorf("operation %d : %s needs a value", i, op.Op)
+			}
+			return decodeJSONValue(op.Value)
+		}
+
+		// from returns the parsed from pointer of the operation
+		from := func() ([]string, error) {
+			if op.From == nil {
+				return nil, fmt.Errorf("operation %d : %s needs from", i, op.Op)
+			}
+			return parsePointer(*op.From)
+		}
+
+		switch op.Op {
+		case "add", "replace", "test":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			switch op.Op {
+			case "add":
+				doc, err = addValue(doc, path, v)
+			case "replace":
+				if doc, err = removeValue(doc, path); err == nil {
+					doc, err = addValue(doc, path, v)
+				}
+			case "test":
+				var current interface{}
+				if current, err = getValue(doc, path); err == nil && !jsonEqual(current, v) {
+					err = patchConflict{"test failed at " + *op.Path}
+				}
+			}
+			if err != nil {
+				return nil, fmt.Errorf("operation %d : %w", i, err)
+			}
+
+		case "remove":
+			if doc, err = removeValue(doc, path); err != nil {
+				return nil, fmt.Errorf("operation %d : %w", i, err)
+			}
+
+		case "move", "copy":
+			fromPath, err := from()
+			if err != nil {
+				return nil, err
+			}
+			if op.Op == "move" && len(path) > len(fromPath) && isPrefix(fromPath, path) {
+				return nil, fmt.Errorf("operation %d : cannot move %s into itself", i, *op.From)
+			}
+
+			v, err := getValue(doc, fromPath)
+			if err == nil && op.Op == "move" {
+				doc, err = removeValue(doc, fromPath)
+			}
+			if err == nil && op.Op == "copy" {
+				v, err = copyJSONValue(v)
+			}
+			if err == nil {
+				doc, err = addValue(doc, path, v)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("operation %d : %w", i, err)
+			}
+
+		default:
+			return nil, fmt.Errorf("operation %d : unknown op %q", i, op.Op)
+		}
+	}
+	return doc, nil
+}
+
+// parsePointer splits an RFC 6901 JSON pointer into its unescaped tokens
+func parsePointer(pointer string) ([]string, error) {
+
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+// isPrefix reports whether prefix is a leading part of path
+func isPrefix(prefix, path []string) bool {
+
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// arrayIndex parses an array index token, size is the largest accepted index
+func arrayIndex(token string, size int) (int, error) {
+
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || index > size || (len(token) > 1 && token[0] == '0') {
+		return 0, patchConflict{fmt.Sprintf("invalid array index %q", token)}
+	}
+	return index, nil
+}
+
+// getValue returns the value at path
+func getValue(doc interface{}, path []string) (interface{}, error) {
+
+	for _, token := range path {
+		switch container := doc.(type) {
+		case map[string]interface{}:
+			value, ok := container[token]
+			if !ok {
+				return nil, patchConflict{fmt.Sprintf("no member %q", token)}
+			}
+			doc = value
+		case []interface{}:
+			index, err := arrayIndex(token, len(container)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = container[index]
+		default:
+			return nil, patchConflict{fmt.Sprintf("cannot descend into %q", token)}
+		}
+	}
+	return doc, nil
+}
+
+// updateParent applies fn to the container holding the last token of path,
+// and returns the updated document
+func updateParent(doc interface{}, path []string, fn func(container interface{}, token string) (interface{}, error)) (interface{}, error) {
+
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+
+	child, err := getValue(doc, path[:1])
+	if err != nil {
+		return nil, err
+	}
+	if child, err = updateParent(child, path[1:], fn); err != nil {
+		return nil, err
+	}
+
+	// arrays may have been reallocated
+	switch container := doc.(type) {
+	case map[string]interface{}:
+		container[path[0]] = child
+	case []interface{}:
+		index, _ := arrayIndex(path[0], len(container)-1)
+		container[index] = child
+	}
+	return doc, nil
+}
+
+// addValue adds or replaces a member, or inserts an array element, at path
+func addValue(doc interface{}, path []string, value interface{}) (interface{}, error) {
+
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return updateParent(doc, path, func(container interface{}, token string) (interface{}, error) {
+		switch container := container.(type) {
+		case map[string]interface{}:
+			container[token] = value
+			return container, nil
+		case []interface{}:
+			if token == "-" {
+				return append(container, value), nil
+			}
+			index, err := arrayIndex(token, len(container))
+			if err != nil {
+				return nil, err
+			}
+			container = append(container, nil)
+			copy(container[index+1:], container[index:])
+			container[index] = value
+			return container, nil
+		}
+		return nil, patchConflict{fmt.Sprintf("cannot add %q to a scalar", token)}
+	})
+}
+
+// removeValue removes the member or array element at path
+func removeValue(doc interface{}, path []string) (interface{}, error) {
+
+	if len(path) == 0 {
+		return nil, nil
+	}
+
+	return updateParent(doc, path, func(container interface{}, token string) (interface{}, error) {
+		switch container := container.(type) {
+		case map[string]interface{}:
+			if _, ok := container[token]; !ok {
+				return nil, patchConflict{fmt.Sprintf("no member %q", token)}
+			}
+			delete(container, token)
+			return container, nil
+		case []interface{}:
+			index, err := arrayIndex(token, len(container)-1)
+			if err != nil {
+				return nil, err
+			}
+			return append(container[:index], container[index+1:]...), nil
+		}
+		return nil, patchConflict{fmt.Sprintf("cannot remove %q from a scalar", token)}
+	})
+}
+
+// copyJSONValue returns a deep copy of a decoded JSON value
+func copyJSONValue(value interface{}) (interface{}, error) {
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSONValue(data)
+}
+
+// jsonEqual compares decoded JSON values, numbers by their value
+func jsonEqual(a, b interface{}) bool {
+
+	switch a := a.(type) {
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for key, value := range a {
+			other, ok := b[key]
+			if !ok || !jsonEqual(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !jsonEqual(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		x, okA := new(big.Float).SetString(a.String())
+		y, okB := new(big.Float).SetString(b.String())
+		return okA && okB && x.Cmp(y) == 0
+	}
+	return a == b
+}
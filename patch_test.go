@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestMergePatch(t *testing.T) {
+
+	// RFC 7396 appendix A
+	for _, tc := range []struct {
+		target, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	} {
+		target, _ := decodeJSONValue([]byte(tc.target))
+		patch, _ := decodeJSONValue([]byte(tc.patch))
+		got, _ := json.Marshal(mergePatch(target, patch))
+		if string(got) != tc.want {
+			t.Errorf("%s + %s: got %s want %s", tc.target, tc.patch, got, tc.want)
+		}
+	}
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+
+	// RFC 6902 appendix A
+	for _, tc := range []struct {
+		doc, patch, want string
+		conflict         bool
+	}{
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`, false},
+		{`{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`, false},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`, false},
+		{`{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`, false},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`, false},
+		{`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`, false},
+		{`{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`, false},
+		{`{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2.0}]`, `{"baz":"qux","foo":["a",2,"c"]}`, false},
+		{`{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, ``, true},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`, `{"child":{"grandchild":{}},"foo":"bar"}`, false},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, ``, true},
+		{`{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10}]`, `{"/":9,"~1":10}`, false},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`, false},
+		{`{"foo":null}`, `[{"op":"copy","from":"/foo","path":"/bar"}]`, `{"bar":null,"foo":null}`, false},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"},{"op":"remove","path":"/nope"}]`, ``, true},
+	} {
+		doc, _ := decodeJSONValue([]byte(tc.doc))
+		var ops []jsonPatchOp
+		if err := json.Unmarshal([]byte(tc.patch), &ops); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := applyJSONPatch(doc, ops)
+		var conflict patchConflict
+		if tc.conflict {
+			if !errors.As(err, &conflict) {
+				t.Errorf("%s: got %v want conflict", tc.patch, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.patch, err)
+			continue
+		}
+		data, _ := json.Marshal(got)
+		if string(data) != tc.want {
+			t.Errorf("%s: got %s want %s", tc.patch, data, tc.want)
+		}
+	}
+
+	// malformed operations are not conflicts
+	for _, patch := range []string{
+		`[{"op":"add","value":1}]`,
+		`[{"op":"add","path":"/a"}]`,
+		`[{"op":"move","path":"/a"}]`,
+		`[{"op":"frobnicate","path":"/a"}]`,
+		`[{"op":"remove","path":"a"}]`,
+		`[{"op":"move","from":"/a","path":"/a/b"}]`,
+	} {
+		var ops []jsonPatchOp
+		json.Unmarshal([]byte(patch), &ops)
+		doc, _ := decodeJSONValue([]byte(`{"a":{}}`))
+
+		var conflict patchConflict
+		if _, err := applyJSONPatch(doc, ops); err == nil || errors.As(err, &conflict) {
+			t.Errorf("%s: got %v want a malformed patch error", patch, err)
+		}
+	}
+}
+
+func TestUpdateColumns(t *testing.T) {
+
+	for _, dbType := range testDBTypes() {
+
+		ctx := context.Background()
+		app := initTestModule(t, dbType)
+
+		company := testCompany(1)
+		if err := app.Store.Create(ctx, &company); err != nil {
+			t.Fatal(err)
+		}
+
+		// only the listed column is written
+		if err := app.Store.UpdateColumns(ctx, 1, &Company{Recruit_Status: "Filled"}, []string{"Recruit_Status"}); err != nil {
+			t.Fatal(err)
+		}
+		stored, err := app.Store.Get(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		company.Recruit_Status = "Filled"
+		if !sameCompany(stored, company) {
+			t.Errorf("%s: got %+v want %+v", dbType, stored, company)
+		}
+
+		if err = app.Store.UpdateColumns(ctx, 2, &company, []string{"ASIC"}); err != ErrCompanyNotFound {
+			t.Errorf("%s: update unknown got %v want %v", dbType, err, ErrCompanyNotFound)
+		}
+	}
+}
+
+func TestPatchCompany(t *testing.T) {
+
+	for _, dbType := range testDBTypes() {
+
+		app := initTestModule(t, dbType)
+
+		company := testCompany(1)
+		if err := app.Store.Create(context.Background(), &company); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tc := range []struct {
+			name        string
+			contentType string
+			companyID   string
+			body        string
+			status      int
+		}{
+			{"merge patch", mergePatchType, "1", `{"Recruit_Status": "On Hold", "ASIC": null}`, http.StatusOK},
+			{"JSON patch", jsonPatchType + "; charset=utf-8", "1", `[{"op": "test", "path": "/Recruit_Status", "value": "On Hold"}, {"op": "replace", "path": "/Total_Backfill", "value": 7}]`, http.StatusOK},
+			{"failed test", jsonPatchType, "1", `[{"op": "test", "path": "/Recruit_Status", "value": "Open"}]`, http.StatusConflict},
+			{"plain JSON", "application/json", "1", `{"Recruit_Status": "Open"}`, http.StatusUnsupportedMediaType},
+			{"malformed", mergePatchType, "1", `{"Recruit_Status": `, http.StatusBadRequest},
+			{"invalid status", mergePatchType, "1", `{"Recruit_Status": "Hired"}`, http.StatusUnprocessableEntity},
+			{"removed name", jsonPatchType, "1", `[{"op": "remove", "path": "/Company_Name"}]`, http.StatusUnprocessableEntity},
+			{"changed key", mergePatchType, "1", `{"Company_ID": 2}`, http.StatusUnprocessableEntity},
+			{"unknown field", mergePatchType, "1", `{"title": "x"}`, http.StatusUnprocessableEntity},
+			{"unknown company", mergePatchType, "2", `{"ASIC": "1"}`, http.StatusNotFound},
+		} {
+			req := httptest.NewRequest("PATCH", "/Company_Detail/"+tc.companyID, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", tc.contentType)
+			req = mux.SetURLVars(req, map[string]string{"Company_ID": tc.companyID})
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(app.patchCompany).ServeHTTP(rr, req)
+
+			if rr.Code != tc.status {
+				t.Errorf("%s %s: got status %d want %d : %s", dbType, tc.name, rr.Code, tc.status, rr.Body)
+			}
+		}
+
+		// the successful patches were applied on top of each other
+		company.Recruit_Status = "On Hold"
+		company.ASIC = ""
+		company.Total_Backfill = newNullInt(7)
+
+		stored, err := app.Store.Get(context.Background(), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameCompany(stored, company) {
+			t.Errorf("%s: got %+v want %+v", dbType, stored, company)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// requestIDHeader carries the request id, generated when the client sends none
+const requestIDHeader = "X-Request-ID"
+
+// problem is an RFC 7807 problem details body
+type problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+
+	// Errors lists the rejected fields of a 422 response
+	Errors validationErrors `json:"errors,omitempty"`
+}
+
+// problemTypes maps the returned status codes to their problem type
+var problemTypes = map[int]string{
+	http.StatusBadRequest:            "/problems/bad-request",
+	http.StatusNotFound:              "/problems/not-found",
+	http.StatusMethodNotAllowed:      "/problems/method-not-allowed",
+	http.StatusNotAcceptable:         "/problems/not-acceptable",
+	http.StatusConflict:              "/problems/conflict",
+	http.StatusPreconditionFailed:    "/problems/precondition-failed",
+	http.StatusRequestEntityTooLarge: "/problems/payload-too-large",
+	http.StatusUnsupportedMediaType:  "/problems/unsupported-media-type",
+	http.StatusUnprocessableEntity:   "/problems/validation-error",
+	http.StatusInternalServerError:   "/problems/internal-error",
+	http.StatusServiceUnavailable:    "/problems/unavailable",
+}
+
+// writeProblem sends a problem details body with the given status
+func (app *App) writeProblem(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	app.writeProblemDetails(w, r, problem{Status: status, Detail: detail})
+}
+
+// writeProblemDetails fills in the type, title and request id of p and sends it
+func (app *App) writeProblemDetails(w http.ResponseWriter, r *http.Request, p problem) {
+
+	p.Type = problemTypes[p.Status]
+	if p.Type == "" {
+		p.Type = "about:blank"
+	}
+	p.Title = http.StatusText(p.Status)
+	p.RequestID = requestID(r)
+
+	app.logger.Printf("request %s : %d %s", p.RequestID, p.Status, p.Detail)
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// writeJSON sends v as a JSON body with the given status
+func (app *App) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		app.logger.Println(err)
+	}
+}
+
+// writeStoreError maps a CompanyStore error to its problem details response,
+// internal errors are logged but not exposed to the client
+func (app *App) writeStoreError(w http.ResponseWriter, r *http.Request, err error) {
+
+	status, detail := app.storeErrorStatus(err)
+	app.writeProblem(w, r, status, detail)
+}
+
+// storeErrorStatus returns the status and detail answering a CompanyStore error,
+// logging internal errors
+func (app *App) storeErrorStatus(err error) (int, string) {
+
+	switch {
+	case errors.Is(err, ErrCompanyNotFound):
+		return http.StatusNotFound, err.Error()
+	case errors.Is(err, ErrCompanyExists), errors.Is(err, ErrCompanyOfOtherClient):
+		return http.StatusConflict, err.Error()
+	case errors.Is(err, errPreconditionFailed):
+		return http.StatusPreconditionFailed, err.Error()
+	case isUnavailable(err):
+		app.logger.Println(err.Error())
+		return http.StatusServiceUnavailable, "database unavailable"
+	}
+	app.logger.Println(err.Error())
+	return http.StatusInternalServerError, "database error"
+}
+
+// isUnavailable reports whether err means the database cannot be reached
+func isUnavailable(err error) bool {
+
+	var opErr *net.OpError
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.As(err, &opErr)
+}
+
+// requestID returns the id of the request, see withRequestID
+func requestID(r *http.Request) string {
+	return r.Header.Get(requestIDHeader)
+}
+
+// withRequestID makes sure every request carries an id, echoed in the response
+func withRequestID(next http.Handler) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		id := r.Header.Get(requestIDHeader)
+		if id == "" {
+			buf := make([]byte, 8)
+			rand.Read(buf)
+			id = hex.EncodeToString(buf)
+			r.Header.Set(requestIDHeader, id)
+		}
+
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// notFound answers requests to unknown routes
+func (app *App) notFound(w http.ResponseWriter, r *http.Request) {
+	app.writeProblem(w, r, http.StatusNotFound, "no route for "+r.URL.Path)
+}
+
+// methodNotAllowed answers requests with a method the route does not handle
+func (app *App) methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	app.writeProblem(w, r, http.StatusMethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// failingStore fails every CompanyStore call with err
+type failingStore struct {
+	CompanyStore
+	err error
+}
+
+func (s failingStore) List(ctx context.Context, opts ListOptions) ([]Company, error) {
+	return nil, s.err
+}
+
+func (s failingStore) Batch(ctx context.Context, ops []BatchOp, atomic bool) ([]error, error) {
+	return make([]error, len(ops)), s.err
+}
+
+func (s failingStore) Each(ctx context.Context, opts ListOptions, fn func(company Company) error) error {
+	return s.err
+}
+
+func TestProblemResponses(t *testing.T) {
+
+	app := initTestModule(t, "memory")
+
+	company := testCompany(1)
+	if err := app.Store.Create(context.Background(), &company); err != nil {
+		t.Fatal(err)
+	}
+	payload, _ := json.Marshal(company)
+
+	for name, tc := range map[string]struct {
+		handler http.HandlerFunc
+		method  string
+		url     string
+		body    []byte
+		vars    map[string]string
+		store   CompanyStore
+		status  int
+	}{
+		"malformed payload": {app.createNewCompany, "POST", "/Company_Detail", []byte(`{"Company_ID":`), nil, nil, http.StatusBadRequest},
+		"duplicate company": {app.createNewCompany, "POST", "/Company_Detail", payload, nil, nil, http.StatusConflict},
+		"invalid limit":     {app.returnAllCompany_Detail, "GET", "/Company_Detail?limit=ten", nil, nil, nil, http.StatusBadRequest},
+		"invalid id":        {app.returnSingleCompany, "GET", "/Company_Detail/abc", nil, map[string]string{"Company_ID": "abc"}, nil, http.StatusBadRequest},
+		"missing company":   {app.returnSingleCompany, "GET", "/Company_Detail/2", nil, map[string]string{"Company_ID": "2"}, nil, http.StatusNotFound},
+		"missing update":    {app.updateCompany, "PUT", "/Company_Detail/2", payload, map[string]string{"Company_ID": "2"}, nil, http.StatusNotFound},
+		"missing delete":    {app.deleteCompany, "DELETE", "/Company_Detail/2", nil, map[string]string{"Company_ID": "2"}, nil, http.StatusNotFound},
+		"database down":     {app.returnAllCompany_Detail, "GET", "/Company_Detail", nil, nil, failingStore{err: driver.ErrBadConn}, http.StatusServiceUnavailable},
+		"database error":    {app.returnAllCompany_Detail, "GET", "/Company_Detail", nil, nil, failingStore{err: errors.New("syntax error")}, http.StatusInternalServerError},
+		"invalid format":    {app.returnAllCompany_Detail, "GET", "/Company_Detail?format=pdf", nil, nil, nil, http.StatusBadRequest},
+		"export down":       {app.returnAllCompany_Detail, "GET", "/Company_Detail?format=csv", nil, nil, failingStore{err: driver.ErrBadConn}, http.StatusServiceUnavailable},
+	} {
+		store := app.Store
+		if tc.store != nil {
+			app.Store = tc.store
+		}
+
+		req := httptest.NewRequest(tc.method, tc.url, bytes.NewReader(tc.body))
+		req.Header.Set(requestIDHeader, "test-request")
+		if tc.vars != nil {
+			req = mux.SetURLVars(req, tc.vars)
+		}
+
+		rr := httptest.NewRecorder()
+		tc.handler.ServeHTTP(rr, req)
+		app.Store = store
+
+		var body problem
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Errorf("%s: invalid problem body: %v", name, err)
+			continue
+		}
+
+		if rr.Code != tc.status || body.Status != tc.status {
+			t.Errorf("%s: got status %d / %d want %d", name, rr.Code, body.Status, tc.status)
+		}
+		if rr.Header().Get("Content-Type") != "application/problem+json" {
+			t.Errorf("%s: got content type %q", name, rr.Header().Get("Content-Type"))
+		}
+		if body.Type != problemTypes[tc.status] || body.Title != http.StatusText(tc.status) || body.RequestID != "test-request" {
+			t.Errorf("%s: unexpected problem %+v", name, body)
+		}
+	}
+}
+
+func TestWithRequestID(t *testing.T) {
+
+	app := initTestModule(t, "memory")
+	handler := withRequestID(http.HandlerFunc(app.notFound))
+
+	// a missing id is generated and echoed
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/unknown", nil))
+
+	var body problem
+	json.NewDecoder(rr.Body).Decode(&body)
+	if body.RequestID == "" || rr.Header().Get(requestIDHeader) != body.RequestID {
+		t.Errorf("request id not generated: header %q body %q", rr.Header().Get(requestIDHeader), body.RequestID)
+	}
+
+	// a client id is kept
+	req := httptest.NewRequest("GET", "/unknown", nil)
+	req.Header.Set(requestIDHeader, "client-id")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Header().Get(requestIDHeader) != "client-id" {
+		t.Errorf("client request id replaced by %q", rr.Header().Get(requestIDHeader))
+	}
+}
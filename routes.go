@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"text/tabwriter"
+
+	"github.com/gorilla/mux"
+)
+
+// route is a single endpoint of the API. The route table feeds the router, the
+// homepage listing, the OpenAPI document and the route tests, so they cannot
+// drift apart
+type route struct {
+	name    string // handler name, also the mux route name and OpenAPI operationId
+	method  string
+	path    string // mux path template, the path variables are read by the handler
+	summary string
+	handler func(app *App) http.HandlerFunc
+
+	prefix bool         // path matches every path below it
+	hidden bool         // left out of the OpenAPI document
+	doc    operationDoc // params, bodies and responses of the OpenAPI document
+
+	// v1 is the snake_case path serving the same handler under /v1, see
+	// withV1Routes. The legacy route is deprecated
+	v1         string
+	snakeCase  bool // /v1 route, its path vars, params and JSON keys are snake_case
+	deprecated bool // answered with the Deprecation and Sunset headers
+}
+
+// routes lists every endpoint of the API, a function since the homepage lists them
+func routes() []route {
+
+	return withV1Routes([]route{
+		{
+			name: "homepage", method: "GET", path: "/",
+			summary: "this list of routes",
+			handler: func(app *App) http.HandlerFunc { return app.homepage },
+			doc: operationDoc{
+				responses: map[int]string{200: textSchema},
+			},
+		},
+		{
+			name: "returnAllCompany_Detail", method: "GET", path: "/Company_Detail",
+			v1:      "/v1/companies",
+			summary: "list the companies, filtered, sorted and paged by the query params, or export them",
+			handler: func(app *App) http.HandlerFunc { return app.returnAllCompany_Detail },
+			doc: operationDoc{
+				params:    append(listParams(), fieldsParam, formatParam),
+				responses: map[int]string{200: "CompanyPage", 400: problemSchema},
+				formats:   []string{formatCSV, formatNDJSON, formatXLSX},
+			},
+		},
+		{
+			name: "createNewCompany", method: "POST", path: "/Company_Detail",
+			v1:      "/v1/companies",
+			summary: "create a company, retried safely with an Idempotency-Key",
+			handler: func(app *App) http.HandlerFunc { return app.idempotent(app.createNewCompany) },
+			doc: operationDoc{
+				params:    []paramDoc{idempotencyKeyParam},
+				body:      map[string]string{"application/json": "Company"},
+				responses: map[int]string{200: "Company", 400: problemSchema, 409: problemSchema, 422: problemSchema},
+			},
+		},
+		{
+			name: "batchCompanies", method: "POST", path: "/Company_Detail:batch",
+			v1:      "/v1/companies:batch",
+			summary: "create, upsert and delete companies in one request",
+			handler: func(app *App) http.HandlerFunc { return app.idempotent(app.batchCompanies) },
+			doc: operationDoc{
+				params: []paramDoc{idempotencyKeyParam},
+				body:   map[string]string{"application/json": "BatchRequest"},
+				responses: map[int]string{
+					200: "BatchResponse", 207: "BatchResponse", 400: problemSchema, 404: "BatchResponse",
+					409: "BatchResponse", 422: "BatchResponse",
+				},
+			},
+		},
+		{
+			name: "importCompanyFile", method: "POST", path: "/Company_Detail/import",
+			v1:      "/v1/companies:import",
+			summary: "upsert the companies of a CSV or XLSX file in chunks of a transaction each, or only validate them",
+			handler: func(app *App) http.HandlerFunc { return app.importCompanyFile },
+			doc: operationDoc{
+				params:    importParams(),
+				body:      map[string]string{"text/csv": "ImportFile", xlsxType: "ImportFile"},
+				responses: map[int]string{200: "ImportReport", 207: "ImportReport", 400: problemSchema, 413: problemSchema, 415: problemSchema, 422: "ImportReport"},
+				formats:   []string{formatCSV},
+			},
+		},
+		{
+			name: "returnSingleCompany", method: "GET", path: "/Company_Detail/{Company_ID}",
+			v1:      "/v1/companies/{company_id}",
+			summary: "read a company, or export it",
+			handler: func(app *App) http.HandlerFunc { return app.returnSingleCompany },
+			doc: operationDoc{
+				params:    []paramDoc{fieldsParam, formatParam, ifNoneMatchParam},
+				responses: map[int]string{200: "CompanyView", 304: noContent, 400: problemSchema, 404: problemSchema},
+				formats:   []string{formatCSV, formatNDJSON, formatXLSX},
+			},
+		},
+		{
+			name: "updateCompany", method: "PUT", path: "/Company_Detail/{Company_ID}",
+			v1:      "/v1/companies/{company_id}",
+			summary: "replace a company",
+			handler: func(app *App) http.HandlerFunc { return app.updateCompany },
+			doc: operationDoc{
+				params:    []paramDoc{ifMatchParam},
+				body:      map[string]string{"application/json": "Company"},
+				responses: map[int]string{200: "Company", 400: problemSchema, 404: problemSchema, 409: problemSchema, 412: problemSchema, 422: problemSchema},
+			},
+		},
+		{
+			name: "patchCompany", method: "PATCH", path: "/Company_Detail/{Company_ID}",
+			v1:      "/v1/companies/{company_id}",
+			summary: "update some fields of a company with a merge patch or JSON Patch",
+			handler: func(app *App) http.HandlerFunc { return app.patchCompany },
+			doc: operationDoc{
+				params:    []paramDoc{ifMatchParam},
+				body:      map[string]string{mergePatchType: "MergePatch", jsonPatchType: "JSONPatch"},
+				responses: map[int]string{200: "Company", 400: problemSchema, 404: problemSchema, 409: problemSchema, 412: problemSchema, 415: problemSchema, 422: problemSchema},
+			},
+		},
+		{
+			name: "deleteCompany", method: "DELETE", path: "/Company_Detail/{Company_ID}",
+			v1:      "/v1/companies/{company_id}",
+			summary: "delete a company",
+			handler: func(app *App) http.HandlerFunc { return app.deleteCompany },
+			doc: operationDoc{
+				params:    []paramDoc{ifMatchParam},
+				responses: map[int]string{200: noContent, 400: problemSchema, 404: problemSchema, 412: problemSchema},
+			},
+		},
+		{
+			name: "upsertCompany", method: "PUT", path: "/clients/{Client_ID}/companies/{Company_ID}",
+			v1:      "/v1/clients/{client_id}/companies/{company_id}",
+			summary: "create or replace a company of a client",
+			handler: func(app *App) http.HandlerFunc { return app.upsertCompany },
+			doc: operationDoc{
+				body:      map[string]string{"application/json": "Company"},
+				responses: map[int]string{200: "Company", 201: "Company", 400: problemSchema, 409: problemSchema, 422: problemSchema},
+			},
+		},
+		{
+			name: "openAPI", method: "GET", path: "/openapi.json",
+			summary: "this OpenAPI document",
+			handler: func(app *App) http.HandlerFunc { return app.openAPI },
+			doc: operationDoc{
+				responses: map[int]string{200: "OpenAPIDocument"},
+			},
+		},
+		{
+			name: "docs", method: "GET", path: "/docs",
+			summary: "Swagger UI of the OpenAPI document",
+			handler: func(app *App) http.HandlerFunc { return app.docs },
+			prefix:  true,
+			hidden:  true,
+		},
+	})
+}
+
+// withV1Routes adds the /v1 route of every route with a v1 path, after the
+// legacy routes. The legacy route is deprecated, both share its handler
+func withV1Routes(table []route) []route {
+
+	var v1Routes []route
+	for i, rt := range table {
+		if rt.v1 == "" {
+			continue
+		}
+		handler := rt.handler
+
+		v1 := rt
+		v1.name, v1.path, v1.v1 = "v1."+rt.name, rt.v1, ""
+		v1.snakeCase = true
+		v1.handler = func(app *App) http.HandlerFunc { return app.v1(handler(app)) }
+		v1Routes = append(v1Routes, v1)
+
+		table[i].summary = rt.summary + ", deprecated for " + rt.v1
+		table[i].deprecated = true
+		table[i].handler = func(app *App) http.HandlerFunc { return app.deprecated(handler(app)) }
+	}
+	return append(table, v1Routes...)
+}
+
+// newRouter registers every route of the table, unknown routes answer with
+// problem details
+func (app *App) newRouter() *mux.Router {
+
+	router := mux.NewRouter().StrictSlash(true)
+	router.NotFoundHandler = http.HandlerFunc(app.notFound)
+	router.MethodNotAllowedHandler = http.HandlerFunc(app.methodNotAllowed)
+
+	for _, rt := range routes() {
+		if rt.prefix {
+			router.PathPrefix(rt.path).HandlerFunc(rt.handler(app)).Methods(rt.method).Name(rt.name)
+		} else {
+			router.HandleFunc(rt.path, rt.handler(app)).Methods(rt.method).Name(rt.name)
+		}
+	}
+	return router
+}
+
+//	GET /
+//
+// home page of web server, listing the routes
+func (app *App) homepage(w http.ResponseWriter, r *http.Request) {
+
+	app.logger.Println("Endpoint hit : homepage")
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "golang-rest-api-demo, see the README for the payloads and query params")
+	fmt.Fprintln(w)
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, rt := range routes() {
+		fmt.Fprintf(table, "%s\t%s\t%s\n", rt.method, rt.path, rt.summary)
+	}
+	table.Flush()
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestRouteTable(t *testing.T) {
+
+	names := make(map[string]bool)
+	endpoints := make(map[string]bool)
+	for _, rt := range routes() {
+
+		if names[rt.name] {
+			t.Errorf("route name %s is repeated", rt.name)
+		}
+		names[rt.name] = true
+
+		endpoint := rt.method + " " + rt.path
+		if endpoints[endpoint] {
+			t.Errorf("route %s is repeated", endpoint)
+		}
+		endpoints[endpoint] = true
+
+		if rt.summary == "" || rt.handler == nil {
+			t.Errorf("route %s needs a summary and a handler", endpoint)
+		}
+	}
+}
+
+func TestRouteConformance(t *testing.T) {
+
+	for _, dbType := range testDBTypes() {
+
+		app := initTestModule(t, dbType)
+		spec := newSpecValidator(t, app)
+		seed := testCompany(1)
+		if err := app.Store.Create(context.Background(), &seed); err != nil {
+			t.Fatal(err)
+		}
+
+		company := func(companyID int) string {
+			payload, _ := json.Marshal(testCompany(companyID))
+			return string(payload)
+		}
+		companyVars := map[string]string{"Company_ID": "1"}
+
+		// the /v1 payloads use the snake_case keys
+		v1Company := func(companyID int) string {
+			var fields map[string]interface{}
+			json.Unmarshal([]byte(company(companyID)), &fields)
+			snakeCase := make(map[string]interface{})
+			for key, value := range fields {
+				snakeCase[strings.ToLower(key)] = value
+			}
+			payload, _ := json.Marshal(snakeCase)
+			return string(payload)
+		}
+		v1Vars := map[string]string{"company_id": "5"}
+
+		// every route is reached with its path variables, in an order where
+		// each request succeeds
+		reached := make(map[string]bool)
+		for _, tc := range []struct {
+			method      string
+			path        string
+			body        string
+			contentType string
+			route       string // route reached, empty for unknown routes
+			vars        map[string]string
+			status      int
+		}{
+			{"GET", "/", "", "", "homepage", nil, http.StatusOK},
+			{"GET", "/Company_Detail?limit=1&sort=-Company_Name", "", "", "returnAllCompany_Detail", nil, http.StatusOK},
+			{"GET", "/Company_Detail?format=xlsx", "", "", "returnAllCompany_Detail", nil, http.StatusOK},
+			{"POST", "/Company_Detail", company(2), "application/json", "createNewCompany", nil, http.StatusOK},
+			{"POST", "/Company_Detail:batch", `{"operations": [{"op": "delete", "Company_ID": 2}]}`, "application/json", "batchCompanies", nil, http.StatusOK},
+			{"POST", "/Company_Detail/import?map=Name=Company_Name&chunk_size=10", "Client_ID,Company_ID,Name\n2399029309,2,TEST_GO\n", "text/csv", "importCompanyFile", nil, http.StatusOK},
+			{"GET", "/Company_Detail/1", "", "", "returnSingleCompany", companyVars, http.StatusOK},
+			{"GET", "/Company_Detail/1?format=csv", "", "", "returnSingleCompany", companyVars, http.StatusOK},
+			{"PUT", "/Company_Detail/1", company(1), "application/json", "updateCompany", companyVars, http.StatusOK},
+			{"PATCH", "/Company_Detail/1", `{"ASIC": "99"}`, mergePatchType, "patchCompany", companyVars, http.StatusOK},
+			{"PUT", "/clients/2399029309/companies/3", company(3), "application/json", "upsertCompany", map[string]string{"Client_ID": "2399029309", "Company_ID": "3"}, http.StatusCreated},
+			{"DELETE", "/Company_Detail/1", "", "", "deleteCompany", companyVars, http.StatusOK},
+			{"GET", "/Company_Detail/1", "", "", "returnSingleCompany", companyVars, http.StatusNotFound},
+			{"GET", "/v1/companies?limit=1&sort=-company_name&flight_risk_status=High,Low", "", "", "v1.returnAllCompany_Detail", nil, http.StatusOK},
+			{"POST", "/v1/companies", v1Company(4), "application/json", "v1.createNewCompany", nil, http.StatusOK},
+			{"POST", "/v1/companies:batch", `{"operations": [{"op": "delete", "company_id": 4}]}`, "application/json", "v1.batchCompanies", nil, http.StatusOK},
+			{"POST", "/v1/companies:import?dry_run=true", "client_id,company_id,company_name\n2399029309,6,\n", "text/csv", "v1.importCompanyFile", nil, http.StatusUnprocessableEntity},
+			{"PUT", "/v1/clients/2399029309/companies/5", v1Company(5), "application/json", "v1.upsertCompany", map[string]string{"client_id": "2399029309", "company_id": "5"}, http.StatusCreated},
+			{"GET", "/v1/companies/5?fields=company_name,asic", "", "", "v1.returnSingleCompany", v1Vars, http.StatusOK},
+			{"GET", "/v1/companies?format=ndjson&fields=company_id", "", "", "v1.returnAllCompany_Detail", nil, http.StatusOK},
+			{"PUT", "/v1/companies/5", v1Company(5), "application/json", "v1.updateCompany", v1Vars, http.StatusOK},
+			{"PATCH", "/v1/companies/5", `[{"op": "replace", "path": "/asic", "value": "99"}]`, jsonPatchType, "v1.patchCompany", v1Vars, http.StatusOK},
+			{"DELETE", "/v1/companies/5", "", "", "v1.deleteCompany", v1Vars, http.StatusOK},
+			{"GET", "/v1/companies/5", "", "", "v1.returnSingleCompany", v1Vars, http.StatusNotFound},
+			{"GET", "/openapi.json", "", "", "openAPI", nil, http.StatusOK},
+			{"GET", "/docs", "", "", "docs", nil, http.StatusMovedPermanently},
+			{"GET", "/docs/", "", "", "docs", nil, http.StatusOK},
+			{"GET", "/docs/swagger-initializer.js", "", "", "docs", nil, http.StatusOK},
+			{"GET", "/docs/swagger-ui.css", "", "", "docs", nil, http.StatusOK},
+			{"GET", "/docs/missing.js", "", "", "docs", nil, http.StatusNotFound},
+
+			// routes advertised before the route table
+			{"GET", "/Company/3", "", "", "", nil, http.StatusNotFound},
+			{"GET", "/articles", "", "", "", nil, http.StatusNotFound},
+			{"POST", "/article", "{}", "application/json", "", nil, http.StatusNotFound},
+			{"DELETE", "/Company_Detail", "", "", "", nil, http.StatusMethodNotAllowed},
+		} {
+			name := dbType + " " + tc.method + " " + tc.path
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+
+			var match mux.RouteMatch
+			var template string
+			if app.Router.Match(req, &match) && match.MatchErr == nil {
+				if got := match.Route.GetName(); got != tc.route {
+					t.Errorf("%s: reached route %q want %q", name, got, tc.route)
+				}
+				if len(match.Vars) > 0 || len(tc.vars) > 0 {
+					if !reflect.DeepEqual(match.Vars, tc.vars) {
+						t.Errorf("%s: got path vars %v want %v", name, match.Vars, tc.vars)
+					}
+				}
+				reached[match.Route.GetName()] = true
+				template, _ = match.Route.GetPathTemplate()
+			} else if tc.route != "" {
+				t.Errorf("%s: no route matched, want %s", name, tc.route)
+			}
+
+			rr := httptest.NewRecorder()
+			app.Router.ServeHTTP(rr, req)
+			if rr.Code != tc.status {
+				t.Errorf("%s: got status %d want %d : %s", name, rr.Code, tc.status, rr.Body)
+			}
+
+			// documented routes follow the OpenAPI document
+			if spec.object("paths", template) != nil {
+				req := httptest.NewRequest(tc.method, tc.path, nil)
+				req.Header.Set("Content-Type", tc.contentType)
+				for _, err := range spec.checkExchange(template, req, tc.body, rr) {
+					t.Errorf("%s: %s", name, err)
+				}
+			}
+		}
+
+		for _, rt := range routes() {
+			if !reached[rt.name] {
+				t.Errorf("%s: route %s %s is not covered by the conformance cases", dbType, rt.method, rt.path)
+			}
+		}
+	}
+}
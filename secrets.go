@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+)
+
+type (
+
+	// dbCredentials is the credentials JSON file layout, as written by secret
+	// managers for RDS, empty fields keep the configured values
+	dbCredentials struct {
+		Username string      `json:"username"`
+		Password string      `json:"password"`
+		Host     string      `json:"host"`
+		Port     json.Number `json:"port"`
+		DBName   string      `json:"dbname"`
+	}
+
+	// dsnConnector opens driver connections with the current connection string,
+	// so rotated credentials apply to new connections without reopening the DB
+	dsnConnector struct {
+		driver driver.Driver
+		dsn    atomic.Value
+	}
+)
+
+// loadSecrets resolves the DB credentials from the credentials JSON file and the
+// password file, the password file takes precedence for the password
+func loadSecrets(cfg *Config) error {
+
+	if cfg.DBCredentialsFile != "" {
+
+		data, err := os.ReadFile(cfg.DBCredentialsFile)
+		if err != nil {
+			return err
+		}
+
+		var creds dbCredentials
+		if err = json.Unmarshal(data, &creds); err != nil {
+			return fmt.Errorf("credentials file %s: %w", cfg.DBCredentialsFile, err)
+		}
+
+		for _, field := range []struct {
+			value  string
+			target *string
+		}{
+			{creds.Username, &cfg.DBUser},
+			{creds.Password, &cfg.DBPassword},
+			{creds.Host, &cfg.DBHost},
+			{creds.Port.String(), &cfg.DBPort},
+			{creds.DBName, &cfg.DBName},
+		} {
+			if field.value != "" {
+				*field.target = field.value
+			}
+		}
+	}
+
+	if cfg.DBPasswordFile != "" {
+
+		data, err := os.ReadFile(cfg.DBPasswordFile)
+		if err != nil {
+			return err
+		}
+		cfg.DBPassword = strings.TrimRight(string(data), "\r\n")
+	}
+	return nil
+}
+
+// newDSNConnector returns a connector for the registered driver of the DB type
+func newDSNConnector(dbType, connectionString string) (*dsnConnector, error) {
+
+	// sql.Open only looks the driver up, it does not connect
+	db, err := sql.Open(dbType, "")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	c := &dsnConnector{driver: db.Driver()}
+	c.dsn.Store(connectionString)
+	return c, nil
+}
+
+// Connect opens a driver connection with the current connection string
+func (c *dsnConnector) Connect(ctx context.Context) (driver.Conn, error) {
+
+	dsn := c.dsn.Load().(string)
+	if driverCtx, ok := c.driver.(driver.DriverContext); ok {
+		connector, err := driverCtx.OpenConnector(dsn)
+		if err != nil {
+			return nil, err
+		}
+		return connector.Connect(ctx)
+	}
+	return c.driver.Open(dsn)
+}
+
+// Driver returns the underlying driver
+func (c *dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// setDSN swaps the connection string used for new connections
+func (c *dsnConnector) setDSN(connectionString string) {
+	c.dsn.Store(connectionString)
+}
+
+// reloadSecrets re-reads the DB credentials into the connector and drops the idle
+// connections, so the next queries authenticate with the new credentials
+func reloadSecrets(cfg Config, connector *dsnConnector, db *sql.DB, logger *log.Logger) error {
+
+	if err := loadSecrets(&cfg); err != nil {
+		return err
+	}
+	connector.setDSN(cfg.connectionString())
+
+	// idle connections were opened with the old credentials, drop them and
+	// restore the configured limit
+	db.SetMaxIdleConns(0)
+	db.SetMaxIdleConns(cfg.DBMaxIdleConns)
+
+	logger.Println("Reloaded " + cfg.DBType + " DB credentials")
+	return nil
+}
+
+// reloadSecretsOnSIGHUP reloads the DB credentials every time the process gets a SIGHUP
+func reloadSecretsOnSIGHUP(cfg Config, connector *dsnConnector, db *sql.DB, logger *log.Logger) {
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	go func() {
+		for range hangup {
+			if err := reloadSecrets(cfg, connector, db, logger); err != nil {
+				logger.Println("failed to reload DB credentials : " + err.Error())
+			}
+		}
+	}()
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadSecrets(t *testing.T) {
+
+	dir := t.TempDir()
+	credentialsFile := filepath.Join(dir, "credentials.json")
+	passwordFile := filepath.Join(dir, "password")
+
+	err := os.WriteFile(credentialsFile, []byte(`{"username": "svc", "password": "from-json", "host": "db.internal", "port": 3307}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(passwordFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// credentials file only
+	cfg := defaultConfig()
+	cfg.DBName = "Happy1"
+	cfg.DBCredentialsFile = credentialsFile
+	if err = loadSecrets(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DBUser != "svc" || cfg.DBPassword != "from-json" || cfg.DBHost != "db.internal" || cfg.DBPort != "3307" || cfg.DBName != "Happy1" {
+		t.Errorf("credentials file not applied: %+v", cfg)
+	}
+
+	// the password file wins over the credentials file
+	cfg.DBPasswordFile = passwordFile
+	if err = loadSecrets(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DBPassword != "from-file" {
+		t.Errorf("password file not applied: got %q", cfg.DBPassword)
+	}
+
+	// missing files are reported
+	cfg.DBPasswordFile = filepath.Join(dir, "missing")
+	if err = loadSecrets(&cfg); err == nil {
+		t.Errorf("missing password file accepted")
+	}
+}
+
+func TestReloadSecrets(t *testing.T) {
+
+	dir := t.TempDir()
+
+	var logs bytes.Buffer
+	logger := log.New(&logs, "", 0)
+
+	// sqlite has no credentials, swapping the DB file stands in for rotated credentials
+	cfg := defaultConfig()
+	cfg.DBType = "sqlite"
+	cfg.SQLitePath = filepath.Join(dir, "old.db")
+	cfg.DBMaxIdleConns = 3
+
+	connector, err := newDSNConnector(cfg.DBType, cfg.connectionString())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := openDB(cfg.DBType, connector, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err = db.Exec("CREATE TABLE old_db (id INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.SQLitePath = filepath.Join(dir, "new.db")
+	if err = reloadSecrets(cfg, connector, db, logger); err != nil {
+		t.Fatal(err)
+	}
+
+	// new connections use the reloaded connection string
+	if _, err = db.Exec("SELECT 1 FROM old_db"); err == nil {
+		t.Errorf("connection still uses the old connection string")
+	}
+
+	// the configured idle limit survives the reload
+	var conns []*sql.Conn
+	for i := 0; i < cfg.DBMaxIdleConns+1; i++ {
+		conn, err := db.Conn(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns = append(conns, conn)
+	}
+	for _, conn := range conns {
+		conn.Close()
+	}
+	if idle := db.Stats().Idle; idle != cfg.DBMaxIdleConns {
+		t.Errorf("got %d idle connections want %d", idle, cfg.DBMaxIdleConns)
+	}
+
+	// the connection string never shows in the logs
+	if strings.Contains(logs.String(), dir) {
+		t.Errorf("connection string logged: %s", logs.String())
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SortKey orders the company list by a column, NULL sorts before any value
+type SortKey struct {
+	Column string
+	Desc   bool
+}
+
+// sortableColumns are the columns accepted by the sort query param
+var sortableColumns = []string{
+	"Client_ID",
+	"Company_ID",
+	"Company_Name",
+	"Flight_Risk_Status",
+	"Recruit_Status",
+	"Total_Flight_Risk",
+	"Total_Backfill",
+	"Create_Date",
+	"Last_Update",
+	"Data_As_Of_Date",
+}
+
+// parseSort parses a comma separated list of columns, a leading '-' sorts
+// descending. Company_ID is appended as tie breaker so the order is total
+func parseSort(value string) ([]SortKey, error) {
+
+	var (
+		keys    []SortKey
+		columns []string
+	)
+	if value != "" {
+		columns = strings.Split(value, ",")
+	}
+
+	seen := make(map[string]bool)
+	for _, column := range columns {
+
+		key := SortKey{Column: strings.TrimPrefix(column, "-"), Desc: strings.HasPrefix(column, "-")}
+		if !contains(sortableColumns, key.Column) {
+			return nil, fmt.Errorf("invalid sort query param : %s, must be one of %s", column, strings.Join(sortableColumns, ", "))
+		}
+		if seen[key.Column] {
+			return nil, fmt.Errorf("invalid sort query param : %s is repeated", key.Column)
+		}
+		seen[key.Column] = true
+		keys = append(keys, key)
+	}
+
+	if !seen[companyKeyColumn] {
+		keys = append(keys, SortKey{Column: companyKeyColumn})
+	}
+	return keys, nil
+}
+
+// sortString formats sort keys as accepted by parseSort
+func sortString(keys []SortKey) string {
+
+	columns := make([]string, len(keys))
+	for i, key := range keys {
+		columns[i] = key.Column
+		if key.Desc {
+			columns[i] = "-" + key.Column
+		}
+	}
+	return strings.Join(columns, ",")
+}
+
+// reverseSort returns the sort keys of the reverse order
+func reverseSort(keys []SortKey) []SortKey {
+
+	reversed := make([]SortKey, len(keys))
+	for i, key := range keys {
+		reversed[i] = SortKey{Column: key.Column, Desc: !key.Desc}
+	}
+	return reversed
+}
+
+// fieldByColumn returns the mapped Company field of a column
+func fieldByColumn(column string) companyField {
+
+	for _, field := range companyFields {
+		if field.column == column {
+			return field
+		}
+	}
+	panic("unmapped company column " + column)
+}
+
+// sortValue returns the value of a sort column, nil for NULL
+func sortValue(key SortKey, company *Company) interface{} {
+
+	switch value := fieldByColumn(key.Column).addr(company).(type) {
+	case *int:
+		return *value
+	case *string:
+		if company.nullText&nullTextBit(key.Column) == 0 {
+			return *value
+		}
+	case *NullInt:
+		if value.Valid {
+			return value.Int64
+		}
+	case *NullTime:
+		if value.Valid {
+			return value.Time.UTC()
+		}
+	case *NullDate:
+		if value.Valid {
+			return value.Time
+		}
+	}
+	return nil
+}
+
+// compareSortValues compares two sort column values, NULL first
+func compareSortValues(a, b interface{}) int {
+
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	switch a := a.(type) {
+	case int:
+		return compareOrdered(a, b.(int))
+	case int64:
+		return compareOrdered(a, b.(int64))
+	case string:
+		return compareOrdered(a, b.(string))
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	}
+	panic(fmt.Sprintf("unsortable value %T", a))
+}
+
+// compareOrdered compares two ordered values
+func compareOrdered[T int | int64 | string](a, b T) int {
+
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareCompanies compares two companies by the sort keys
+func compareCompanies(keys []SortKey, a, b *Company) int {
+
+	for _, key := range keys {
+		cmp := compareSortValues(sortValue(key, a), sortValue(key, b))
+		if key.Desc {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+// orderBy returns the SQL ORDER BY terms of the sort keys, NULL is ordered
+// explicitly as the dialects disagree on its default position
+func orderBy(keys []SortKey) string {
+
+	terms := make([]string, 0, 2*len(keys))
+	for _, key := range keys {
+		if key.Desc {
+			terms = append(terms, "("+key.Column+" IS NULL) ASC", key.Column+" DESC")
+		} else {
+			terms = append(terms, "("+key.Column+" IS NULL) DESC", key.Column+" ASC")
+		}
+	}
+	return strings.Join(terms, ", ")
+}
+
+// keysetWhere returns the SQL condition selecting the rows sorted after the
+// cursor company, and its arguments numbered from next in text order
+func keysetWhere(dbType string, keys []SortKey, after *Company, next int) (string, []interface{}) {
+
+	var (
+		alternatives []string
+		args         []interface{}
+	)
+
+	// arg returns the placeholder of a new argument
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		next++
+		return placeholder(dbType, next-1)
+	}
+
+	// a row is after the cursor when its first i-1 sort values are equal to the
+	// cursor ones and the i-th is after it
+	for i, key := range keys {
+
+		value := sortValue(key, after)
+		if value == nil && key.Desc {
+			continue // NULL is last in descending order
+		}
+
+		var terms []string
+		for _, prev := range keys[:i] {
+			if prevValue := sortValue(prev, after); prevValue == nil {
+				terms = append(terms, prev.Column+" IS NULL")
+			} else {
+				terms = append(terms, prev.Column+" = "+arg(prevValue))
+			}
+		}
+
+		switch {
+		case value == nil:
+			terms = append(terms, key.Column+" IS NOT NULL")
+		case key.Desc:
+			terms = append(terms, "("+key.Column+" < "+arg(value)+" OR "+key.Column+" IS NULL)")
+		default:
+			terms = append(terms, key.Column+" > "+arg(value))
+		}
+		alternatives = append(alternatives, "("+strings.Join(terms, " AND ")+")")
+	}
+
+	if len(alternatives) == 0 {
+		return "1 = 0", nil
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")", args
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSort(t *testing.T) {
+
+	for _, value := range []string{"ASIC", "-Company_Name,Company_Name", "Company_Name,", "+Client_ID"} {
+		if _, err := parseSort(value); err == nil {
+			t.Errorf("%q: invalid sort accepted", value)
+		}
+	}
+
+	keys, err := parseSort("-Total_Flight_Risk,Company_Name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SortKey{{"Total_Flight_Risk", true}, {"Company_Name", false}, {"Company_ID", false}}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("got %+v want %+v", keys, want)
+	}
+}
+
+func TestReturnAllCompany_DetailSort(t *testing.T) {
+
+	for _, dbType := range testDBTypes() {
+
+		app := initTestModule(t, dbType)
+
+		// seed duplicate and NULL sort values
+		seed := make([]Company, 6)
+		for i := range seed {
+			seed[i] = testCompany(i + 1)
+		}
+		seed[0].Total_Flight_Risk = newNullInt(5)
+		seed[1].Total_Flight_Risk = NullInt{}
+		seed[2].Total_Flight_Risk = newNullInt(9)
+		seed[3].Total_Flight_Risk = newNullInt(5)
+		seed[4].Total_Flight_Risk = NullInt{}
+		seed[5].Total_Flight_Risk = newNullInt(1)
+		seed[0].Company_Name = "b"
+		seed[3].Company_Name = "a"
+		seed[1].Data_As_Of_Date = newNullDate(time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC))
+		if err := app.Store.CreateBatch(context.Background(), seed); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, test := range []struct {
+			sort string
+			want []int
+		}{
+			{"", []int{1, 2, 3, 4, 5, 6}},
+			{"-Company_ID", []int{6, 5, 4, 3, 2, 1}},
+			{"Total_Flight_Risk", []int{2, 5, 6, 1, 4, 3}},
+			{"-Total_Flight_Risk,Company_Name", []int{3, 4, 1, 6, 2, 5}},
+			{"-Data_As_Of_Date,-Total_Flight_Risk", []int{2, 3, 1, 4, 6, 5}},
+		} {
+
+			// walk every page of two
+			var got []int
+			query := url.Values{"sort": {test.sort}, "limit": {"2"}}
+			for page := 0; page < 5; page++ {
+
+				req := httptest.NewRequest("GET", "/Company_Detail?"+query.Encode(), nil)
+				rr := httptest.NewRecorder()
+				http.HandlerFunc(app.returnAllCompany_Detail).ServeHTTP(rr, req)
+				if rr.Code != http.StatusOK {
+					t.Fatalf("%s sort %q: got status %d want %d", dbType, test.sort, rr.Code, http.StatusOK)
+				}
+
+				var page companyPage
+				json.NewDecoder(rr.Body).Decode(&page)
+				for _, company := range page.Items {
+					got = append(got, company.Company_ID)
+				}
+
+				if !page.HasMore {
+					break
+				}
+				query.Set("cursor", page.NextCursor)
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("%s sort %q: got %v want %v", dbType, test.sort, got, test.want)
+			}
+		}
+
+		// id pagination only applies to the default sort
+		req := httptest.NewRequest("GET", "/Company_Detail?sort=Company_Name&id=2", nil)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(app.returnAllCompany_Detail).ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: id with sort got status %d want %d", dbType, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrCompanyNotFound is returned by a CompanyStore when no Company matches the given ID
+	ErrCompanyNotFound = errors.New("company not found")
+
+	// ErrCompanyExists is returned by a CompanyStore when a Company_ID is already taken
+	ErrCompanyExists = errors.New("company already exists")
+
+	// ErrCompanyOfOtherClient is returned by CompanyStore.Upsert and batch
+	// upserts when the Company_ID is taken by another client
+	ErrCompanyOfOtherClient = errors.New("company belongs to another client")
+
+	// errBatchFailed is returned by an atomic CompanyStore.Batch rolled back on a
+	// failing operation
+	errBatchFailed = errors.New("batch rolled back")
+)
+
+// batch actions
+const (
+	batchCreate BatchAction = "create"
+	batchUpsert BatchAction = "upsert"
+	batchDelete BatchAction = "delete"
+)
+
+type (
+
+	// CompanyStore persists Company records, the handlers only depend on this
+	// interface so backends can be swapped without touching the REST layer
+	CompanyStore interface {
+		Create(ctx context.Context, company *Company) error
+		Get(ctx context.Context, companyID int, columns ...string) (Company, error)
+		List(ctx context.Context, opts ListOptions) ([]Company, error)
+
+		// Each calls fn with the companies of List one at a time, as they are
+		// read, so large lists are not held in memory. The memory and SQLite
+		// stores read the whole list first. An error of fn stops the list and is
+		// returned
+		Each(ctx context.Context, opts ListOptions, fn func(company Company) error) error
+
+		Count(ctx context.Context, filter CompanyFilter) (int, error)
+		Update(ctx context.Context, companyID int, company *Company, checks ...Precondition) error
+		UpdateColumns(ctx context.Context, companyID int, company *Company, columns []string, checks ...Precondition) error
+		Delete(ctx context.Context, companyID int, checks ...Precondition) error
+
+		// Upsert inserts the Company, or replaces the stored one of the same
+		// client, reporting whether it was inserted
+		Upsert(ctx context.Context, company *Company) (created bool, err error)
+
+		CreateBatch(ctx context.Context, companies []Company) error
+		UpdateBatch(ctx context.Context, companies []Company) error
+		DeleteBatch(ctx context.Context, companyIDs []int) error
+
+		// Batch runs the operations in order, returning the error of each. When
+		// atomic, any failure rolls every operation back and err reports it
+		Batch(ctx context.Context, ops []BatchOp, atomic bool) (errs []error, err error)
+	}
+
+	// BatchOp is a single operation of CompanyStore.Batch, deletes only read the
+	// Company_ID and upserts are scoped to the client like CompanyStore.Upsert
+	BatchOp struct {
+		Action  BatchAction
+		Company Company
+	}
+
+	// BatchAction is the kind of a BatchOp
+	BatchAction string
+
+	// Precondition checks the stored Company right before it is written, an
+	// error aborts the write and is returned as is
+	Precondition func(current Company) error
+
+	// ListOptions controls the filtering and keyset pagination of CompanyStore.List
+	ListOptions struct {
+		Sort   []SortKey     // order of the companies, Company_ID when empty
+		After  *Company      // only return companies sorted after the sort values of After
+		Limit  int           // max entries returned, 0 returns all
+		Filter CompanyFilter // only return the matching companies
+
+		// Columns restricts the columns read, every column when empty. Stores
+		// may return more columns than asked for
+		Columns []string
+	}
+)
+
+// sortKeys returns the sort keys of the list, Company_ID by default
+func (opts ListOptions) sortKeys() []SortKey {
+
+	if len(opts.Sort) == 0 {
+		return []SortKey{{Column: companyKeyColumn}}
+	}
+	return opts.Sort
+}
+
+// newCompanyStore returns the CompanyStore implementation for the given DB type
+func newCompanyStore(dbType string, db *sql.DB) (CompanyStore, error) {
+
+	switch dbType {
+	case "mysql":
+		return newMySQLStore(db), nil
+	case "postgres":
+		return newPostgresStore(db), nil
+	case "sqlite":
+		return newSQLiteStore(db), nil
+	case "memory":
+		return newMemoryStore(), nil
+	}
+	return nil, fmt.Errorf("unsupported DB type %q", dbType)
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// memoryStore is an in-memory CompanyStore with the same semantics as the SQL
+// backends, used for local development and tests
+type memoryStore struct {
+	mu        sync.RWMutex
+	companies map[int]Company
+}
+
+// newMemoryStore returns an empty in-memory CompanyStore
+func newMemoryStore() *memoryStore {
+	return &memoryStore{companies: make(map[int]Company)}
+}
+
+// Create inserts a new Company, failing with ErrCompanyExists on a duplicate Company_ID
+func (s *memoryStore) Create(ctx context.Context, company *Company) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return create(s.companies, company)
+}
+
+// Get returns the Company with the given ID, always with every column
+func (s *memoryStore) Get(ctx context.Context, companyID int, columns ...string) (Company, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	company, ok := s.companies[companyID]
+	if !ok {
+		return Company{}, ErrCompanyNotFound
+	}
+	return company, nil
+}
+
+// List returns the matching companies after opts.After in the sort order
+func (s *memoryStore) List(ctx context.Context, opts ListOptions) ([]Company, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := opts.sortKeys()
+
+	// collect the matching companies sorted after the cursor
+	var companies []Company
+	for _, company := range s.companies {
+		if opts.Filter.matches(company) && (opts.After == nil || compareCompanies(keys, &company, opts.After) > 0) {
+			companies = append(companies, company)
+		}
+	}
+	sort.Slice(companies, func(i, j int) bool {
+		return compareCompanies(keys, &companies[i], &companies[j]) < 0
+	})
+
+	// if limit is set, cap the number of entries
+	if opts.Limit > 0 && len(companies) > opts.Limit {
+		companies = companies[:opts.Limit]
+	}
+	return companies, nil
+}
+
+// Each calls fn with the companies of List, the store is not locked while fn runs
+func (s *memoryStore) Each(ctx context.Context, opts ListOptions, fn func(company Company) error) error {
+
+	companies, err := s.List(ctx, opts)
+	if err != nil {
+		return err
+	}
+	for _, company := range companies {
+		if err = fn(company); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Count returns the number of companies matching the filter
+func (s *memoryStore) Count(ctx context.Context, filter CompanyFilter) (int, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	count := 0
+	for _, company := range s.companies {
+		if filter.matches(company) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Update replaces every field of the Company with the given ID
+func (s *memoryStore) Update(ctx context.Context, companyID int, company *Company, checks ...Precondition) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := check(s.companies, companyID, checks); err != nil {
+		return err
+	}
+	return update(s.companies, companyID, company)
+}
+
+// Upsert inserts the Company, or replaces the stored one of the same client
+func (s *memoryStore) Upsert(ctx context.Context, company *Company) (bool, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return upsert(s.companies, company)
+}
+
+// Delete removes the Company with the given ID
+func (s *memoryStore) Delete(ctx context.Context, companyID int, checks ...Precondition) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := check(s.companies, companyID, checks); err != nil {
+		return err
+	}
+	return remove(s.companies, companyID)
+}
+
+// CreateBatch inserts all companies, leaving the store untouched if any insert fails
+func (s *memoryStore) CreateBatch(ctx context.Context, companies []Company) error {
+
+	return s.inTx(func(tx map[int]Company) error {
+
+		for i := range companies {
+			if err := create(tx, &companies[i]); err != nil {
+				return fmt.Errorf("company %d: %w", companies[i].Company_ID, err)
+			}
+		}
+		return nil
+	})
+}
+
+// UpdateColumns replaces only the given columns of the Company with the given ID
+func (s *memoryStore) UpdateColumns(ctx context.Context, companyID int, company *Company, columns []string, checks ...Precondition) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := check(s.companies, companyID, checks); err != nil {
+		return err
+	}
+
+	stored, ok := s.companies[companyID]
+	if !ok {
+		return ErrCompanyNotFound
+	}
+	copyFields(&stored, company, selectFields(columns))
+	return update(s.companies, companyID, &stored)
+}
+
+// UpdateBatch updates all companies keyed by their Company_ID, leaving the store
+// untouched if any update fails
+func (s *memoryStore) UpdateBatch(ctx context.Context, companies []Company) error {
+
+	return s.inTx(func(tx map[int]Company) error {
+
+		for i := range companies {
+			if err := update(tx, companies[i].Company_ID, &companies[i]); err != nil {
+				return fmt.Errorf("company %d: %w", companies[i].Company_ID, err)
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteBatch removes all given companies, leaving the store untouched if any delete fails
+func (s *memoryStore) DeleteBatch(ctx context.Context, companyIDs []int) error {
+
+	return s.inTx(func(tx map[int]Company) error {
+
+		for _, companyID := range companyIDs {
+			if err := remove(tx, companyID); err != nil {
+				return fmt.Errorf("company %d: %w", companyID, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Batch runs the operations in order, atomic batches leave the store untouched
+// if any operation fails
+func (s *memoryStore) Batch(ctx context.Context, ops []BatchOp, atomic bool) ([]error, error) {
+
+	errs := make([]error, len(ops))
+	apply := func(companies map[int]Company) (failed bool) {
+		for i := range ops {
+			errs[i] = applyBatchOp(companies, &ops[i])
+			failed = failed || errs[i] != nil
+		}
+		return
+	}
+
+	if !atomic {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		apply(s.companies)
+		return errs, nil
+	}
+
+	return errs, s.inTx(func(tx map[int]Company) error {
+		if apply(tx) {
+			return errBatchFailed
+		}
+		return nil
+	})
+}
+
+// inTx applies fn to a copy of the stored companies and keeps the copy only if fn succeeds
+func (s *memoryStore) inTx(fn func(tx map[int]Company) error) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := make(map[int]Company, len(s.companies))
+	for companyID, company := range s.companies {
+		tx[companyID] = company
+	}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	s.companies = tx
+	return nil
+}
+
+// create adds company to companies unless its Company_ID is taken
+func create(companies map[int]Company, company *Company) error {
+
+	if _, ok := companies[company.Company_ID]; ok {
+		return ErrCompanyExists
+	}
+	companies[company.Company_ID] = *company
+	return nil
+}
+
+// update replaces the Company stored under companyID, moving it if its Company_ID changed
+func update(companies map[int]Company, companyID int, company *Company) error {
+
+	if _, ok := companies[companyID]; !ok {
+		return ErrCompanyNotFound
+	}
+	if _, ok := companies[company.Company_ID]; ok && company.Company_ID != companyID {
+		return ErrCompanyExists
+	}
+
+	delete(companies, companyID)
+	companies[company.Company_ID] = *company
+	return nil
+}
+
+// upsert adds company to companies, or replaces the stored Company of the same
+// client, reporting whether it was added
+func upsert(companies map[int]Company, company *Company) (bool, error) {
+
+	stored, ok := companies[company.Company_ID]
+	if ok && stored.Client_ID != company.Client_ID {
+		return false, ErrCompanyOfOtherClient
+	}
+	companies[company.Company_ID] = *company
+	return !ok, nil
+}
+
+// applyBatchOp runs a single batch operation on companies
+func applyBatchOp(companies map[int]Company, op *BatchOp) error {
+
+	switch op.Action {
+	case batchCreate:
+		return create(companies, &op.Company)
+	case batchUpsert:
+		_, err := upsert(companies, &op.Company)
+		return err
+	case batchDelete:
+		return remove(companies, op.Company.Company_ID)
+	}
+	return fmt.Errorf("unknown batch action %q", op.Action)
+}
+
+// remove deletes the Company stored under companyID
+func remove(companies map[int]Company, companyID int) error {
+
+	if _, ok := companies[companyID]; !ok {
+		return ErrCompanyNotFound
+	}
+	delete(companies, companyID)
+	return nil
+}
+
+// check runs the preconditions on the stored Company with the given ID
+func check(companies map[int]Company, companyID int, checks []Precondition) error {
+
+	if len(checks) == 0 {
+		return nil
+	}
+
+	current, ok := companies[companyID]
+	if !ok {
+		return ErrCompanyNotFound
+	}
+	for _, precondition := range checks {
+		if err := precondition(current); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestMemoryStoreList(t *testing.T) {
+
+	ctx := context.Background()
+	store := newMemoryStore()
+
+	for _, companyID := range []int{5, 2, 9, 7} {
+		company := testCompany(companyID)
+		if err := store.Create(ctx, &company); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		opts ListOptions
+		want []int
+	}{
+		{ListOptions{}, []int{2, 5, 7, 9}},
+		{ListOptions{Limit: 2}, []int{2, 5}},
+		{ListOptions{After: &Company{Company_ID: 5}, Limit: 2}, []int{7, 9}},
+		{ListOptions{After: &Company{Company_ID: 9}}, nil},
+	} {
+		companies, err := store.List(ctx, tc.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []int
+		for _, company := range companies {
+			got = append(got, company.Company_ID)
+		}
+		if len(got) != len(tc.want) {
+			t.Errorf("list %+v: got %v want %v", tc.opts, got, tc.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("list %+v: got %v want %v", tc.opts, got, tc.want)
+				break
+			}
+		}
+	}
+}
+
+func TestMemoryStoreErrors(t *testing.T) {
+
+	ctx := context.Background()
+	store := newMemoryStore()
+
+	company := testCompany(1)
+	if err := store.Create(ctx, &company); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Create(ctx, &company); err != ErrCompanyExists {
+		t.Errorf("duplicate create: got %v want %v", err, ErrCompanyExists)
+	}
+	if _, err := store.Get(ctx, 2); err != ErrCompanyNotFound {
+		t.Errorf("get unknown: got %v want %v", err, ErrCompanyNotFound)
+	}
+	if err := store.Update(ctx, 2, &company); err != ErrCompanyNotFound {
+		t.Errorf("update unknown: got %v want %v", err, ErrCompanyNotFound)
+	}
+	if err := store.Delete(ctx, 2); err != ErrCompanyNotFound {
+		t.Errorf("delete unknown: got %v want %v", err, ErrCompanyNotFound)
+	}
+}
+
+func TestMemoryStoreBatchRollback(t *testing.T) {
+
+	ctx := context.Background()
+	store := newMemoryStore()
+
+	// the second company clashes with the first, nothing must be stored
+	err := store.CreateBatch(ctx, []Company{testCompany(1), testCompany(1)})
+	if !errors.Is(err, ErrCompanyExists) {
+		t.Fatalf("batch create: got %v want %v", err, ErrCompanyExists)
+	}
+	if companies, _ := store.List(ctx, ListOptions{}); len(companies) != 0 {
+		t.Errorf("failed batch left %d companies behind", len(companies))
+	}
+
+	if err = store.CreateBatch(ctx, []Company{testCompany(1), testCompany(2)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// deleting an unknown company rolls back the whole batch
+	err = store.DeleteBatch(ctx, []int{1, 3})
+	if !errors.Is(err, ErrCompanyNotFound) {
+		t.Fatalf("batch delete: got %v want %v", err, ErrCompanyNotFound)
+	}
+	if _, err = store.Get(ctx, 1); err != nil {
+		t.Errorf("failed batch delete removed company 1: %v", err)
+	}
+}
@@ -0,0 +1,585 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+type (
+
+	// sqlStore is the database/sql backed CompanyStore, dbType selects the
+	// SQL dialect used for placeholders
+	sqlStore struct {
+		db     *sql.DB
+		dbType string
+	}
+
+	// sqlExecutor is satisfied by both *sql.DB and *sql.Tx
+	sqlExecutor interface {
+		ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+		QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	}
+)
+
+// newMySQLStore returns a CompanyStore for a MySQL connection
+func newMySQLStore(db *sql.DB) *sqlStore {
+	return &sqlStore{db: db, dbType: "mysql"}
+}
+
+// newPostgresStore returns a CompanyStore for a Postgres connection
+func newPostgresStore(db *sql.DB) *sqlStore {
+	return &sqlStore{db: db, dbType: "postgres"}
+}
+
+// newSQLiteStore returns a CompanyStore for a SQLite connection
+func newSQLiteStore(db *sql.DB) *sqlStore {
+
+	// SQLite serializes writers and every connection to :memory: opens its own
+	// DB, so share a single connection
+	db.SetMaxOpenConns(1)
+
+	return &sqlStore{db: db, dbType: "sqlite"}
+}
+
+// ph returns the n-th (1 based) placeholder of the store dialect
+func (s *sqlStore) ph(n int) string {
+	return placeholder(s.dbType, n)
+}
+
+// Create inserts a new Company
+func (s *sqlStore) Create(ctx context.Context, company *Company) error {
+
+	_, err := s.db.ExecContext(ctx, insertCompanyQuery(s.dbType), companyArgs(company)...)
+	return storeError(err)
+}
+
+// Get returns the Company with the given ID, reading only the given columns
+// when set
+func (s *sqlStore) Get(ctx context.Context, companyID int, columns ...string) (company Company, err error) {
+
+	fields := selectFields(columns)
+	query := "SELECT " + columnList(fields) + " FROM Company_Detail WHERE " + companyKeyColumn + "=" + s.ph(1)
+
+	err = s.db.QueryRowContext(ctx, query, companyID).Scan(scanDests(fields, &company)...)
+	if err == sql.ErrNoRows {
+		err = ErrCompanyNotFound
+	}
+	return
+}
+
+// List returns the matching companies after opts.After in the sort order
+func (s *sqlStore) List(ctx context.Context, opts ListOptions) ([]Company, error) {
+
+	// get all records until all are read
+	var companies []Company
+	err := s.scan(ctx, opts, func(company Company) error {
+		companies = append(companies, company)
+		return nil
+	})
+	return companies, err
+}
+
+// Each calls fn with the companies of List, scanned one row at a time. SQLite
+// has a single connection, so its rows are read first and a slow fn, like an
+// export to a slow client, does not hold up the other requests
+func (s *sqlStore) Each(ctx context.Context, opts ListOptions, fn func(company Company) error) error {
+
+	if s.dbType != "sqlite" {
+		return s.scan(ctx, opts, fn)
+	}
+
+	companies, err := s.List(ctx, opts)
+	if err != nil {
+		return err
+	}
+	for _, company := range companies {
+		if err = fn(company); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scan calls fn with the companies of List as their rows are scanned
+func (s *sqlStore) scan(ctx context.Context, opts ListOptions, fn func(company Company) error) error {
+
+	keys := opts.sortKeys()
+	fields := selectFields(opts.Columns)
+
+	// the filters combine with the keyset condition
+	conditions, queryParams := opts.Filter.where(s.dbType, 1)
+	if opts.After != nil {
+		keyset, keysetParams := keysetWhere(s.dbType, keys, opts.After, len(queryParams)+1)
+		conditions = append(conditions, keyset)
+		queryParams = append(queryParams, keysetParams...)
+	}
+
+	query := "SELECT " + columnList(fields) + " FROM Company_Detail"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY " + orderBy(keys)
+
+	// if limit is set, cap the number of entries
+	if opts.Limit > 0 {
+		query += " LIMIT " + s.ph(len(queryParams)+1)
+		queryParams = append(queryParams, opts.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, queryParams...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+
+		var company Company
+		if err = rows.Scan(scanDests(fields, &company)...); err != nil {
+			return err
+		}
+		if err = fn(company); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Count returns the number of companies matching the filter
+func (s *sqlStore) Count(ctx context.Context, filter CompanyFilter) (count int, err error) {
+
+	conditions, queryParams := filter.where(s.dbType, 1)
+
+	query := "SELECT COUNT(*) FROM Company_Detail"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	err = s.db.QueryRowContext(ctx, query, queryParams...).Scan(&count)
+	return
+}
+
+// Update replaces every field of the Company with the given ID
+func (s *sqlStore) Update(ctx context.Context, companyID int, company *Company, checks ...Precondition) error {
+	return s.checked(ctx, companyID, checks, func(db sqlExecutor) error {
+		return s.update(ctx, db, companyID, company)
+	})
+}
+
+// Upsert inserts the Company, or replaces the stored one of the same client, in
+// a single statement
+func (s *sqlStore) Upsert(ctx context.Context, company *Company) (created bool, err error) {
+
+	err = s.inTx(ctx, func(tx *sql.Tx) (err error) {
+		created, err = s.upsert(ctx, tx, company)
+		return
+	})
+	return
+}
+
+// upsert runs the client scoped upsert of the Company on tx, reporting
+// ErrCompanyOfOtherClient when its Company_ID is stored for another client
+func (s *sqlStore) upsert(ctx context.Context, tx *sql.Tx, company *Company) (created bool, err error) {
+
+	// Postgres tells inserted rows by their xmax, a row of another client is
+	// not returned
+	if s.dbType == "postgres" {
+		err = tx.QueryRowContext(ctx, upsertClientQuery(s.dbType)+" RETURNING (xmax = 0)", companyArgs(company)...).Scan(&created)
+		if err == sql.ErrNoRows {
+			return false, ErrCompanyOfOtherClient
+		}
+		return created, storeError(err)
+	}
+
+	// SQLite serializes its transactions, so the stored row can be read first
+	var storedClientID int
+	if s.dbType == "sqlite" {
+		err = tx.QueryRowContext(ctx, "SELECT Client_ID FROM Company_Detail WHERE "+companyKeyColumn+"="+s.ph(1), company.Company_ID).Scan(&storedClientID)
+		if err != nil && err != sql.ErrNoRows {
+			return false, err
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, upsertClientQuery(s.dbType), companyArgs(company)...)
+	if err != nil {
+		return false, storeError(err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	switch {
+	case s.dbType == "sqlite" && affected > 0:
+		return storedClientID == 0, nil
+
+	// MySQL reports 1 for an insert, 2 for an update
+	case s.dbType == "mysql" && affected > 0:
+		return affected == 1, nil
+
+	// and 0 for an unchanged row, the row is locked by now
+	case s.dbType == "mysql":
+		err = tx.QueryRowContext(ctx, "SELECT Client_ID FROM Company_Detail WHERE "+companyKeyColumn+"="+s.ph(1), company.Company_ID).Scan(&storedClientID)
+		if err != nil {
+			return false, err
+		}
+		if storedClientID == company.Client_ID {
+			return false, nil
+		}
+	}
+	return false, ErrCompanyOfOtherClient
+}
+
+// Delete removes the Company with the given ID
+func (s *sqlStore) Delete(ctx context.Context, companyID int, checks ...Precondition) error {
+	return s.checked(ctx, companyID, checks, func(db sqlExecutor) error {
+		return s.delete(ctx, db, companyID)
+	})
+}
+
+// CreateBatch inserts all companies in a single transaction
+func (s *sqlStore) CreateBatch(ctx context.Context, companies []Company) error {
+
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+
+		stmt, err := tx.PrepareContext(ctx, insertCompanyQuery(s.dbType))
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for i := range companies {
+			if _, err = stmt.ExecContext(ctx, companyArgs(&companies[i])...); err != nil {
+				return fmt.Errorf("company %d: %w", companies[i].Company_ID, storeError(err))
+			}
+		}
+		return nil
+	})
+}
+
+// UpdateBatch updates all companies, keyed by their Company_ID, in a single transaction
+func (s *sqlStore) UpdateBatch(ctx context.Context, companies []Company) error {
+
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+
+		for i := range companies {
+			if err := s.update(ctx, tx, companies[i].Company_ID, &companies[i]); err != nil {
+				return fmt.Errorf("company %d: %w", companies[i].Company_ID, err)
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteBatch removes all given companies in a single transaction
+func (s *sqlStore) DeleteBatch(ctx context.Context, companyIDs []int) error {
+
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+
+		for _, companyID := range companyIDs {
+			if err := s.delete(ctx, tx, companyID); err != nil {
+				return fmt.Errorf("company %d: %w", companyID, err)
+			}
+		}
+		return nil
+	})
+}
+
+// batchChunkSize caps the rows of a multi-row statement, keeping its bind
+// parameters under the limit of every driver
+const batchChunkSize = 500
+
+// Batch runs the operations in order. Atomic batches run in a transaction where
+// consecutive operations of the same action are sent as a single statement, and
+// stop at the first failing statement. Other batches run every operation on its
+// own through prepared statements
+func (s *sqlStore) Batch(ctx context.Context, ops []BatchOp, atomic bool) ([]error, error) {
+
+	errs := make([]error, len(ops))
+	for _, op := range ops {
+		if op.Action != batchCreate && op.Action != batchUpsert && op.Action != batchDelete {
+			return errs, fmt.Errorf("unknown batch action %q", op.Action)
+		}
+	}
+	if !atomic {
+		return errs, s.batchEach(ctx, ops, errs)
+	}
+
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+
+		for start := 0; start < len(ops); {
+
+			// group the following operations of the same action
+			end := start + 1
+			for end < len(ops) && end-start < batchChunkSize && ops[end].Action == ops[start].Action {
+				end++
+			}
+			if err := s.batchChunk(ctx, tx, ops[start:end], errs[start:end]); err != nil {
+				return err
+			}
+			start = end
+		}
+		return nil
+	})
+	return errs, err
+}
+
+// batchChunk runs operations of a single action as one statement, reporting the
+// error of each operation in errs and returning errBatchFailed on any failure
+func (s *sqlStore) batchChunk(ctx context.Context, tx *sql.Tx, ops []BatchOp, errs []error) error {
+
+	action := ops[0].Action
+	ids := make([]interface{}, len(ops))
+	for i := range ops {
+		ids[i] = ops[i].Company.Company_ID
+	}
+
+	// creates need free Company_IDs, upserts ones free or of the same client and
+	// deletes stored ones, check them first to report the failing operations
+	clients, err := s.storedClients(ctx, tx, ids)
+	if err != nil {
+		return err
+	}
+
+	failed := false
+	for i := range ops {
+		company := &ops[i].Company
+		switch clientID, stored := clients[company.Company_ID]; {
+		case action == batchCreate && stored:
+			errs[i] = ErrCompanyExists
+		case action == batchUpsert && stored && clientID != company.Client_ID:
+			errs[i] = ErrCompanyOfOtherClient
+		case action == batchDelete && !stored:
+			errs[i] = ErrCompanyNotFound
+		default:
+			clients[company.Company_ID] = company.Client_ID
+			continue
+		}
+		failed = true
+	}
+	if failed {
+		return errBatchFailed
+	}
+
+	query, args := "DELETE FROM Company_Detail WHERE "+companyKeyColumn+" IN ("+placeholderList(s.dbType, 1, len(ids))+")", ids
+	if action != batchDelete {
+		query, args = insertRowsQuery(s.dbType, len(ops), false), nil
+		if action == batchUpsert {
+			query = upsertClientRowsQuery(s.dbType, len(ops))
+		}
+		for i := range ops {
+			args = append(args, companyArgs(&ops[i].Company)...)
+		}
+	}
+
+	// the statement fails as a whole, so report its error on every operation
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		err = storeError(err)
+		for i := range errs {
+			errs[i] = err
+		}
+		return errBatchFailed
+	}
+	return nil
+}
+
+// storedClients returns the Client_ID of each of the given Company_IDs that is stored
+func (s *sqlStore) storedClients(ctx context.Context, tx *sql.Tx, ids []interface{}) (map[int]int, error) {
+
+	rows, err := tx.QueryContext(ctx, "SELECT "+companyKeyColumn+", Client_ID FROM Company_Detail WHERE "+companyKeyColumn+" IN ("+placeholderList(s.dbType, 1, len(ids))+")", ids...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	clients := make(map[int]int, len(ids))
+	for rows.Next() {
+		var companyID, clientID int
+		if err = rows.Scan(&companyID, &clientID); err != nil {
+			return nil, err
+		}
+		clients[companyID] = clientID
+	}
+	return clients, rows.Err()
+}
+
+// batchEach runs every operation on its own through a prepared statement per
+// action, reporting the error of each operation in errs
+func (s *sqlStore) batchEach(ctx context.Context, ops []BatchOp, errs []error) error {
+
+	stmts := make(map[BatchAction]*sql.Stmt)
+	defer func() {
+		for _, stmt := range stmts {
+			stmt.Close()
+		}
+	}()
+
+	for i := range ops {
+
+		// an upsert has to tell the rows of another client, in a transaction of its own
+		action := ops[i].Action
+		if action == batchUpsert {
+			_, errs[i] = s.Upsert(ctx, &ops[i].Company)
+			continue
+		}
+
+		stmt, ok := stmts[action]
+		if !ok {
+			query := "DELETE FROM Company_Detail WHERE " + companyKeyColumn + "=" + s.ph(1)
+			if action == batchCreate {
+				query = insertCompanyQuery(s.dbType)
+			}
+
+			var err error
+			if stmt, err = s.db.PrepareContext(ctx, query); err != nil {
+				return err
+			}
+			stmts[action] = stmt
+		}
+
+		if action != batchDelete {
+			_, err := stmt.ExecContext(ctx, companyArgs(&ops[i].Company)...)
+			errs[i] = storeError(err)
+			continue
+		}
+
+		result, err := stmt.ExecContext(ctx, ops[i].Company.Company_ID)
+		if err == nil {
+			var affected int64
+			if affected, err = result.RowsAffected(); err == nil && affected == 0 {
+				err = ErrCompanyNotFound
+			}
+		}
+		errs[i] = err
+	}
+	return nil
+}
+
+// update runs the Company update on db, reporting ErrCompanyNotFound for unknown IDs
+func (s *sqlStore) update(ctx context.Context, db sqlExecutor, companyID int, company *Company) error {
+	return s.updateFields(ctx, db, companyID, company, companyFields)
+}
+
+// UpdateColumns persists only the given columns of the Company with the given ID
+func (s *sqlStore) UpdateColumns(ctx context.Context, companyID int, company *Company, columns []string, checks ...Precondition) error {
+	return s.checked(ctx, companyID, checks, func(db sqlExecutor) error {
+		return s.updateFields(ctx, db, companyID, company, selectFields(columns))
+	})
+}
+
+// updateFields persists the given fields of the Company with the given ID
+func (s *sqlStore) updateFields(ctx context.Context, db sqlExecutor, companyID int, company *Company, fields []companyField) error {
+
+	result, err := db.ExecContext(ctx, updateFieldsQuery(s.dbType, fields), append(fieldArgs(fields, company), companyID)...)
+	if err != nil {
+		return storeError(err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil || affected > 0 {
+		return err
+	}
+
+	// MySQL reports 0 affected rows when nothing changed, so check the row exists
+	var found int
+	err = db.QueryRowContext(ctx, "SELECT 1 FROM Company_Detail WHERE "+companyKeyColumn+"="+s.ph(1), companyID).Scan(&found)
+	if err == sql.ErrNoRows {
+		return ErrCompanyNotFound
+	}
+	return err
+}
+
+// delete removes a Company on db, reporting ErrCompanyNotFound for unknown IDs
+func (s *sqlStore) delete(ctx context.Context, db sqlExecutor, companyID int) error {
+
+	result, err := db.ExecContext(ctx, "DELETE FROM Company_Detail WHERE "+companyKeyColumn+"="+s.ph(1), companyID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err == nil && affected == 0 {
+		err = ErrCompanyNotFound
+	}
+	return err
+}
+
+// checked runs write once the preconditions hold on the stored Company, its row
+// stays locked in a transaction until the write is done
+func (s *sqlStore) checked(ctx context.Context, companyID int, checks []Precondition, write func(db sqlExecutor) error) error {
+
+	if len(checks) == 0 {
+		return write(s.db)
+	}
+
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+
+		// SQLite has no row locks, its single connection serializes the writes
+		query := "SELECT " + columnList(companyFields) + " FROM Company_Detail WHERE " + companyKeyColumn + "=" + s.ph(1)
+		if s.dbType != "sqlite" {
+			query += " FOR UPDATE"
+		}
+
+		var current Company
+		err := tx.QueryRowContext(ctx, query, companyID).Scan(scanDests(companyFields, &current)...)
+		if err == sql.ErrNoRows {
+			return ErrCompanyNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, check := range checks {
+			if err = check(current); err != nil {
+				return err
+			}
+		}
+		return write(tx)
+	})
+}
+
+// inTx runs fn in a transaction, committing on success and rolling back on error
+func (s *sqlStore) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// storeError translates the duplicate key errors of every driver to ErrCompanyExists
+func storeError(err error) error {
+
+	if isDuplicateKey(err) {
+		return ErrCompanyExists
+	}
+	return err
+}
+
+// isDuplicateKey reports whether err is a primary key or unique violation of any driver
+func isDuplicateKey(err error) bool {
+
+	var (
+		mysqlErr  *mysql.MySQLError
+		pqErr     *pq.Error
+		sqliteErr *sqlite.Error
+	)
+
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 ||
+		errors.As(err, &pqErr) && pqErr.Code == "23505" ||
+		errors.As(err, &sqliteErr) && (sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY || sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+// newTestSQLiteStore returns a sqlStore on a fresh in-memory SQLite DB
+func newTestSQLiteStore(t *testing.T) *sqlStore {
+
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	store := newSQLiteStore(db)
+
+	migrator, err := newMigrator("sqlite", db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestSQLStoreErrors(t *testing.T) {
+
+	ctx := context.Background()
+	store := newTestSQLiteStore(t)
+
+	company := testCompany(1)
+	if err := store.Create(ctx, &company); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Create(ctx, &company); err != ErrCompanyExists {
+		t.Errorf("duplicate create: got %v want %v", err, ErrCompanyExists)
+	}
+
+	// updating with unchanged values must not be reported as not found
+	if err := store.Update(ctx, 1, &company); err != nil {
+		t.Errorf("unchanged update: got %v", err)
+	}
+
+	if _, err := store.Get(ctx, 2); err != ErrCompanyNotFound {
+		t.Errorf("get unknown: got %v want %v", err, ErrCompanyNotFound)
+	}
+	if err := store.Update(ctx, 2, &company); err != ErrCompanyNotFound {
+		t.Errorf("update unknown: got %v want %v", err, ErrCompanyNotFound)
+	}
+	if err := store.Delete(ctx, 2); err != ErrCompanyNotFound {
+		t.Errorf("delete unknown: got %v want %v", err, ErrCompanyNotFound)
+	}
+}
+
+func TestSQLStoreBatchRollback(t *testing.T) {
+
+	ctx := context.Background()
+	store := newTestSQLiteStore(t)
+
+	// the second company clashes with the first, nothing must be stored
+	if err := store.CreateBatch(ctx, []Company{testCompany(1), testCompany(1)}); !errors.Is(err, ErrCompanyExists) {
+		t.Fatalf("batch create: got %v want %v", err, ErrCompanyExists)
+	}
+	if companies, _ := store.List(ctx, ListOptions{}); len(companies) != 0 {
+		t.Errorf("failed batch left %d companies behind", len(companies))
+	}
+
+	if err := store.CreateBatch(ctx, []Company{testCompany(1), testCompany(2)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// updating an unknown company rolls back the whole batch
+	updated := testCompany(1)
+	updated.Company_Name = "TEST_GO_UPDATED"
+	err := store.UpdateBatch(ctx, []Company{updated, testCompany(3)})
+	if !errors.Is(err, ErrCompanyNotFound) {
+		t.Fatalf("batch update: got %v want %v", err, ErrCompanyNotFound)
+	}
+	if company, _ := store.Get(ctx, 1); company.Company_Name != "TEST_GO" {
+		t.Errorf("failed batch update changed company 1: %+v", company)
+	}
+}
+
+func TestSQLiteEachReleasesConnection(t *testing.T) {
+
+	ctx := context.Background()
+	store := newTestSQLiteStore(t)
+	if err := store.CreateBatch(ctx, []Company{testCompany(1), testCompany(2)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the single connection is free while fn runs, so a slow export does not
+	// block the other queries
+	count := 0
+	err := store.Each(ctx, ListOptions{}, func(company Company) error {
+		count++
+		getCtx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		_, err := store.Get(getCtx, company.Company_ID)
+		return err
+	})
+	if err != nil || count != 2 {
+		t.Errorf("each got %d companies, %v", count, err)
+	}
+}
+
+func TestSQLStoreReadsNullColumns(t *testing.T) {
+
+	ctx := context.Background()
+	store := newTestSQLiteStore(t)
+
+	// only the required columns are set
+	if _, err := store.db.ExecContext(ctx, "INSERT INTO Company_Detail (Client_ID, Company_ID, Company_Name) VALUES (1, 2, 'TEST_GO')"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the NULL text columns read as "", flagged for the list cursors
+	want := Company{Client_ID: 1, Company_ID: 2, Company_Name: "TEST_GO"}
+	want.nullText = nullTextBit("ASIC") | nullTextBit("Flight_Risk_Status") | nullTextBit("Recruit_Status")
+
+	company, err := store.Get(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if company != want {
+		t.Errorf("get: got %+v want %+v", company, want)
+	}
+
+	companies, err := store.List(ctx, ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(companies) != 1 || companies[0] != want {
+		t.Errorf("list: got %+v want [%+v]", companies, want)
+	}
+}
+
+func TestSQLStoreTimeOffsetRoundTrip(t *testing.T) {
+
+	ctx := context.Background()
+	store := newTestSQLiteStore(t)
+
+	// a timestamp sent with a +02:00 offset reads back as the same instant
+	created := time.Date(2021, 2, 25, 10, 0, 0, 0, time.FixedZone("", 2*60*60))
+	company := testCompany(1)
+	company.Create_Date = newNullTime(created)
+	if err := store.Create(ctx, &company); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := store.Get(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.Create_Date.Valid || !stored.Create_Date.Time.Equal(created) {
+		t.Errorf("get: got %+v want %v", stored.Create_Date, created)
+	}
+
+	companies, err := store.List(ctx, ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(companies) != 1 || !companies[0].Create_Date.Time.Equal(created) {
+		t.Errorf("list: got %+v", companies)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+type (
+
+	// NullInt is a nullable integer column, encoded as a JSON number or null.
+	// It also decodes the numeric strings sent by older clients
+	NullInt struct {
+		sql.NullInt64
+	}
+
+	// NullTime is a nullable timestamp column, encoded as RFC 3339 or null
+	NullTime struct {
+		sql.NullTime
+	}
+
+	// NullDate is a nullable date column, encoded as YYYY-MM-DD or null. Its
+	// value is midnight UTC of the day, whichever store it comes from
+	NullDate struct {
+		sql.NullTime
+	}
+)
+
+// dateLayout is the JSON layout of NullDate values
+const dateLayout = "2006-01-02"
+
+// dateLayouts are the accepted JSON layouts of NullTime and NullDate values
+var dateLayouts = []string{dateLayout, time.RFC3339}
+
+// newNullInt returns a valid NullInt
+func newNullInt(value int64) NullInt {
+	return NullInt{sql.NullInt64{Int64: value, Valid: true}}
+}
+
+// newNullTime returns a valid NullTime
+func newNullTime(value time.Time) NullTime {
+	return NullTime{sql.NullTime{Time: value, Valid: true}}
+}
+
+// newNullDate returns a valid NullDate of the day of value
+func newNullDate(value time.Time) NullDate {
+	return NullDate{sql.NullTime{Time: dayOf(value), Valid: true}}
+}
+
+// dayOf returns midnight UTC of the calendar day of value, in its own offset
+func dayOf(value time.Time) time.Time {
+	return time.Date(value.Year(), value.Month(), value.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// MarshalJSON encodes the number, or null
+func (n NullInt) MarshalJSON() ([]byte, error) {
+
+	if !n.Valid {
+		return []byte("null"), nil
+	}
+	return []byte(strconv.FormatInt(n.Int64, 10)), nil
+}
+
+// UnmarshalJSON decodes a number, a numeric string, or null / "" as NULL
+func (n *NullInt) UnmarshalJSON(data []byte) error {
+
+	*n = NullInt{}
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	// older clients send the totals as strings
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		if text == "" {
+			return nil
+		}
+		data = []byte(text)
+	}
+
+	value, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return fmt.Errorf("%s is not an integer", data)
+	}
+	*n = newNullInt(value)
+	return nil
+}
+
+// Value binds the time in UTC. The DATE / TIMESTAMP columns keep no offset, and
+// SQLite stores the time as text it only scans back in UTC
+func (t NullTime) Value() (driver.Value, error) {
+
+	if !t.Valid {
+		return nil, nil
+	}
+	return t.Time.UTC(), nil
+}
+
+// MarshalJSON encodes the timestamp as RFC 3339, or null
+func (t NullTime) MarshalJSON() ([]byte, error) {
+
+	if !t.Valid {
+		return []byte("null"), nil
+	}
+	return json.Marshal(t.Time.Format(time.RFC3339))
+}
+
+// formatDate formats the values without a time of day as YYYY-MM-DD and the
+// others as RFC 3339, for the cells that do not belong to a column
+func formatDate(value time.Time) string {
+
+	if isDate(value) {
+		return value.Format(dateLayout)
+	}
+	return value.Format(time.RFC3339)
+}
+
+// isDate reports whether value has no time of day
+func isDate(value time.Time) bool {
+
+	hour, min, sec := value.Clock()
+	return hour == 0 && min == 0 && sec == 0 && value.Nanosecond() == 0
+}
+
+// UnmarshalJSON decodes a YYYY-MM-DD or RFC 3339 string, or null / "" as NULL
+func (t *NullTime) UnmarshalJSON(data []byte) error {
+
+	*t = NullTime{}
+
+	var text *string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("%s is not a date string", data)
+	}
+	if text == nil || *text == "" {
+		return nil
+	}
+
+	value, err := parseDate(*text)
+	if err != nil {
+		return err
+	}
+	*t = newNullTime(value)
+	return nil
+}
+
+// Scan reads the date of a DATE column, at midnight UTC
+func (d *NullDate) Scan(src interface{}) error {
+
+	if err := d.NullTime.Scan(src); err != nil {
+		return err
+	}
+	if d.Valid {
+		d.Time = dayOf(d.Time)
+	}
+	return nil
+}
+
+// Value binds the date at midnight UTC
+func (d NullDate) Value() (driver.Value, error) {
+
+	if !d.Valid {
+		return nil, nil
+	}
+	return dayOf(d.Time), nil
+}
+
+// MarshalJSON encodes the date as YYYY-MM-DD, or null
+func (d NullDate) MarshalJSON() ([]byte, error) {
+
+	if !d.Valid {
+		return []byte("null"), nil
+	}
+	return json.Marshal(d.Time.Format(dateLayout))
+}
+
+// UnmarshalJSON decodes a YYYY-MM-DD date, or the day of an RFC 3339
+// timestamp, or null / "" as NULL
+func (d *NullDate) UnmarshalJSON(data []byte) error {
+
+	var t NullTime
+	if err := t.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	*d = NullDate(t)
+	if d.Valid {
+		d.Time = dayOf(d.Time)
+	}
+	return nil
+}
+
+// parseDate parses value with the first matching dateLayouts entry
+func parseDate(value string) (parsed time.Time, err error) {
+
+	for _, layout := range dateLayouts {
+		if parsed, err = time.Parse(layout, value); err == nil {
+			return
+		}
+	}
+	return
+}
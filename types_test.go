@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestNullIntJSON(t *testing.T) {
+
+	for input, want := range map[string]NullInt{
+		`1234`:   newNullInt(1234),
+		`"1234"`: newNullInt(1234),
+		`""`:     {},
+		`null`:   {},
+	} {
+		var got NullInt
+		if err := json.Unmarshal([]byte(input), &got); err != nil || got != want {
+			t.Errorf("decode %s: got %+v, %v want %+v", input, got, err, want)
+		}
+	}
+
+	for _, input := range []string{`"12a"`, `12.5`, `true`} {
+		var got NullInt
+		if err := json.Unmarshal([]byte(input), &got); err == nil {
+			t.Errorf("decode %s: accepted as %+v", input, got)
+		}
+	}
+
+	for value, want := range map[NullInt]string{newNullInt(42): `42`, {}: `null`} {
+		if got, _ := json.Marshal(value); string(got) != want {
+			t.Errorf("encode %+v: got %s want %s", value, got, want)
+		}
+	}
+}
+
+func TestNullTimeJSON(t *testing.T) {
+
+	for input, want := range map[string]NullTime{
+		`"2021-02-25"`:           newNullTime(time.Date(2021, 2, 25, 0, 0, 0, 0, time.UTC)),
+		`"2021-02-25T10:30:00Z"`: newNullTime(time.Date(2021, 2, 25, 10, 30, 0, 0, time.UTC)),
+		`""`:                     {},
+		`null`:                   {},
+	} {
+		var got NullTime
+		if err := json.Unmarshal([]byte(input), &got); err != nil || !got.Time.Equal(want.Time) || got.Valid != want.Valid {
+			t.Errorf("decode %s: got %+v, %v want %+v", input, got, err, want)
+		}
+	}
+
+	for _, input := range []string{`"25/02/2021"`, `20210225`} {
+		var got NullTime
+		if err := json.Unmarshal([]byte(input), &got); err == nil {
+			t.Errorf("decode %s: accepted as %+v", input, got)
+		}
+	}
+
+	// timestamps keep their time and offset at midnight
+	for want, value := range map[string]NullTime{
+		`"2021-02-25T00:00:00Z"`:      newNullTime(time.Date(2021, 2, 25, 0, 0, 0, 0, time.UTC)),
+		`"2021-02-25T00:00:00+05:00"`: newNullTime(time.Date(2021, 2, 25, 0, 0, 0, 0, time.FixedZone("", 5*60*60))),
+		`"2021-02-25T10:30:00Z"`:      newNullTime(time.Date(2021, 2, 25, 10, 30, 0, 0, time.UTC)),
+		`null`:                        {},
+	} {
+		if got, _ := json.Marshal(value); string(got) != want {
+			t.Errorf("encode %+v: got %s want %s", value, got, want)
+		}
+	}
+}
+
+func TestNullDateJSON(t *testing.T) {
+
+	day := time.Date(2021, 2, 25, 0, 0, 0, 0, time.UTC)
+	for input, want := range map[string]NullDate{
+		`"2021-02-25"`:                newNullDate(day),
+		`"2021-02-25T23:30:00-05:00"`: newNullDate(day),
+		`""`:                          {},
+		`null`:                        {},
+	} {
+		var got NullDate
+		if err := json.Unmarshal([]byte(input), &got); err != nil || got != want {
+			t.Errorf("decode %s: got %+v, %v want %+v", input, got, err, want)
+		}
+	}
+
+	for want, value := range map[string]NullDate{
+		`"2021-02-25"`: newNullDate(time.Date(2021, 2, 25, 10, 30, 0, 0, time.FixedZone("", 5*60*60))),
+		`null`:         {},
+	} {
+		if got, _ := json.Marshal(value); string(got) != want {
+			t.Errorf("encode %+v: got %s want %s", value, got, want)
+		}
+	}
+
+	// every store reads the date back at midnight UTC
+	var scanned NullDate
+	if err := scanned.Scan(time.Date(2021, 2, 25, 0, 0, 0, 0, time.FixedZone("", -8*60*60))); err != nil || scanned != newNullDate(day) {
+		t.Errorf("scan got %+v, %v", scanned, err)
+	}
+	if value, err := newNullDate(day.Add(13 * time.Hour)).Value(); err != nil || value != day {
+		t.Errorf("bound %v, %v want %v", value, err, day)
+	}
+}
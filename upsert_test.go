@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestUpsert(t *testing.T) {
+
+	for _, dbType := range testDBTypes() {
+
+		ctx := context.Background()
+		app := initTestModule(t, dbType)
+
+		company := testCompany(1)
+		if created, err := app.Store.Upsert(ctx, &company); err != nil || !created {
+			t.Fatalf("%s: insert got created %t, %v", dbType, created, err)
+		}
+
+		// replacing with the same or changed fields is an update
+		if created, err := app.Store.Upsert(ctx, &company); err != nil || created {
+			t.Errorf("%s: unchanged upsert got created %t, %v", dbType, created, err)
+		}
+		company.ASIC = "changed"
+		if created, err := app.Store.Upsert(ctx, &company); err != nil || created {
+			t.Errorf("%s: update got created %t, %v", dbType, created, err)
+		}
+
+		// the company of another client is left as is
+		other := testCompany(1)
+		other.Client_ID = 7
+		if _, err := app.Store.Upsert(ctx, &other); err != ErrCompanyOfOtherClient {
+			t.Errorf("%s: other client got %v want %v", dbType, err, ErrCompanyOfOtherClient)
+		}
+
+		stored, err := app.Store.Get(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameCompany(stored, company) {
+			t.Errorf("%s: got %+v want %+v", dbType, stored, company)
+		}
+	}
+}
+
+func TestUpsertCompany(t *testing.T) {
+
+	for _, dbType := range testDBTypes() {
+
+		app := initTestModule(t, dbType)
+
+		full, _ := json.Marshal(testCompany(1))
+		for _, tc := range []struct {
+			name      string
+			clientID  string
+			companyID string
+			body      string
+			status    int
+		}{
+			{"insert", "2399029309", "1", string(full), http.StatusCreated},
+			{"update", "2399029309", "1", string(full), http.StatusOK},
+			{"keys from path", "2399029309", "1", `{"Company_Name": "RENAMED"}`, http.StatusOK},
+			{"insert keys from path", "5", "2", `{"Company_Name": "NEW"}`, http.StatusCreated},
+			{"other client", "5", "1", `{"Company_Name": "TAKEN"}`, http.StatusConflict},
+			{"key mismatch", "2399029309", "3", string(full), http.StatusUnprocessableEntity},
+			{"invalid payload", "5", "3", `{"Recruit_Status": "Hired"}`, http.StatusUnprocessableEntity},
+			{"invalid key", "5", "x", `{}`, http.StatusBadRequest},
+		} {
+			path := "/clients/" + tc.clientID + "/companies/" + tc.companyID
+			req := httptest.NewRequest("PUT", path, strings.NewReader(tc.body))
+			req = mux.SetURLVars(req, map[string]string{"Client_ID": tc.clientID, "Company_ID": tc.companyID})
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(app.upsertCompany).ServeHTTP(rr, req)
+
+			if rr.Code != tc.status {
+				t.Errorf("%s %s: got status %d want %d : %s", dbType, tc.name, rr.Code, tc.status, rr.Body)
+				continue
+			}
+			if location := rr.Header().Get("Location"); (rr.Code == http.StatusCreated) != (location == path) {
+				t.Errorf("%s %s: got Location %q", dbType, tc.name, location)
+			}
+		}
+
+		stored, err := app.Store.Get(context.Background(), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.Company_Name != "RENAMED" || stored.Client_ID != 2399029309 {
+			t.Errorf("%s: got %+v", dbType, stored)
+		}
+	}
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// v1SchemaPrefix names the OpenAPI components of the /v1 routes
+const v1SchemaPrefix = "v1."
+
+// maxV1JSONBytes caps the JSON payloads of the /v1 and legacy routes, enough
+// for a batch of maxBatchOperations companies
+const maxV1JSONBytes = 4 << 20
+
+// legacyDeprecation is when the /v1 routes replaced the legacy ones
+var legacyDeprecation = time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+
+var (
+	// v1Keys maps the legacy keys naming a column, or a filter param of a column,
+	// to their /v1 snake_case key. The columns are already split by underscores
+	v1Keys = newV1Keys()
+
+	// legacyKeys maps the /v1 keys back to the legacy ones
+	legacyKeys = reverseKeys(v1Keys)
+
+	// v1Text renames the columns mentioned in the problem details
+	v1Text = keysReplacer(v1Keys)
+)
+
+// newV1Keys returns the /v1 keys of the columns and of the list params
+func newV1Keys() map[string]string {
+
+	keys := make(map[string]string)
+	for _, field := range companyFields {
+		keys[field.column] = strings.ToLower(field.column)
+	}
+	for _, param := range listParams() {
+		keys[param.name] = strings.ToLower(param.name)
+	}
+	return keys
+}
+
+// reverseKeys returns the keys mapped back to their names
+func reverseKeys(names map[string]string) map[string]string {
+
+	reversed := make(map[string]string, len(names))
+	for name, key := range names {
+		reversed[key] = name
+	}
+	return reversed
+}
+
+// keysReplacer replaces the names by their keys in a text, the longest names
+// go first so a filter param is not renamed as its column
+func keysReplacer(names map[string]string) *strings.Replacer {
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if len(sorted[i]) != len(sorted[j]) {
+			return len(sorted[i]) > len(sorted[j])
+		}
+		return sorted[i] < sorted[j]
+	})
+
+	pairs := make([]string, 0, 2*len(sorted))
+	for _, name := range sorted {
+		pairs = append(pairs, name, names[name])
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+// renameKey returns the name of key in names, key itself if it has none
+func renameKey(names map[string]string, key string) string {
+
+	if renamed, ok := names[key]; ok {
+		return renamed
+	}
+	return key
+}
+
+// renameQuery renames the query params, and the columns listed by the sort
+// and fields params
+func renameQuery(names map[string]string, query url.Values) url.Values {
+
+	renamed := url.Values{}
+	for name, values := range query {
+		name = renameKey(names, name)
+		for _, value := range values {
+			if name == "sort" || name == "fields" {
+				columns := strings.Split(value, ",")
+				for i, column := range columns {
+					desc := strings.HasPrefix(column, "-")
+					columns[i] = renameKey(names, strings.TrimPrefix(column, "-"))
+					if desc {
+						columns[i] = "-" + columns[i]
+					}
+				}
+				value = strings.Join(columns, ",")
+			}
+			renamed.Add(name, value)
+		}
+	}
+	return renamed
+}
+
+// renamePointer renames the tokens of a JSON pointer
+func renamePointer(names map[string]string, pointer string) string {
+
+	tokens := strings.Split(pointer, "/")
+	for i, token := range tokens {
+		tokens[i] = renameKey(names, token)
+	}
+	return strings.Join(tokens, "/")
+}
+
+// jsonRenamer copies a JSON document with its object keys renamed, the keys
+// and number formatting are kept in order
+type jsonRenamer struct {
+	names map[string]string
+
+	// value renames the string values of a key, nil keeps them
+	value func(key, value string) string
+}
+
+// rename returns the renamed copy of a JSON document
+func (rn jsonRenamer) rename(data []byte) ([]byte, error) {
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var buf bytes.Buffer
+	if err := rn.copyValue(decoder, &buf, ""); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("trailing data after the JSON document")
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// copyValue copies the next JSON value of the decoder, key is the object key
+// holding it, or holding the array it is an item of
+func (rn jsonRenamer) copyValue(decoder *json.Decoder, buf *bytes.Buffer, key string) error {
+
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+
+	switch token := token.(type) {
+	case json.Delim:
+		buf.WriteRune(rune(token))
+		for i := 0; decoder.More(); i++ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+
+			itemKey := key
+			if token == '{' {
+				name, err := decoder.Token()
+				if err != nil {
+					return err
+				}
+				itemKey = name.(string)
+				encoded, _ := json.Marshal(renameKey(rn.names, itemKey))
+				buf.Write(encoded)
+				buf.WriteByte(':')
+			}
+			if err := rn.copyValue(decoder, buf, itemKey); err != nil {
+				return err
+			}
+		}
+
+		end, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		buf.WriteRune(rune(end.(json.Delim)))
+
+	case string:
+		if rn.value != nil {
+			token = rn.value(key, token)
+		}
+		encoded, _ := json.Marshal(token)
+		buf.Write(encoded)
+
+	case json.Number:
+		buf.WriteString(token.String())
+
+	default:
+		encoded, _ := json.Marshal(token)
+		buf.Write(encoded)
+	}
+	return nil
+}
+
+// legacyRequest renames the JSON Patch pointers of a /v1 payload
+var legacyRequest = jsonRenamer{
+	names: legacyKeys,
+	value: func(key, value string) string {
+		if key == "path" || key == "from" {
+			return renamePointer(legacyKeys, value)
+		}
+		return value
+	},
+}
+
+// v1Response renames the columns of the problem details of a legacy response
+var v1Response = jsonRenamer{
+	names: v1Keys,
+	value: func(key, value string) string {
+		if key == "field" || key == "detail" {
+			return v1Text.Replace(value)
+		}
+		return value
+	},
+}
+
+// keyNamesKey holds the key names of a request in its context, see keyNames
+type keyNamesKey struct{}
+
+// keyNames returns the names of the column keys sent to the client, nil for
+// the legacy column names
+func keyNames(r *http.Request) map[string]string {
+
+	names, _ := r.Context().Value(keyNamesKey{}).(map[string]string)
+	return names
+}
+
+// v1Writer holds the JSON responses back so their keys can be renamed, the
+// exports are streamed as is
+type v1Writer struct {
+	http.ResponseWriter
+	status int
+	held   bool
+	body   bytes.Buffer
+}
+
+func (w *v1Writer) WriteHeader(status int) {
+
+	if w.status != 0 {
+		return
+	}
+	w.status = status
+
+	if links := w.Header().Get("Link"); links != "" {
+		w.Header().Set("Link", v1Links(links))
+	}
+	mediaType, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	w.held = mediaType == "application/json" || mediaType == "application/problem+json"
+	if !w.held {
+		w.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (w *v1Writer) Write(data []byte) (int, error) {
+
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.held {
+		return w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// v1 serves a /v1 route with the handler of its legacy route, translating the
+// snake_case path vars, query params and JSON keys of /v1 to the legacy column
+// names and back
+func (app *App) v1(next http.HandlerFunc) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// the handlers read the legacy path vars and query params, the exports
+		// name their columns after the /v1 keys
+		vars := make(map[string]string)
+		for name, value := range mux.Vars(r) {
+			vars[renameKey(legacyKeys, name)] = value
+		}
+		r = mux.SetURLVars(r.WithContext(context.WithValue(r.Context(), keyNamesKey{}, v1Keys)), vars)
+		r.URL.RawQuery = renameQuery(legacyKeys, r.URL.Query()).Encode()
+
+		// the handlers report invalid JSON payloads, they are passed as is. Other
+		// payloads, like import files, are streamed to the handler untouched
+		if r.Body != nil && isJSONPayload(r) {
+			body, ok := app.readJSONPayload(w, r)
+			if !ok {
+				return
+			}
+			if renamed, err := legacyRequest.rename(body); err == nil {
+				body = renamed
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			r.ContentLength = int64(len(body))
+		}
+
+		writer := &v1Writer{ResponseWriter: w}
+		next(writer, r)
+		if !writer.held {
+			return
+		}
+
+		// rename the JSON keys of the response
+		body := writer.body.Bytes()
+		if renamed, err := v1Response.rename(body); err != nil {
+			app.logger.Println(err)
+		} else {
+			body = renamed
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(writer.status)
+		w.Write(body)
+	}
+}
+
+// readJSONPayload buffers a JSON payload of up to maxV1JSONBytes, larger or
+// unreadable payloads are answered with a problem and ok is false
+func (app *App) readJSONPayload(w http.ResponseWriter, r *http.Request) (body []byte, ok bool) {
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxV1JSONBytes))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		app.writeProblem(w, r, http.StatusRequestEntityTooLarge, "JSON payload must not exceed "+strconv.Itoa(maxV1JSONBytes)+" bytes")
+		return nil, false
+	}
+	if err != nil {
+		app.writeProblem(w, r, http.StatusBadRequest, "invalid payload : "+err.Error())
+		return nil, false
+	}
+	return body, true
+}
+
+// isJSONPayload reports whether the request body is JSON, by a JSON or +json
+// content type or by having none
+func isJSONPayload(r *http.Request) bool {
+
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+// v1Links renames the query params of the URLs of a Link header
+func v1Links(header string) string {
+
+	links := strings.Split(header, ", ")
+	for i, link := range links {
+		target, params, ok := strings.Cut(strings.TrimPrefix(link, "<"), ">")
+		if !ok {
+			continue
+		}
+		linkURL, err := url.Parse(target)
+		if err != nil {
+			continue
+		}
+		linkURL.RawQuery = renameQuery(v1Keys, linkURL.Query()).Encode()
+		links[i] = "<" + linkURL.String() + ">" + params
+	}
+	return strings.Join(links, ", ")
+}
+
+// deprecated answers a legacy route with the Deprecation and Sunset headers
+// of RFC 9745 and RFC 8594, pointing clients to its /v1 route
+func (app *App) deprecated(next http.HandlerFunc) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		w.Header().Set("Deprecation", "@"+strconv.FormatInt(legacyDeprecation.Unix(), 10))
+		if !app.legacySunset.IsZero() {
+			w.Header().Set("Sunset", app.legacySunset.UTC().Format(http.TimeFormat))
+		}
+
+		// JSON payloads are capped like on /v1, import files keep their own limit
+		if r.Body != nil && isJSONPayload(r) {
+			body, ok := app.readJSONPayload(w, r)
+			if !ok {
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			r.ContentLength = int64(len(body))
+		}
+		next(w, r)
+	}
+}
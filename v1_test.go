@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// v1Payload returns the /v1 JSON of a company, with the snake_case keys
+func v1Payload(company Company) string {
+
+	var fields map[string]interface{}
+	legacy, _ := json.Marshal(company)
+	json.Unmarshal(legacy, &fields)
+
+	snakeCase := make(map[string]interface{})
+	for key, value := range fields {
+		snakeCase[strings.ToLower(key)] = value
+	}
+	payload, _ := json.Marshal(snakeCase)
+	return string(payload)
+}
+
+func TestV1Routes(t *testing.T) {
+
+	for _, dbType := range testDBTypes() {
+
+		app := initTestModule(t, dbType)
+		app.legacySunset = time.Date(2027, 10, 17, 0, 0, 0, 0, time.UTC)
+
+		serve := func(method, path, body, contentType string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(body))
+			if contentType != "" {
+				req.Header.Set("Content-Type", contentType)
+			}
+			rr := httptest.NewRecorder()
+			app.Router.ServeHTTP(rr, req)
+			return rr
+		}
+
+		// companies created under /v1 are read by the legacy routes, with the same version
+		for _, companyID := range []int{1, 2} {
+			rr := serve("POST", "/v1/companies", v1Payload(testCompany(companyID)), "application/json")
+			if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Body.String(), `{"client_id":2399029309,"company_id":`) {
+				t.Fatalf("%s: v1 create got %d %s", dbType, rr.Code, rr.Body)
+			}
+		}
+		v1 := serve("GET", "/v1/companies/1", "", "")
+		legacy := serve("GET", "/Company_Detail/1", "", "")
+		var v1Fields, legacyFields map[string]interface{}
+		json.Unmarshal(v1.Body.Bytes(), &v1Fields)
+		json.Unmarshal(legacy.Body.Bytes(), &legacyFields)
+		if v1Fields["company_name"] != "TEST_GO" || legacyFields["Company_Name"] != "TEST_GO" || len(v1Fields) != len(legacyFields) {
+			t.Errorf("%s: got v1 %v legacy %v", dbType, v1Fields, legacyFields)
+		}
+		if v1.Header().Get("ETag") == "" || v1.Header().Get("ETag") != legacy.Header().Get("ETag") {
+			t.Errorf("%s: got v1 ETag %q legacy %q", dbType, v1.Header().Get("ETag"), legacy.Header().Get("ETag"))
+		}
+
+		// only the legacy routes are deprecated
+		if got := legacy.Header().Get("Deprecation"); got != "@"+strconv.FormatInt(legacyDeprecation.Unix(), 10) {
+			t.Errorf("%s: got legacy Deprecation %q", dbType, got)
+		}
+		if got := legacy.Header().Get("Sunset"); got != "Sun, 17 Oct 2027 00:00:00 GMT" {
+			t.Errorf("%s: got legacy Sunset %q", dbType, got)
+		}
+		if v1.Header().Get("Deprecation") != "" || v1.Header().Get("Sunset") != "" {
+			t.Errorf("%s: v1 route is deprecated", dbType)
+		}
+
+		// the page links keep the snake_case params
+		rr := serve("GET", "/v1/companies?limit=1&sort=-company_id&fields=company_name", "", "")
+		link := rr.Header().Get("Link")
+		if rr.Code != http.StatusOK || !strings.Contains(link, "/v1/companies?") || !strings.Contains(link, "sort=-company_id") ||
+			!strings.Contains(link, "fields=company_name") || !strings.Contains(rr.Body.String(), `"items":[{"company_name":"TEST_GO"}]`) {
+			t.Fatalf("%s: v1 list got %d %s, Link %s", dbType, rr.Code, rr.Body, link)
+		}
+		next := strings.TrimPrefix(strings.Split(link, ">")[0], "<")
+		if rr = serve("GET", next, "", ""); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"has_more":false,"items":[{"company_name":"TEST_GO"}]`) {
+			t.Errorf("%s: next page got %d %s", dbType, rr.Code, rr.Body)
+		}
+
+		// the problem details name the snake_case fields
+		rr = serve("PUT", "/v1/companies/1", `{"client_id": 2399029309, "company_id": 1}`, "application/json")
+		var p problem
+		json.Unmarshal(rr.Body.Bytes(), &p)
+		if rr.Code != http.StatusUnprocessableEntity || len(p.Errors) == 0 || p.Errors[0].Field != "company_name" {
+			t.Errorf("%s: invalid v1 update got %d %s", dbType, rr.Code, rr.Body)
+		}
+		if rr = serve("GET", "/v1/companies?sort=Nope", "", ""); !strings.Contains(rr.Body.String(), "company_name") || strings.Contains(rr.Body.String(), "Company_Name") {
+			t.Errorf("%s: invalid v1 sort got %d %s", dbType, rr.Code, rr.Body)
+		}
+
+		// JSON payloads are buffered up to maxV1JSONBytes, on the legacy routes too
+		rr = serve("POST", "/v1/companies", `{"company_name": "`+strings.Repeat("x", maxV1JSONBytes)+`"}`, "application/json")
+		if rr.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s: oversized v1 payload got %d want %d", dbType, rr.Code, http.StatusRequestEntityTooLarge)
+		}
+		rr = serve("POST", "/Company_Detail:batch", `{"operations": [{"op": "create", "company": {"Company_Name": "`+strings.Repeat("x", maxV1JSONBytes)+`"}}]}`, "")
+		if rr.Code != http.StatusRequestEntityTooLarge || rr.Header().Get("Deprecation") == "" {
+			t.Errorf("%s: oversized legacy batch got %d want %d", dbType, rr.Code, http.StatusRequestEntityTooLarge)
+		}
+
+		// the JSON Patch pointers name the snake_case fields
+		rr = serve("PATCH", "/v1/companies/1", `[{"op": "test", "path": "/company_name", "value": "TEST_GO"}, {"op": "replace", "path": "/asic", "value": "99"}]`, jsonPatchType)
+		if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"asic":"99"`) {
+			t.Errorf("%s: v1 JSON Patch got %d %s", dbType, rr.Code, rr.Body)
+		}
+	}
+}
+
+func TestIsJSONPayload(t *testing.T) {
+
+	for contentType, want := range map[string]bool{
+		"":                                  true,
+		"application/json":                  true,
+		"application/json; charset=utf-8":   true,
+		mergePatchType:                      true,
+		jsonPatchType:                       true,
+		"text/csv":                          false,
+		xlsxType:                            false,
+		"application/x-www-form-urlencoded": false,
+	} {
+		req := httptest.NewRequest("POST", "/v1/companies", nil)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if got := isJSONPayload(req); got != want {
+			t.Errorf("%q: got %t want %t", contentType, got, want)
+		}
+	}
+}
+
+func TestJSONRenamer(t *testing.T) {
+
+	for _, tc := range []struct {
+		renamer jsonRenamer
+		in      string
+		want    string
+	}{
+		{v1Response, `{"Company_ID": 12345678901234567890, "b": [{"Total_Backfill": 1.50, "c": null}], "ASIC": true}`,
+			`{"company_id":12345678901234567890,"b":[{"total_backfill":1.50,"c":null}],"asic":true}` + "\n"},
+		{v1Response, `{"errors": [{"field": "Total_Flight_Risk", "detail": "Total_Flight_Risk_min and Company_Name"}], "Company_Name": "Company_ID"}`,
+			`{"errors":[{"field":"total_flight_risk","detail":"total_flight_risk_min and company_name"}],"company_name":"Company_ID"}` + "\n"},
+		{legacyRequest, `[{"op": "move", "from": "/company_name", "path": "/asic"}]`,
+			`[{"op":"move","from":"/Company_Name","path":"/ASIC"}]` + "\n"},
+	} {
+		got, err := tc.renamer.rename([]byte(tc.in))
+		if err != nil || string(got) != tc.want {
+			t.Errorf("%s: got %s, %v want %s", tc.in, got, err, tc.want)
+		}
+	}
+
+	for _, invalid := range []string{``, `{"a": }`, `{} {}`} {
+		if _, err := v1Response.rename([]byte(invalid)); err == nil {
+			t.Errorf("invalid JSON %q renamed", invalid)
+		}
+	}
+}
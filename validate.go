@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+type (
+
+	// fieldError reports why a single payload field was rejected
+	fieldError struct {
+		Field   string `json:"field"`
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+
+	// validationErrors collects every field error of a payload
+	validationErrors []fieldError
+)
+
+// field error codes
+const (
+	codeUnknownField = "unknown_field"
+	codeInvalidType  = "invalid_type"
+	codeRequired     = "required"
+	codeInvalidValue = "invalid_value"
+	codeInvalidDate  = "invalid_date"
+)
+
+var (
+	// flightRiskStatuses are the accepted Flight_Risk_Status values
+	flightRiskStatuses = []string{"Low", "Medium", "High"}
+
+	// recruitStatuses are the accepted Recruit_Status values
+	recruitStatuses = []string{"Not Started", "Open", "In Progress", "Filled", "On Hold"}
+)
+
+func (errs validationErrors) Error() string {
+
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Field + ": " + err.Message
+	}
+	return "invalid company : " + strings.Join(messages, ", ")
+}
+
+// decodeCompany decodes a Company payload, the JSON key of every field is its
+// column name. Malformed JSON is returned as is, unknown or mistyped fields as
+// validationErrors
+func decodeCompany(body io.Reader, company *Company) error {
+
+	var raw map[string]json.RawMessage
+	if err := json.NewDecoder(body).Decode(&raw); err != nil {
+		return err
+	}
+	if raw == nil {
+		return errors.New("payload must be a JSON object")
+	}
+
+	var errs validationErrors
+	known := make(map[string]bool, len(companyFields))
+	for _, field := range companyFields {
+
+		known[field.column] = true
+		value, ok := raw[field.column]
+		if !ok {
+			continue
+		}
+		if err := json.Unmarshal(value, field.addr(company)); err != nil {
+
+			// dates are parsed while decoding
+			var parseErr *time.ParseError
+			if errors.As(err, &parseErr) {
+				errs = append(errs, fieldError{field.column, codeInvalidDate, "must be a YYYY-MM-DD or RFC 3339 date"})
+			} else {
+				errs = append(errs, fieldError{field.column, codeInvalidType, "invalid value " + string(value)})
+			}
+		}
+	}
+
+	// report unknown fields in a stable order
+	var unknown []string
+	for key := range raw {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		errs = append(errs, fieldError{key, codeUnknownField, "unknown field"})
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// validate checks the Company rules, returning every failing field at once
+func (c *Company) validate() validationErrors {
+
+	var errs validationErrors
+
+	// required fields
+	if c.Client_ID <= 0 {
+		errs = append(errs, fieldError{"Client_ID", codeRequired, "must be a positive number"})
+	}
+	if c.Company_ID <= 0 {
+		errs = append(errs, fieldError{"Company_ID", codeRequired, "must be a positive number"})
+	}
+	if strings.TrimSpace(c.Company_Name) == "" {
+		errs = append(errs, fieldError{"Company_Name", codeRequired, "must not be empty"})
+	}
+
+	// enumerations, empty means unknown
+	for _, enum := range []struct {
+		field   string
+		value   string
+		allowed []string
+	}{
+		{"Flight_Risk_Status", c.Flight_Risk_Status, flightRiskStatuses},
+		{"Recruit_Status", c.Recruit_Status, recruitStatuses},
+	} {
+		if enum.value != "" && !contains(enum.allowed, enum.value) {
+			errs = append(errs, fieldError{enum.field, codeInvalidValue, "must be one of " + strings.Join(enum.allowed, ", ")})
+		}
+	}
+
+	// totals, null means unknown
+	for _, total := range []struct {
+		field string
+		value NullInt
+	}{
+		{"Total_Flight_Risk", c.Total_Flight_Risk},
+		{"Total_Backfill", c.Total_Backfill},
+	} {
+		if total.value.Valid && total.value.Int64 < 0 {
+			errs = append(errs, fieldError{total.field, codeInvalidValue, "must not be negative"})
+		}
+	}
+
+	return errs
+}
+
+// contains reports whether values holds value
+func contains(values []string, value string) bool {
+
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// readCompany decodes and validates the Company payload of r, answering 400 for
+// malformed JSON and 422 with every field error otherwise
+func (app *App) readCompany(w http.ResponseWriter, r *http.Request, company *Company) bool {
+	return app.readCompanyFrom(w, r, r.Body, company)
+}
+
+// readCompanyFrom decodes and validates the Company JSON read from body, as
+// readCompany does
+func (app *App) readCompanyFrom(w http.ResponseWriter, r *http.Request, body io.Reader, company *Company) bool {
+
+	errs, err := checkCompany(body, company)
+	if err != nil {
+		app.writeProblem(w, r, http.StatusBadRequest, "invalid payload : "+err.Error())
+		return false
+	}
+	if len(errs) > 0 {
+		app.writeProblemDetails(w, r, problem{
+			Status: http.StatusUnprocessableEntity,
+			Detail: "invalid company payload",
+			Errors: errs,
+		})
+		return false
+	}
+	return true
+}
+
+// checkCompany decodes and validates the Company JSON read from body, returning
+// malformed JSON as err and every field error otherwise
+func checkCompany(body io.Reader, company *Company) (validationErrors, error) {
+
+	err := decodeCompany(body, company)
+
+	var errs validationErrors
+	if err != nil && !errors.As(err, &errs) {
+		return nil, err
+	}
+	return withRuleErrors(errs, company), nil
+}
+
+// withRuleErrors adds the errors of the Company rules to the decoding errors,
+// reporting each field once
+func withRuleErrors(errs validationErrors, company *Company) validationErrors {
+
+	reported := make(map[string]bool, len(errs))
+	for _, fieldErr := range errs {
+		reported[fieldErr.Field] = true
+	}
+	for _, fieldErr := range company.validate() {
+		if !reported[fieldErr.Field] {
+			errs = append(errs, fieldErr)
+		}
+	}
+	return errs
+}
+
+// requiredColumns returns the columns every Company must set
+func requiredColumns() []string {
+
+	var required []string
+	for _, fieldErr := range (&Company{}).validate() {
+		if fieldErr.Code == codeRequired {
+			required = append(required, fieldErr.Field)
+		}
+	}
+	return required
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeCompany(t *testing.T) {
+
+	var company Company
+
+	// malformed JSON is not a validation error
+	if err := decodeCompany(strings.NewReader(`{"Company_ID":`), &company); err == nil {
+		t.Errorf("malformed payload accepted")
+	} else if _, ok := err.(validationErrors); ok {
+		t.Errorf("malformed payload reported as validation error: %v", err)
+	}
+	if err := decodeCompany(strings.NewReader(`null`), &company); err == nil {
+		t.Errorf("null payload accepted")
+	}
+
+	// every unknown and mistyped field is reported
+	err := decodeCompany(strings.NewReader(`{"Company_ID": "one", "Client_ID": 7, "Data_As_Of_Date": "25/02/2021", "title": "x", "descr": "y"}`), &company)
+	errs, ok := err.(validationErrors)
+	if !ok {
+		t.Fatalf("got %v want validation errors", err)
+	}
+	want := validationErrors{
+		{"Company_ID", codeInvalidType, `invalid value "one"`},
+		{"Data_As_Of_Date", codeInvalidDate, "must be a YYYY-MM-DD or RFC 3339 date"},
+		{"descr", codeUnknownField, "unknown field"},
+		{"title", codeUnknownField, "unknown field"},
+	}
+	if !reflect.DeepEqual(errs, want) {
+		t.Errorf("got %+v want %+v", errs, want)
+	}
+	if company.Client_ID != 7 {
+		t.Errorf("valid fields not decoded: %+v", company)
+	}
+}
+
+func TestValidateCompany(t *testing.T) {
+
+	company := testCompany(1)
+	if errs := company.validate(); len(errs) != 0 {
+		t.Errorf("valid company rejected: %+v", errs)
+	}
+
+	company = Company{
+		Company_Name:       " ",
+		Flight_Risk_Status: "Extreme",
+		Recruit_Status:     "Open",
+		Total_Flight_Risk:  newNullInt(0),
+		Total_Backfill:     newNullInt(-1),
+	}
+
+	var got []string
+	for _, err := range company.validate() {
+		got = append(got, err.Field+":"+err.Code)
+	}
+	want := []string{
+		"Client_ID:" + codeRequired,
+		"Company_ID:" + codeRequired,
+		"Company_Name:" + codeRequired,
+		"Flight_Risk_Status:" + codeInvalidValue,
+		"Total_Backfill:" + codeInvalidValue,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+}
+
+func TestCreateNewCompanyValidation(t *testing.T) {
+
+	app := initTestModule(t, "memory")
+
+	req := httptest.NewRequest("POST", "/Company_Detail", strings.NewReader(`{"Company_ID": "x", "Company_Name": "TEST_GO", "Recruit_Status": "Hired", "extra": 1}`))
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.createNewCompany).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("got status %d want %d", rr.Code, http.StatusUnprocessableEntity)
+	}
+
+	var body problem
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	// the mistyped Company_ID is reported once, not also as missing
+	var got []string
+	for _, err := range body.Errors {
+		got = append(got, err.Field+":"+err.Code)
+	}
+	want := []string{
+		"Company_ID:" + codeInvalidType,
+		"extra:" + codeUnknownField,
+		"Client_ID:" + codeRequired,
+		"Recruit_Status:" + codeInvalidValue,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+}
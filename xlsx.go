@@ -0,0 +1,504 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// xlsxType is the media type of XLSX workbooks
+const xlsxType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// spreadsheet XML namespaces and headers of the XLSX parts
+const (
+	xmlHeader       = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+	spreadsheetNS   = "http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+	relationshipNS  = "http://schemas.openxmlformats.org/package/2006/relationships"
+	officeRelNS     = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+	xlsxSheetPart   = "xl/worksheets/sheet1.xml"
+	xlsxStylesPart  = "xl/styles.xml"
+	xlsxWorkbookRel = "xl/_rels/workbook.xml.rels"
+	xlsxWorkbook    = "xl/workbook.xml"
+)
+
+// limits of the workbooks read, the last column XFD and the uncompressed size
+// of a part, which a small upload can inflate far beyond maxImportBytes
+const (
+	xlsxMaxColumns   = 16384
+	maxXLSXPartBytes = 8 * maxImportBytes
+)
+
+// cell styles of xlsxStyles, dates and timestamps are numbers shown as ISO dates
+const (
+	xlsxDateStyle      = "1"
+	xlsxTimestampStyle = "2"
+)
+
+// xlsxStyles declares the cell formats of the dates and timestamps
+const xlsxStyles = `<styleSheet xmlns="` + spreadsheetNS + `">` +
+	`<numFmts count="2"><numFmt numFmtId="164" formatCode="yyyy-mm-dd"/><numFmt numFmtId="165" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>` +
+	`<fonts count="1"><font><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="3"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs>` +
+	`</styleSheet>`
+
+// xlsxParts are the fixed parts of a workbook with a single Company_Detail
+// sheet, the sheet itself is streamed
+var xlsxParts = []struct {
+	name    string
+	content string
+}{
+	{"[Content_Types].xml", `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/` + xlsxSheetPart + `" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`<Override PartName="/` + xlsxStylesPart + `" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", `<Relationships xmlns="` + relationshipNS + `">` +
+		`<Relationship Id="rId1" Type="` + officeRelNS + `/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/workbook.xml", `<workbook xmlns="` + spreadsheetNS + `" xmlns:r="` + officeRelNS + `">` +
+		`<sheets><sheet name="Company_Detail" sheetId="1" r:id="rId1"/></sheets>` +
+		`</workbook>`},
+	{xlsxWorkbookRel, `<Relationships xmlns="` + relationshipNS + `">` +
+		`<Relationship Id="rId1" Type="` + officeRelNS + `/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`<Relationship Id="rId2" Type="` + officeRelNS + `/styles" Target="styles.xml"/>` +
+		`</Relationships>`},
+	{xlsxStylesPart, xlsxStyles},
+}
+
+// xlsxEpoch is day 0 of the XLSX date serials
+var xlsxEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// xlsxMaxSerial is the date serial of 9999-12-31, the last day spreadsheets
+// write
+const xlsxMaxSerial = 2958465
+
+// xlsxEncoder streams the companies as the rows of an XLSX sheet, with inline
+// strings so no part has to be held until the end. NULL is an empty cell and
+// timestamps are written in UTC, XLSX has no time zones
+type xlsxEncoder struct {
+	archive *zip.Writer
+	sheet   io.Writer
+	rows    int
+}
+
+// newXLSXEncoder writes the fixed parts of the workbook and opens its sheet
+func newXLSXEncoder(w io.Writer) (*xlsxEncoder, error) {
+
+	archive := zip.NewWriter(w)
+	for _, part := range xlsxParts {
+		entry, err := archive.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = io.WriteString(entry, xmlHeader+part.content); err != nil {
+			return nil, err
+		}
+	}
+
+	sheet, err := archive.Create(xlsxSheetPart)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = io.WriteString(sheet, xmlHeader+`<worksheet xmlns="`+spreadsheetNS+`"><sheetData>`); err != nil {
+		return nil, err
+	}
+	return &xlsxEncoder{archive: archive, sheet: sheet}, nil
+}
+
+func (e *xlsxEncoder) header(names []string) error {
+
+	values := make([]interface{}, len(names))
+	for i, name := range names {
+		values[i] = name
+	}
+	return e.writeRow(values)
+}
+
+func (e *xlsxEncoder) row(fields []companyField, company *Company) error {
+
+	values := make([]interface{}, len(fields))
+	for i, field := range fields {
+		values[i] = cellValue(field, company)
+	}
+	return e.writeRow(values)
+}
+
+func (e *xlsxEncoder) close() error {
+
+	if _, err := io.WriteString(e.sheet, `</sheetData></worksheet>`); err != nil {
+		return err
+	}
+	return e.archive.Close()
+}
+
+// writeRow writes the next row of the sheet, the cells are referenced since
+// NULL cells are left out
+func (e *xlsxEncoder) writeRow(values []interface{}) error {
+
+	e.rows++
+	row := strconv.Itoa(e.rows)
+
+	var buf bytes.Buffer
+	buf.WriteString(`<row r="` + row + `">`)
+	for i, value := range values {
+
+		ref := xlsxColumn(i) + row
+		switch value := value.(type) {
+		case int64:
+			buf.WriteString(`<c r="` + ref + `"><v>` + strconv.FormatInt(value, 10) + `</v></c>`)
+		case string:
+			buf.WriteString(`<c r="` + ref + `" t="inlineStr"><is><t xml:space="preserve">`)
+			xml.EscapeText(&buf, []byte(value))
+			buf.WriteString(`</t></is></c>`)
+		case time.Time:
+			buf.WriteString(xlsxDateCell(ref, xlsxTimestampStyle, value))
+		case cellDate:
+			buf.WriteString(xlsxDateCell(ref, xlsxDateStyle, value.Time))
+		}
+	}
+	buf.WriteString(`</row>`)
+
+	_, err := e.sheet.Write(buf.Bytes())
+	return err
+}
+
+// xlsxDateCell returns a cell holding the serial number of a time, in days
+// since xlsxEpoch
+func xlsxDateCell(ref, style string, value time.Time) string {
+
+	serial := float64(value.UTC().Sub(xlsxEpoch)) / float64(24*time.Hour)
+	return `<c r="` + ref + `" s="` + style + `"><v>` + strconv.FormatFloat(serial, 'f', -1, 64) + `</v></c>`
+}
+
+// xlsxColumn returns the letters of a 0 based column
+func xlsxColumn(i int) string {
+
+	letters := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		letters = string(rune('A'+(i-1)%26)) + letters
+	}
+	return letters
+}
+
+// xlsxColumnIndex returns the 0 based column of a cell reference such as B12,
+// -1 without column letters or past the last column
+func xlsxColumnIndex(ref string) int {
+
+	i := 0
+	for _, letter := range ref {
+		if letter < 'A' || letter > 'Z' {
+			break
+		}
+		if i = 26*i + int(letter-'A') + 1; i > xlsxMaxColumns {
+			return -1
+		}
+	}
+	return i - 1
+}
+
+type (
+
+	// xlsxText is a shared or inline string, plain or in rich text runs
+	xlsxText struct {
+		T    string `xml:"t"`
+		Runs []struct {
+			T string `xml:"t"`
+		} `xml:"r"`
+	}
+
+	// xlsxRow is a row of a sheet, its cells only hold their raw value
+	xlsxRow struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			R      string   `xml:"r,attr"`
+			T      string   `xml:"t,attr"`
+			S      int      `xml:"s,attr"`
+			V      string   `xml:"v"`
+			Inline xlsxText `xml:"is"`
+		} `xml:"c"`
+	}
+
+	// xlsxRelationships are the relationships of a workbook part
+	xlsxRelationships struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Type   string `xml:"Type,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+)
+
+// text returns the text of a shared or inline string
+func (t xlsxText) text() string {
+
+	text := t.T
+	for _, run := range t.Runs {
+		text += run.T
+	}
+	return text
+}
+
+// xlsxPart reads a workbook part up to maxXLSXPartBytes uncompressed, and
+// fails past them
+type xlsxPart struct {
+	io.Closer
+	name    string
+	content io.Reader
+	read    int64
+}
+
+// openXLSXPart opens a workbook part
+func openXLSXPart(file *zip.File) (*xlsxPart, error) {
+
+	content, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &xlsxPart{Closer: content, name: file.Name, content: io.LimitReader(content, maxXLSXPartBytes+1)}, nil
+}
+
+func (p *xlsxPart) Read(b []byte) (int, error) {
+
+	n, err := p.content.Read(b)
+	if p.read += int64(n); p.read > maxXLSXPartBytes {
+		return 0, fmt.Errorf("%s exceeds %d bytes uncompressed", p.name, maxXLSXPartBytes)
+	}
+	return n, err
+}
+
+// xlsxReader reads the rows of the first sheet of an XLSX workbook as text,
+// resolving the shared strings and the numbers of the date cell formats
+type xlsxReader struct {
+	sheet      *xml.Decoder
+	strings    []string
+	dateStyles []bool
+	row        int
+}
+
+// newXLSXReader opens the first sheet of an XLSX workbook
+func newXLSXReader(data []byte) (*xlsxReader, error) {
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	parts := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		parts[file.Name] = file
+	}
+	decode := func(name string, v interface{}) error {
+		file, ok := parts[name]
+		if !ok {
+			return fmt.Errorf("workbook lacks %s", name)
+		}
+		content, err := openXLSXPart(file)
+		if err != nil {
+			return err
+		}
+		defer content.Close()
+		return xml.NewDecoder(content).Decode(v)
+	}
+
+	// the first sheet and the parts it needs are found through the workbook
+	var workbook struct {
+		Sheets []struct {
+			ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	var rels xlsxRelationships
+	if err = decode(xlsxWorkbook, &workbook); err != nil {
+		return nil, err
+	}
+	if err = decode(xlsxWorkbookRel, &rels); err != nil {
+		return nil, err
+	}
+	if len(workbook.Sheets) == 0 {
+		return nil, errors.New("workbook has no sheet")
+	}
+
+	reader := &xlsxReader{}
+	sheetPart := ""
+	for _, rel := range rels.Relationships {
+
+		target := strings.TrimPrefix(rel.Target, "/")
+		if !strings.HasPrefix(rel.Target, "/") {
+			target = path.Join(path.Dir(xlsxWorkbook), rel.Target)
+		}
+
+		switch {
+		case rel.ID == workbook.Sheets[0].ID:
+			sheetPart = target
+		case strings.HasSuffix(rel.Type, "/sharedStrings"):
+			var shared struct {
+				Items []xlsxText `xml:"si"`
+			}
+			if err = decode(target, &shared); err != nil {
+				return nil, err
+			}
+			for _, item := range shared.Items {
+				reader.strings = append(reader.strings, item.text())
+			}
+		case strings.HasSuffix(rel.Type, "/styles"):
+			if reader.dateStyles, err = xlsxDateStyles(decode, target); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	sheet, ok := parts[sheetPart]
+	if !ok {
+		return nil, fmt.Errorf("workbook lacks its first sheet %s", sheetPart)
+	}
+	content, err := openXLSXPart(sheet)
+	if err != nil {
+		return nil, err
+	}
+	reader.sheet = xml.NewDecoder(content)
+	return reader, nil
+}
+
+// xlsxDateStyles reports which cell styles of the styles part format dates
+func xlsxDateStyles(decode func(name string, v interface{}) error, name string) ([]bool, error) {
+
+	var styles struct {
+		NumFmts []struct {
+			ID   int    `xml:"numFmtId,attr"`
+			Code string `xml:"formatCode,attr"`
+		} `xml:"numFmts>numFmt"`
+		CellXfs []struct {
+			NumFmtID int `xml:"numFmtId,attr"`
+		} `xml:"cellXfs>xf"`
+	}
+	if err := decode(name, &styles); err != nil {
+		return nil, err
+	}
+
+	codes := make(map[int]string, len(styles.NumFmts))
+	for _, numFmt := range styles.NumFmts {
+		codes[numFmt.ID] = numFmt.Code
+	}
+	dateStyles := make([]bool, len(styles.CellXfs))
+	for i, xf := range styles.CellXfs {
+		id := xf.NumFmtID
+		code, custom := codes[id]
+		dateStyles[i] = custom && isDateFormat(code) || !custom && (id >= 14 && id <= 22 || id >= 45 && id <= 47)
+	}
+	return dateStyles, nil
+}
+
+// isDateFormat reports whether a custom number format shows dates or times,
+// leaving out its quoted text, escaped characters and [colors]
+func isDateFormat(code string) bool {
+
+	quoted, bracketed := false, false
+	for i := 0; i < len(code); i++ {
+		switch c := code[i]; {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '\\':
+			i++
+		case c == '[':
+			bracketed = true
+		case c == ']':
+			bracketed = false
+		case bracketed:
+		case strings.IndexByte("yYdDhHsS", c) >= 0:
+			return true
+		}
+	}
+	return false
+}
+
+// next returns the number and the cell texts of the next row, io.EOF after the
+// last one. Cells left out are empty
+func (x *xlsxReader) next() (int, []string, error) {
+
+	for {
+		token, err := x.sheet.Token()
+		if err != nil {
+			return 0, nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+
+		var row xlsxRow
+		if err = x.sheet.DecodeElement(&row, &start); err != nil {
+			return 0, nil, err
+		}
+		x.row++
+		if row.R > 0 {
+			x.row = row.R
+		}
+
+		var cells []string
+		for _, cell := range row.Cells {
+
+			column := len(cells)
+			if cell.R != "" {
+				if column = xlsxColumnIndex(cell.R); column < 0 {
+					return 0, nil, fmt.Errorf("row %d : invalid cell reference %s", x.row, cell.R)
+				}
+			}
+			if column >= xlsxMaxColumns {
+				return 0, nil, fmt.Errorf("row %d : more than %d cells", x.row, xlsxMaxColumns)
+			}
+			text, err := x.cellText(cell.T, cell.S, cell.V, cell.Inline)
+			if err != nil {
+				return 0, nil, fmt.Errorf("cell %s%d : %w", xlsxColumn(column), x.row, err)
+			}
+			for len(cells) <= column {
+				cells = append(cells, "")
+			}
+			cells[column] = text
+		}
+		return x.row, cells, nil
+	}
+}
+
+// cellText returns the text of a cell, the numbers of a date style are written
+// as YYYY-MM-DD dates or RFC 3339 timestamps
+func (x *xlsxReader) cellText(cellType string, style int, value string, inline xlsxText) (string, error) {
+
+	switch cellType {
+	case "s":
+		i, err := strconv.Atoi(value)
+		if err != nil || i < 0 || i >= len(x.strings) {
+			return "", fmt.Errorf("unknown shared string %s", value)
+		}
+		return x.strings[i], nil
+	case "inlineStr":
+		return inline.text(), nil
+	case "", "n":
+		if value == "" || style < 0 || style >= len(x.dateStyles) || !x.dateStyles[style] {
+			return value, nil
+		}
+		// the serials past 9999-12-31 would overflow a time.Duration, the days are
+		// added as dates and only the time of day as a duration
+		serial, err := strconv.ParseFloat(value, 64)
+		if err != nil || !(serial >= 0 && serial < xlsxMaxSerial+1) {
+			return "", fmt.Errorf("invalid date serial %s", value)
+		}
+		seconds := int64(math.Round(serial * 24 * 60 * 60))
+		day := xlsxEpoch.AddDate(0, 0, int(seconds/(24*60*60)))
+		return formatDate(day.Add(time.Duration(seconds%(24*60*60)) * time.Second)), nil
+	}
+	return value, nil
+}